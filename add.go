@@ -0,0 +1,150 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var addTitle string
+
+func addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&addTitle, "title", "", "title of the page, the archived page's own title is shown if empty")
+	fs.BoolVar(&addClipboard, "clipboard", false, "archive urls from the clipboard, along with the ones given as arguments")
+}
+
+// runAdd archives urls right away into the archive as it was left by the last run,
+// new firefox bookmarks are not looked at, the next regular run takes care of them.
+func runAdd(ctx context.Context, args []string) error {
+	if addClipboard {
+		urls, err := clipboardURLs(ctx)
+		if err != nil {
+			return err
+		}
+		args = append(args, urls...)
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ueb-archive add [flags] <url...>")
+		return exitCode(2)
+	}
+
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+	for _, u := range args {
+		if err := (queueRequest{URL: u}).validate(); err != nil {
+			return fmt.Errorf("bad url %q: %w", u, err)
+		}
+	}
+	if _, err := exec.LookPath("wget"); err != nil {
+		return err
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	again := make(map[string]bool, len(args))
+	for _, u := range args {
+		bmark := newBookmark(u, addTitle)
+		if err := addBookmark(state, bmark); err != nil {
+			return err
+		}
+		again[bmark.url] = true
+	}
+
+	list, err := archiveAgain(ctx, state, again, order)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, bmark := range list {
+		if !again[bmark.url] {
+			continue
+		}
+		index, ok := bmark.captured()
+		if !ok || bmark.refreshFailed() {
+			fmt.Fprintf(os.Stderr, "FAILED %s: %s\n", bmark.url, bmark.failure)
+			failed = true
+			continue
+		}
+		fmt.Println(path.Join(archiveRoot, index))
+	}
+	if failed {
+		return exitCode(1)
+	}
+	return nil
+}
+
+// archiveAgain archives the urls in again, even if there are fresh captures of them,
+// keeping the rest of the archive as it was left by the last run.
+func archiveAgain(ctx context.Context, state *sql.DB, again map[string]bool, order func(a, b bookmark) int) ([]bookmark, error) {
+	list, known, err := archivedBookmarks(state, again)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendQueue(state, notArchived(list, known)); err != nil {
+		return nil, err
+	}
+
+	err = archiveBookmarks(ctx, state, list, known, again, order)
+	var code exitCode
+	if err != nil && !errors.As(err, &code) {
+		return nil, err
+	}
+	// the run fails for the earlier failures as well, only ours matter to the caller
+	return list, nil
+}
+
+// notArchived are the bookmarks of the list to download, not in known.
+func notArchived(list []bookmark, known map[int64]store.Entry) []bookmark {
+	var out []bookmark
+	for _, bmark := range list {
+		if _, ok := known[bmark.hash]; !ok {
+			out = append(out, bmark)
+		}
+	}
+	return out
+}
+
+// archivedBookmarks are the bookmarks from the index.json, along with the added ones,
+// and the index.json entries to keep as they are, all but the ones in again.
+// Urls in again which are duplicates of another bookmark are replaced with its url,
+// see againAliases.
+func archivedBookmarks(state *sql.DB, again map[string]bool) ([]bookmark, map[int64]store.Entry, error) {
+	entries, err := readManifest()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+	list, err = withAddedBookmarks(state, list)
+	if err != nil {
+		return nil, nil, err
+	}
+	list = dedupeBookmarks(list)
+	againAliases(list, again)
+
+	known := make(map[int64]store.Entry, len(entries))
+	for _, entry := range entries {
+		if !again[entry.URL] {
+			known[entry.Hash] = entry
+		}
+	}
+	return list, known, nil
+}
@@ -0,0 +1,160 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+// the added table keeps bookmarks which are not in firefox,
+// but were sent to us directly, they are archived along with the folder.
+const addedSchema = `
+create table if not exists added (
+	hash integer primary key,
+	url text not null,
+	title text not null,
+	date_added integer not null
+);
+
+create table if not exists added_tags (
+	hash integer not null,
+	tag text not null,
+	primary key (hash, tag)
+);
+`
+
+// addedSource finds bookmarks elsewhere than in the -browser, e.g. in feeds,
+// and adds them to the added table, so they stay after they are gone from there.
+type addedSource struct {
+	name    string
+	enabled func() bool
+	add     func(ctx context.Context, state *sql.DB) error
+}
+
+// addedSources are checked on every archive run, along with the -browser.
+var addedSources = []addedSource{
+	{"feeds", func() bool { return len(feeds) > 0 }, addFeedEntries},
+	{"hacker news", func() bool { return len(hnUser) > 0 }, addHNStories},
+	{"reddit", func() bool { return len(redditUser) > 0 }, addRedditSaved},
+	{"mastodon", func() bool { return len(mastodonURL) > 0 }, addMastodonStatuses},
+	{"imap", func() bool { return len(imapURL) > 0 }, addIMAPMessages},
+	{"telegram", func() bool { return len(telegramToken) > 0 }, addTelegramLinks},
+}
+
+// addSourceBookmarks adds bookmarks of the enabled addedSources,
+// a source failing is reported and skipped, the run goes on.
+func addSourceBookmarks(ctx context.Context, state *sql.DB) {
+	for _, src := range addedSources {
+		if !src.enabled() {
+			continue
+		}
+		if err := src.add(ctx, state); err != nil {
+			slog.Warn("failed to add bookmarks", "source", src.name, "err", err)
+		}
+	}
+}
+
+// chromeTag makes applyTags render the page by chrome, for pages which are blank without scripts.
+const chromeTag = "ueb:backend=chrome"
+
+// titles of posts are the beginning of their text
+const maxExcerptTitle = 80
+
+// excerptTitle is the beginning of the text of a post, tweet or the like,
+// the meta step takes the page's title if it's empty.
+func excerptTitle(text string) string {
+	text = cleanText(text)
+	if utf8.RuneCountInString(text) <= maxExcerptTitle {
+		return text
+	}
+	return string([]rune(text)[:maxExcerptTitle-1]) + "…"
+}
+
+// newBookmark makes a bookmark for an url which doesn't come from firefox,
+// without tracking parameters.
+func newBookmark(url, title string) bookmark {
+	url = stripTracking(url)
+	return bookmark{
+		title:     title,
+		url:       url,
+		hash:      sources.URLHash(url),
+		dateAdded: time.Now(),
+	}
+}
+
+func addBookmark(db *sql.DB, bmark bookmark) error {
+	_, err := db.Exec(`insert into added (hash, url, title, date_added) values (?, ?, ?, ?)
+		on conflict (hash) do update set title=coalesce(nullif(excluded.title, ''), title)`,
+		bmark.hash, bmark.url, bmark.title, bmark.dateAdded.UnixMicro())
+	if err != nil {
+		return fmt.Errorf("save added bookmark: %w", err)
+	}
+	for _, tag := range bmark.tags {
+		if _, err := db.Exec(`insert or ignore into added_tags (hash, tag) values (?, ?)`, bmark.hash, tag); err != nil {
+			return fmt.Errorf("save added bookmark tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// withAddedBookmarks appends added bookmarks to the list,
+// unless they are in firefox already. Url hashes are compared as well as urls,
+// since only firefox knows the hash for sure.
+func withAddedBookmarks(db *sql.DB, list []bookmark) ([]bookmark, error) {
+	tags, err := addedTags(db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`select hash, url, title, date_added from added order by date_added`)
+	if err != nil {
+		return nil, fmt.Errorf("query added bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[int64]bool, len(list))
+	knownURLs := make(map[string]bool, len(list))
+	for _, bmark := range list {
+		known[bmark.hash] = true
+		knownURLs[bmark.url] = true
+	}
+
+	for rows.Next() {
+		var bmark bookmark
+		var dateAdded int64
+		if err := rows.Scan(&bmark.hash, &bmark.url, &bmark.title, &dateAdded); err != nil {
+			return nil, fmt.Errorf("query added bookmark row: %w", err)
+		}
+		if known[bmark.hash] || knownURLs[bmark.url] {
+			continue
+		}
+		bmark.dateAdded = time.UnixMicro(dateAdded)
+		bmark.tags = tags[bmark.hash]
+		list = append(list, bmark)
+	}
+	return list, rows.Err()
+}
+
+// addedTags are tags of the added bookmarks, by their hash.
+func addedTags(db *sql.DB) (map[int64][]string, error) {
+	rows, err := db.Query(`select hash, tag from added_tags order by rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("query added bookmark tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var hash int64
+		var tag string
+		if err := rows.Scan(&hash, &tag); err != nil {
+			return nil, fmt.Errorf("query added bookmark tags: %w", err)
+		}
+		tags[hash] = append(tags[hash], tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,189 @@
+package uebarchive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+// queueHandler accepts a queueRequest json, see enqueue. Only json is accepted,
+// so a random web page can't make the browser post here without CORS preflight.
+func queueHandler(queue chan<- queueRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, status, err := readQueueRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if _, _, err := enqueue(queue, req); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// readQueueRequest decodes and validates the request body,
+// returns the http status to reply with on error.
+func readQueueRequest(r *http.Request) (queueRequest, int, error) {
+	var req queueRequest
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		return req, http.StatusUnsupportedMediaType, errors.New("json is expected")
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		return req, http.StatusBadRequest, err
+	}
+	if err := req.validate(); err != nil {
+		return req, http.StatusBadRequest, err
+	}
+	return req, http.StatusOK, nil
+}
+
+// enqueue saves the page as an added bookmark to be archived on the next run,
+// and passes it to the daemon (if any, queue is nil otherwise) to archive right away,
+// queued tells if it has been.
+func enqueue(queue chan<- queueRequest, req queueRequest) (bmark bookmark, queued bool, err error) {
+	bmark = newBookmark(req.URL, req.Title)
+	state, err := openStateDB()
+	if err != nil {
+		return bmark, false, err
+	}
+	defer state.Close()
+	if err := addBookmark(state, bmark); err != nil {
+		return bmark, false, err
+	}
+
+	if queue != nil {
+		select {
+		case queue <- req:
+			queued = true
+		default:
+			slog.Warn("the queue is full, leaving the page for the next run", "url", bmark.url)
+		}
+	}
+	return bmark, queued, nil
+}
+
+// apiArchive is the /queue for scripts and bookmarklets,
+// replies with the bookmark id to check its status later.
+func apiArchive(queue chan<- queueRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, status, err := readQueueRequest(r)
+		if err != nil {
+			writeAPIError(w, status, err)
+			return
+		}
+		bmark, _, err := enqueue(queue, req)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPI(w, http.StatusAccepted, queuedEntry(bmark))
+	}
+}
+
+// apiBookmarks lists every bookmark of the last run along with the queued ones,
+// in the index.json format, ?status=OK or MISSING or QUEUED filters the list.
+func apiBookmarks(w http.ResponseWriter, r *http.Request) {
+	entries, err := apiEntries()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if status := r.URL.Query().Get("status"); len(status) > 0 {
+		filtered := make([]store.Entry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Status == status {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	writeAPI(w, http.StatusOK, entries)
+}
+
+// apiBookmark returns a single bookmark by its id, the url hash.
+func apiBookmark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("bad bookmark id: %w", err))
+		return
+	}
+
+	entries, err := apiEntries()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.Hash == id {
+			writeAPI(w, http.StatusOK, entry)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, errors.New("no such bookmark"))
+}
+
+// apiEntries are the index.json entries, followed by added bookmarks
+// which haven't been archived yet.
+func apiEntries() ([]store.Entry, error) {
+	entries, err := readManifest()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return nil, err
+	}
+	defer state.Close()
+
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+	withAdded, err := withAddedBookmarks(state, list)
+	if err != nil {
+		return nil, err
+	}
+	archived := make(map[string]bool, len(list))
+	for _, bmark := range list {
+		archived[normalizeURL(bmark.url)] = true
+	}
+	for _, bmark := range withAdded[len(list):] {
+		// a duplicate is archived along with the page it's a duplicate of
+		if !archived[normalizeURL(bmark.url)] {
+			entries = append(entries, queuedEntry(bmark))
+		}
+	}
+	return entries, nil
+}
+
+func queuedEntry(bmark bookmark) store.Entry {
+	entry := newManifestEntry(bmark)
+	entry.Status = "QUEUED"
+	return entry
+}
+
+func writeAPI(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Warn("api: write response", "err", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPI(w, status, map[string]string{"error": err.Error()})
+}
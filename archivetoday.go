@@ -0,0 +1,118 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// newest redirects to the latest snapshot of the url, taking a new one
+// needs a captcha solved, so only the pages someone has saved before are there.
+const archiveTodayNewestURL = "https://archive.ph/newest/"
+
+// a teaser with the rest of the article hidden is rarely longer than that,
+// a page with a paywall marker but with more text has got the article anyway.
+const paywallMaxWords = 1000
+
+var archiveTodayFallback bool
+
+// archive.today is quick to answer with a captcha, one page at a time.
+var archiveTodayLimiter = newHostLimiter(10*time.Second, 1)
+
+var (
+	// schema.org markup news sites use to tell search engines the article is paywalled
+	notFreeRe = regexp.MustCompile(`(?i)"isAccessibleForFree"\s*:\s*"?false`)
+	// snapshot pages are archive.ph/AbCd1, the domain varies
+	archiveTodaySnapshotRe = regexp.MustCompile(`^https?://archive\.(ph|today|is|li|vn|fo|md)/[A-Za-z0-9]+$`)
+)
+
+// paywallMarkers are lower-cased bits of html paywall interstitials have.
+var paywallMarkers = []string{
+	`class="paywall`,
+	`id="paywall`,
+	`class="regwall`,
+	"meteredcontent",
+	"subscribe to continue reading",
+	"subscribe to read",
+	"subscribe now to continue",
+	"to continue reading, subscribe",
+	"already a subscriber",
+	"sign in to continue reading",
+	"log in to continue reading",
+	"you have reached your limit of free articles",
+	"this article is for subscribers",
+	"this content is for subscribers",
+	"subscriber-only",
+}
+
+// looksPaywalled tells if the capture is a paywall teaser: there is a paywall
+// marker in the page, and little text, less than paywallMaxWords.
+func looksPaywalled(bmark bookmark) bool {
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return false
+	}
+	bs, err := os.ReadFile(path.Join(archiveRoot, index))
+	if err != nil {
+		return false
+	}
+	page := string(bs)
+	if len(strings.Fields(pageText(page))) >= paywallMaxWords {
+		return false
+	}
+
+	if notFreeRe.MatchString(page) {
+		return true
+	}
+	page = strings.ToLower(page)
+	for _, marker := range paywallMarkers {
+		if strings.Contains(page, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverFromArchiveToday archives the latest archive.today snapshot of the paywalled
+// page instead, the teaser stays as it was if there is none.
+func recoverFromArchiveToday(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	const host = "archive.ph"
+	archiveTodayLimiter.acquire(host)
+	defer archiveTodayLimiter.release(host)
+	if err := archiveTodayLimiter.wait(ctx, host); err != nil {
+		return
+	}
+
+	teaser := bmark.archiveMeta
+	original, opts := bmark.url, bmark.fetch
+	bmark.url = archiveTodayNewestURL + original
+	bmark.fetch = opts.public()
+	logger.Info("page is paywalled, trying archive.today", "url", original)
+	// the newest snapshot redirects to the archive.today front page if there is none,
+	// the teaser is replaced only by a snapshot.
+	fetchCapture(ctx, logger, bmark, func(meta archiveMeta) error {
+		if !archiveTodaySnapshotRe.MatchString(meta.finalURL()) {
+			return errors.New("no archive.today snapshot")
+		}
+		return nil
+	})
+	bmark.url, bmark.fetch = original, opts
+
+	if len(bmark.failure) > 0 {
+		logger.Info("no archive.today snapshot", "url", original, "reason", bmark.failure)
+		bmark.archiveMeta, bmark.failure, bmark.exitCode = teaser, "", 0
+		return
+	}
+
+	bmark.archiveMeta.recovered = "archive.today (" + bmark.archiveMeta.finalURL() + "), the original is paywalled"
+	// those are of the snapshot, not of the page
+	bmark.archiveMeta.redirects = nil
+	if err := writeCaptureMeta(*bmark); err != nil {
+		logger.Warn("failed to write capture meta", "url", bmark.url, "err", err)
+	}
+}
@@ -0,0 +1,122 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// auditStep checks that everything the saved pages and stylesheets refer to
+// is in the capture: the completeness is the share of requisites which are,
+// the rest are listed as missing.
+type auditStep struct{}
+
+func (auditStep) name() string { return "audit" }
+
+func (auditStep) run(_ context.Context, bmark *bookmark) error {
+	meta := bmark.archiveMeta
+	if meta.backend == "chrome" {
+		// it's the html only on purpose, see fetchChrome
+		return nil
+	}
+
+	meta.requisites, meta.missing = 0, nil
+	seen := make(map[string]bool)
+	for _, fileName := range meta.saved {
+		ext := strings.ToLower(path.Ext(fileName))
+		if ext != ".html" && ext != ".htm" && ext != ".css" {
+			continue
+		}
+		bs, err := os.ReadFile(path.Join(archiveRoot, fileName))
+		if err != nil {
+			return fmt.Errorf("audit %s: %w", fileName, err)
+		}
+
+		var refs []string
+		if ext == ".css" {
+			refs = cssRefs(string(bs))
+		} else {
+			refs = pageRefs(string(bs))
+		}
+		for _, ref := range refs {
+			target, missing, ok := checkRequisite(fileName, ref)
+			if !ok || seen[target] {
+				continue
+			}
+			seen[target] = true
+			meta.requisites++
+			if missing {
+				meta.missing = append(meta.missing, target)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRequisite resolves the reference from the file, to a url or to a file relative
+// to the archive root, and tells if it's missing from the capture: a url is, the page
+// is opened from the disk. ok is false for what's not to check: data: urls, trackers.
+func checkRequisite(fileName, ref string) (target string, missing, ok bool) {
+	ref = strings.Trim(strings.TrimSpace(html.UnescapeString(ref)), `"'`)
+	u, err := url.Parse(ref)
+	if err != nil || len(ref) == 0 || strings.HasPrefix(ref, "#") {
+		return "", false, false
+	}
+	switch {
+	case u.Scheme == "data" || u.Scheme == "blob" || u.Scheme == "javascript" || u.Scheme == "about":
+		return "", false, false
+	case len(u.Scheme) == 0 && len(u.Host) > 0:
+		// //host/path
+		u.Scheme = "https"
+		fallthrough
+	case len(u.Scheme) > 0:
+		if isTrackerURL(u.String(), "") {
+			return "", false, false
+		}
+		return u.String(), true, true
+	case strings.HasPrefix(u.Path, "/"):
+		// the root of the disk, when opened from it
+		return ref, true, true
+	}
+
+	local := path.Join(path.Dir(fileName), u.Path)
+	_, err = os.Stat(path.Join(archiveRoot, local))
+	return local, err != nil, true
+}
+
+// pageRefs are the requisites of the html page, see requisiteRefs,
+// along with the urls in its styles.
+func pageRefs(page string) []string {
+	refs := requisiteRefs(page)
+	for _, m := range styleElemRe.FindAllStringSubmatch(page, -1) {
+		refs = append(refs, cssRefs(m[2])...)
+	}
+	for _, m := range styleAttrRe.FindAllStringSubmatch(page, -1) {
+		refs = append(refs, cssRefs(m[2])...)
+	}
+	return refs
+}
+
+// cssRefs are the url()s and @imports of the stylesheet.
+func cssRefs(css string) []string {
+	var refs []string
+	for _, m := range cssImportRe.FindAllStringSubmatch(css, -1) {
+		refs = append(refs, m[1]+m[2])
+	}
+	for _, m := range cssURLRe.FindAllStringSubmatch(css, -1) {
+		refs = append(refs, m[1]+m[2]+m[3])
+	}
+	return refs
+}
+
+// completeness is the share of requisites in the capture, in percent.
+func (a archiveMeta) completeness() int {
+	if a.requisites == 0 {
+		return 100
+	}
+	return 100 * (a.requisites - len(a.missing)) / a.requisites
+}
@@ -0,0 +1,135 @@
+package uebarchive
+
+import "log/slog"
+
+var mergeCanonical bool
+
+// linkCanonical finds bookmarks of pages with the same canonical url, which
+// the url deduplication can't tell are the same, e.g. an article under a few
+// sections of a site. They are linked to each other, or merged into one entry
+// with -merge-canonical, see mergeSamePage.
+func linkCanonical(list []bookmark) []bookmark {
+	canonical := func(bmark bookmark) string {
+		if bmark.archiveMeta == nil {
+			return ""
+		}
+		return bmark.archiveMeta.page.canonical
+	}
+	if mergeCanonical {
+		return mergeSamePage(list, canonical)
+	}
+
+	byCanonical := make(map[string][]int)
+	for i, bmark := range list {
+		if key := canonical(bmark); len(key) > 0 {
+			key = normalizeURL(key)
+			byCanonical[key] = append(byCanonical[key], i)
+		}
+	}
+	for _, same := range byCanonical {
+		for _, i := range same {
+			for _, j := range same {
+				if i != j {
+					other := list[j]
+					other.sameAs = nil
+					list[i].sameAs = append(list[i].sameAs, other)
+				}
+			}
+		}
+	}
+	return list
+}
+
+// mergeRedirected merges bookmarks redirecting to another bookmark, e.g. a short link
+// and the page itself, see mergeSamePage. Redirects to a page which is not bookmarked
+// are left alone, dead pages redirecting to the home page aren't the same page.
+// The redirect's capture stays where it is, under the hash kept in the merged entry.
+func mergeRedirected(list []bookmark) []bookmark {
+	bookmarked := make(map[string]bool, len(list))
+	for _, bmark := range list {
+		bookmarked[normalizeURL(bmark.url)] = true
+	}
+	return mergeSamePage(list, func(bmark bookmark) string {
+		if final := bookmarkFinalURL(bmark); bookmarked[normalizeURL(final)] {
+			return final
+		}
+		return ""
+	})
+}
+
+// mergeSamePage merges bookmarks with the same page url, as the page function says,
+// into one entry with the other urls as its aliases. The one kept is the bookmark
+// of the page url itself, or else the first one, those with a capture go first.
+// Hashes of the merged ones are kept too, so prune leaves their captures alone
+// and the next run doesn't download them again, see mergedHashes. Bookmarks with
+// no page url are left as they are.
+func mergeSamePage(list []bookmark, page func(bookmark) string) []bookmark {
+	byPage := make(map[string][]int)
+	for i, bmark := range list {
+		if key := page(bmark); len(key) > 0 {
+			key = normalizeURL(key)
+			byPage[key] = append(byPage[key], i)
+		}
+	}
+
+	dropped := make(map[int]bool)
+	for key, same := range byPage {
+		if len(same) < 2 {
+			continue
+		}
+
+		kept := same[0]
+		rank := func(i int) int {
+			r := 0
+			if list[i].archiveMeta != nil {
+				r += 2
+			}
+			if normalizeURL(list[i].url) == key {
+				r++
+			}
+			return r
+		}
+		for _, i := range same {
+			if rank(i) > rank(kept) {
+				kept = i
+			}
+		}
+
+		for _, i := range same {
+			if i == kept {
+				continue
+			}
+			slog.Debug("same page", "url", list[i].url, "same_as", list[kept].url)
+			list[kept].aliases = append(list[kept].aliases, list[i].url)
+			list[kept].aliases = append(list[kept].aliases, list[i].aliases...)
+			list[kept].merged = append(list[kept].merged, list[i].hash)
+			list[kept].merged = append(list[kept].merged, list[i].merged...)
+			dropped[i] = true
+		}
+	}
+	if len(dropped) == 0 {
+		return list
+	}
+
+	merged := make([]bookmark, 0, len(list)-len(dropped))
+	for i, bmark := range list {
+		if !dropped[i] {
+			merged = append(merged, bmark)
+		}
+	}
+	return merged
+}
+
+// mergedHashes are the hashes of bookmarks the last run has merged into another entry,
+// their captures are kept as they are, there is no point in downloading them again.
+func mergedHashes() map[int64]bool {
+	// no manifest means nothing is archived yet
+	entries, _ := readManifest()
+	merged := make(map[int64]bool)
+	for _, entry := range entries {
+		for _, hash := range entry.Merged {
+			merged[hash] = true
+		}
+	}
+	return merged
+}
@@ -0,0 +1,206 @@
+package uebarchive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type capturedFile struct {
+	// path is relative to the archive root
+	path   string
+	size   int64
+	sha256 string
+}
+
+// hashCapturedFiles stats and hashes every saved file,
+// files that are gone by now are skipped.
+func hashCapturedFiles(saved []string) []capturedFile {
+	files := make([]capturedFile, 0, len(saved))
+	for _, fileName := range saved {
+		sum, size, err := hashFile(path.Join(archiveRoot, fileName))
+		if err != nil {
+			continue
+		}
+		files = append(files, capturedFile{path: fileName, size: size, sha256: sum})
+	}
+	return files
+}
+
+func hashFile(fileName string) (string, int64, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// captureMetaFile is the meta.json stored in every capture directory,
+// it makes a capture self-describing without the rest of the archive.
+type captureMetaFile struct {
+	URL        string            `json:"url"`
+	Title      string            `json:"title"`
+	DateAdded  time.Time         `json:"date_added"`
+	Modified   time.Time         `json:"last_modified,omitzero"`
+	FetchedAt  time.Time         `json:"fetched_at"`
+	FetchTime  string            `json:"fetch_time"`
+	HTTPStatus int               `json:"http_status,omitempty"`
+	Requests   int               `json:"requests,omitempty"`
+	Statuses   map[int]int       `json:"statuses,omitempty"`
+	Received   int64             `json:"received,omitempty"`
+	Backend    string            `json:"backend"`
+	Attempts   int               `json:"attempts"`
+	Index      string            `json:"index"`
+	Size       int64             `json:"size"`
+	DiskSize   int64             `json:"disk_size,omitempty"`
+	Files      []captureFileMeta `json:"files"`
+
+	RobotsSkipped []string `json:"robots_skipped,omitempty"`
+	Recovered     string   `json:"recovered,omitempty"`
+	Wayback       string   `json:"wayback,omitempty"`
+	Redirects     []string `json:"redirects,omitempty"`
+	Thumbnail     string   `json:"thumbnail,omitempty"`
+	Text          string   `json:"text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Sanitized     int      `json:"sanitized,omitempty"`
+	Localized     int      `json:"localized,omitempty"`
+	Requisites    int      `json:"requisites,omitempty"`
+	Missing       []string `json:"missing,omitempty"`
+
+	Words map[string]int `json:"words,omitempty"`
+}
+
+type captureFileMeta struct {
+	// Path is relative to the capture directory
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func writeCaptureMeta(bmark bookmark) error {
+	meta := bmark.archiveMeta
+	dir := bmark.captureDir()
+	// the meta.json itself is a block at most, it doesn't matter
+	meta.diskSize = captureDiskUsage(dir)
+	index, ok := meta.index()
+	if !ok {
+		return errors.New("nothing captured")
+	}
+
+	out := captureMetaFile{
+		URL:        bmark.url,
+		Title:      bmark.displayTitle(),
+		DateAdded:  bmark.dateAdded,
+		Modified:   bmark.lastModified,
+		FetchedAt:  meta.archivedAt,
+		FetchTime:  meta.execTime.String(),
+		HTTPStatus: meta.httpStatus,
+		Requests:   meta.requests,
+		Statuses:   meta.statuses,
+		Received:   meta.received,
+		Backend:    meta.backend,
+		Attempts:   bmark.attempts,
+		Index:      strings.TrimPrefix(index, dir+"/"),
+		Size:       meta.size,
+		DiskSize:   meta.diskSize,
+		Files:      make([]captureFileMeta, 0, len(meta.files)),
+
+		RobotsSkipped: meta.robotsSkipped,
+		Recovered:     meta.recovered,
+		Wayback:       meta.wayback,
+		Redirects:     meta.redirects,
+		Thumbnail:     strings.TrimPrefix(meta.thumbnail, dir+"/"),
+		Text:          strings.TrimPrefix(meta.text, dir+"/"),
+		Summary:       meta.summary,
+		Sanitized:     meta.sanitized,
+		Localized:     meta.localized,
+		Requisites:    meta.requisites,
+		Missing:       meta.missing,
+		Words:         meta.words,
+	}
+	for _, f := range meta.files {
+		out.Files = append(out.Files, captureFileMeta{
+			Path:   strings.TrimPrefix(f.path, dir+"/"),
+			Size:   f.size,
+			SHA256: f.sha256,
+		})
+	}
+
+	bs, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal capture meta: %w", err)
+	}
+	if err := os.WriteFile(path.Join(archiveRoot, dir, "meta.json"), bs, 0o600); err != nil {
+		return fmt.Errorf("write capture meta: %w", err)
+	}
+	return nil
+}
+
+// loadCapture restores a previous capture of the bookmark from its meta.json,
+// returns nil if there is none.
+func loadCapture(bmark bookmark) *archiveMeta {
+	dir := bmark.captureDir()
+	bs, err := os.ReadFile(path.Join(archiveRoot, dir, "meta.json"))
+	if err != nil {
+		return nil
+	}
+
+	var stored captureMetaFile
+	if err := json.Unmarshal(bs, &stored); err != nil || len(stored.Index) == 0 {
+		return nil
+	}
+
+	execTime, _ := time.ParseDuration(stored.FetchTime)
+	meta := &archiveMeta{
+		saved:         []string{path.Join(dir, stored.Index)},
+		size:          stored.Size,
+		httpStatus:    stored.HTTPStatus,
+		requests:      stored.Requests,
+		statuses:      stored.Statuses,
+		received:      stored.Received,
+		execTime:      execTime,
+		archivedAt:    stored.FetchedAt,
+		robotsSkipped: stored.RobotsSkipped,
+		recovered:     stored.Recovered,
+		wayback:       stored.Wayback,
+		redirects:     stored.Redirects,
+		backend:       stored.Backend,
+		sanitized:     stored.Sanitized,
+		localized:     stored.Localized,
+		requisites:    stored.Requisites,
+		missing:       stored.Missing,
+		words:         stored.Words,
+		summary:       stored.Summary,
+		diskSize:      stored.DiskSize,
+	}
+	if len(stored.Thumbnail) > 0 {
+		meta.thumbnail = path.Join(dir, stored.Thumbnail)
+	}
+	if len(stored.Text) > 0 {
+		meta.text = path.Join(dir, stored.Text)
+	}
+	for _, f := range stored.Files {
+		p := path.Join(dir, f.Path)
+		if p != meta.saved[0] {
+			meta.saved = append(meta.saved, p)
+		}
+		meta.files = append(meta.files, capturedFile{path: p, size: f.Size, sha256: f.SHA256})
+	}
+	meta.page = parsePageMeta(path.Join(archiveRoot, meta.saved[0]), stored.URL)
+
+	return meta
+}
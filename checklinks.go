@@ -0,0 +1,294 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+// link_checks keeps the latest check of every bookmark's original url.
+const linkChecksSchema = `
+create table if not exists link_checks (
+	hash integer primary key,
+	url text not null,
+	checked_at integer not null,
+	status integer not null,
+	final_url text not null,
+	redirects text not null,
+	error text not null,
+	dead integer not null
+);
+`
+
+// redirects followed before giving up, same as the http.Client does.
+const maxRedirects = 10
+
+// linkCheck is the state of the original url, as of checkedAt.
+type linkCheck struct {
+	hash      int64
+	url       string
+	checkedAt time.Time
+	// status of the last response, after redirects, 0 if there is none
+	status   int
+	finalURL string
+	// redirects are the urls in between, the original and final ones excluded
+	redirects []string
+	err       string
+	// unreachable is set if the host doesn't resolve or refuses connections,
+	// other errors (like timeouts) may well be temporary.
+	unreachable bool
+}
+
+// dead is true if the page is gone: 404 or 410, or its host is.
+func (c linkCheck) dead() bool {
+	return c.status == http.StatusNotFound || c.status == http.StatusGone || c.unreachable
+}
+
+// moved is true if the url redirects somewhere else for good.
+func (c linkCheck) moved() bool {
+	return !c.dead() && c.finalURL != c.url
+}
+
+func (c linkCheck) describe() string {
+	switch {
+	case c.status == 0:
+		return c.err
+	case c.moved():
+		return fmt.Sprintf("status=%d at %s", c.status, c.finalURL)
+	default:
+		return fmt.Sprintf("status=%d", c.status)
+	}
+}
+
+func checkLinksFlags(fs *flag.FlagSet) {
+	fs.IntVar(&workers, "workers", 4, "number of parallel checks")
+	fs.DurationVar(&perHostDelay, "per-host-delay", time.Second, "minimal delay between requests to the same host")
+	fs.IntVar(&perHostWorkers, "per-host-workers", 1, "maximum simultaneous requests to the same host, 0 for no limit")
+}
+
+// runCheckLinks checks if bookmarks of the last run are still alive, saves the results
+// into the state database and writes the links.html report.
+func runCheckLinks(ctx context.Context, _ []string) error {
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+
+	checks := checkLinks(ctx, list)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, check := range checks {
+		if err := saveLinkCheck(state, check); err != nil {
+			return err
+		}
+	}
+
+	dead, moved, onlyArchived := 0, 0, 0
+	for i, check := range checks {
+		switch {
+		case check.dead():
+			dead++
+			mark := ""
+			if list[i].archiveMeta != nil {
+				onlyArchived++
+				mark = " (only in the archive)"
+			}
+			fmt.Fprintf(console, "DEAD   %s: %s%s\n", check.url, check.describe(), mark)
+		case check.moved():
+			moved++
+			fmt.Fprintf(console, "MOVED  %s -> %s\n", check.url, check.finalURL)
+		}
+	}
+	fmt.Fprintf(console, "checked %d links, %d dead (%d only in the archive), %d moved\n", len(checks), dead, onlyArchived, moved)
+
+	if err := makeLinkReport(list, checks); err != nil {
+		return err
+	}
+	if dead > 0 {
+		return exitCode(1)
+	}
+	return nil
+}
+
+// checkLinks checks every bookmark's url, spacing out requests
+// to the same host by -per-host-delay, the result is in the list order.
+func checkLinks(ctx context.Context, list []bookmark) []linkCheck {
+	checks := make([]linkCheck, len(list))
+	limiter := newHostLimiter(perHostDelay, perHostWorkers)
+
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				host := list[i].domain()
+				limiter.acquire(host)
+				if err := limiter.wait(ctx, host); err == nil {
+					checks[i] = checkLink(ctx, list[i])
+				}
+				markProgress()
+				limiter.release(host)
+			}
+		}()
+	}
+
+	for i := range list {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return checks
+}
+
+// checkLink HEADs the url, following redirects by hand to record them,
+// servers that don't do HEAD get a GET.
+func checkLink(ctx context.Context, bmark bookmark) linkCheck {
+	check := linkCheck{hash: bmark.hash, url: bmark.url, finalURL: bmark.url, checkedAt: time.Now()}
+
+	opts, err := fetchOptionsFor(bmark.url)
+	if err != nil {
+		check.err = err.Error()
+		return check
+	}
+	transport, err := proxyTransport(opts.proxy)
+	if err != nil {
+		check.err = err.Error()
+		return check
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	do := func(method, target string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", opts.userAgent)
+		for _, h := range opts.headers {
+			name, value, _ := strings.Cut(h, ":")
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		return client.Do(req)
+	}
+
+	target := bmark.url
+	for range maxRedirects {
+		resp, err := do(http.MethodHead, target)
+		if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			resp.Body.Close()
+			resp, err = do(http.MethodGet, target)
+		}
+		if err != nil {
+			check.err = err.Error()
+			var dnsErr *net.DNSError
+			check.unreachable = errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+			return check
+		}
+		resp.Body.Close()
+		check.status = resp.StatusCode
+
+		loc, err := resp.Location()
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || err != nil {
+			return check
+		}
+		if target != bmark.url {
+			check.redirects = append(check.redirects, target)
+		}
+		target = loc.String()
+		check.finalURL = target
+	}
+	check.err = "too many redirects"
+	return check
+}
+
+func saveLinkCheck(db *sql.DB, check linkCheck) error {
+	if check.checkedAt.IsZero() {
+		// never checked, e.g. interrupted
+		return nil
+	}
+	_, err := db.Exec(`insert or replace into link_checks (hash, url, checked_at, status, final_url, redirects, error, dead)
+		values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		check.hash, check.url, check.checkedAt.Unix(), check.status, check.finalURL, strings.Join(check.redirects, " "), check.err, check.dead())
+	if err != nil {
+		return fmt.Errorf("save link check: %w", err)
+	}
+	return nil
+}
+
+// makeLinkReport writes links.html with dead and moved links,
+// the dead ones we have a capture of go first, that's the only copy left.
+func makeLinkReport(list []bookmark, checks []linkCheck) error {
+	var onlyArchived, dead, moved string
+	for i, check := range checks {
+		bmark := list[i]
+		link := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(check.url), html.EscapeString(bmark.displayTitle()))
+		var rel string
+		if bmark.archiveMeta != nil {
+			rel, _ = bmark.archiveMeta.index()
+		}
+		switch {
+		case check.dead() && len(rel) > 0:
+			onlyArchived += fmt.Sprintf(`<li>%s, %s, <a href="%s">archived</a></li>`,
+				link, html.EscapeString(check.describe()), html.EscapeString(index.FileHref(rel)))
+		case check.dead():
+			dead += fmt.Sprintf("<li>%s, %s</li>", link, html.EscapeString(check.describe()))
+		case check.moved():
+			moved += fmt.Sprintf(`<li>%s &rarr; <a href="%s">%s</a></li>`,
+				link, html.EscapeString(check.finalURL), html.EscapeString(check.finalURL))
+		}
+	}
+
+	page := `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>μeb-archive links</title></head><body><h1>μeb-archive links</h1>`
+	page += fmt.Sprintf(`<p><a href="index.html">back to index</a> | checked %s</p>`, time.Now().Format(time.DateTime))
+	for _, section := range []struct{ title, items string }{
+		{"Dead, only in the archive", onlyArchived},
+		{"Dead, not archived", dead},
+		{"Moved", moved},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		page += "<h2>" + section.title + "</h2><ul>" + section.items + "</ul>"
+	}
+	page += "</body></html>"
+
+	if err := os.WriteFile(path.Join(archiveRoot, "links.html"), []byte(page), 0o600); err != nil {
+		return fmt.Errorf("write links report: %w", err)
+	}
+	return nil
+}
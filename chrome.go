@@ -0,0 +1,83 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/fetch"
+)
+
+// chromeNoSandbox runs chrome without its sandbox, which it can't set up
+// in some containers, it's turned off as root anyway.
+var chromeNoSandbox bool
+
+var headOpenRe = regexp.MustCompile(`(?i)<head[^>]*>`)
+
+// fetchChrome saves the page as headless chrome renders it, scripts included,
+// for sites which are blank without them. It's the rendered html only, with
+// a <base> pointing to the site for everything else. It saves into the partial
+// directory, as fetchWget does, and the result is the same.
+func fetchChrome(ctx context.Context, logger *slog.Logger, bmark *bookmark, partial string) (*archiveMeta, bool) {
+	started := time.Now()
+	logger.Debug("chrome download started", "url", bmark.url, "attempt", bmark.attempts)
+	_ = os.RemoveAll(path.Join(archiveRoot, partial))
+
+	opts := fetch.ChromeOptions{
+		UserAgent: bmark.fetch.userAgent,
+		Proxy:     bmark.fetch.proxy,
+		Headers:   bmark.fetch.headers,
+		NoSandbox: chromeNoSandbox,
+	}
+	if file := bookmarkCookies(*bmark); len(file) > 0 {
+		cookies, err := readCookies(file)
+		if err != nil {
+			bmark.failure = err.Error()
+			logger.Warn("can't run chrome", "url", bmark.url, "err", err)
+			return nil, false
+		}
+		opts.Cookies = cookies
+	}
+
+	dom, err := fetch.Chrome(ctx, fetch.Request{
+		URL:     bmark.url,
+		Root:    archiveRoot,
+		Dir:     partial,
+		Log:     bmark.logfile(),
+		Timeout: downloadTimeout,
+		Logger:  logger,
+	}, opts)
+	if err != nil {
+		return nil, fetchFailed(bmark, err)
+	}
+
+	base := fmt.Sprintf(`<base href="%s">`, html.EscapeString(bmark.url))
+	page := dropFiltered(dom)
+	if loc := headOpenRe.FindStringIndex(page); loc != nil {
+		page = page[:loc[1]] + base + page[loc[1]:]
+	} else {
+		page = base + page
+	}
+
+	if err := os.MkdirAll(path.Join(archiveRoot, partial), 0o700); err != nil {
+		bmark.failure = "create capture directory: " + err.Error()
+		return nil, false
+	}
+	index := path.Join(partial, "index.html")
+	if err := os.WriteFile(path.Join(archiveRoot, index), []byte(page), 0o600); err != nil {
+		bmark.failure = "write capture: " + err.Error()
+		return nil, false
+	}
+
+	return &archiveMeta{
+		saved:      []string{index},
+		backend:    "chrome",
+		execTime:   time.Since(started).Truncate(time.Millisecond),
+		archivedAt: time.Now(),
+	}, false
+}
@@ -0,0 +1,270 @@
+package uebarchive
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type command struct {
+	name string
+	args string
+	help string
+
+	flags func(fs *flag.FlagSet)
+	run   func(ctx context.Context, args []string) error
+	// locks is for commands writing into the archive, see lockArchive
+	locks bool
+}
+
+var commands []command
+
+func init() {
+	// must be populated in init, the help command refers back to the list.
+	commands = []command{
+		{
+			name:  "archive",
+			help:  "download every bookmark from the browser's folder and rebuild the index, that's the default command",
+			flags: withFlags(archiveRootFlags, lockFlags, firefoxFlags, downloadFlags, fetchFlags, indexFlags, metricsFlags, notifyFlags, mailFlags),
+			run:   runArchive,
+			locks: true,
+		},
+		{
+			name:  "daemon",
+			help:  "archive on schedule and serve the archive, until stopped",
+			flags: withFlags(archiveRootFlags, lockFlags, firefoxFlags, downloadFlags, fetchFlags, indexFlags, metricsFlags, notifyFlags, mailFlags, daemonFlags),
+			run:   runDaemon,
+			locks: true,
+		},
+		{
+			name:  "watch",
+			help:  "archive bookmarks as soon as they are added to the folder, until stopped",
+			flags: withFlags(archiveRootFlags, lockFlags, firefoxFlags, downloadFlags, fetchFlags, indexFlags, metricsFlags, notifyFlags, mailFlags, watchFlags),
+			run:   runWatch,
+			locks: true,
+		},
+		{
+			name:  "add",
+			help:  "archive the urls right away, without bookmarking them, prints paths of the captures",
+			flags: withFlags(archiveRootFlags, lockFlags, firefoxFlags, downloadFlags, fetchFlags, indexFlags, addFlags),
+			run:   runAdd,
+			locks: true,
+		},
+		{
+			name:  "sync-login",
+			help:  "sign in to a firefox account, for -browser firefox-sync on a machine without firefox",
+			flags: withFlags(syncLoginFlags),
+			run:   runSyncLogin,
+		},
+		{
+			name:  "native-host",
+			help:  "native messaging host for a browser extension, forwards pages to the daemon",
+			flags: withFlags(nativeHostFlags),
+			run:   runNativeHost,
+		},
+		{
+			name:  "list",
+			help:  "print archive entries from the last run",
+			flags: withFlags(archiveRootFlags, listFlags),
+			run:   runList,
+		},
+		{
+			name: "serve",
+			help: "serve the archive over http, along with the /api to query the status of pages, use the daemon to queue them",
+			flags: withFlags(archiveRootFlags, func(fs *flag.FlagSet) {
+				fs.StringVar(&serveAddr, "addr", "localhost:8080", "address to listen on")
+				fs.StringVar(&feedBaseURL, "base-url", "", "public URL of the archive, taken from the request if empty")
+			}),
+			run: runServe,
+		},
+		{
+			name:  "verify",
+			help:  "re-hash captured files and report the ones that changed or vanished, optionally download them again",
+			flags: withFlags(archiveRootFlags, lockFlags, firefoxFlags, downloadFlags, fetchFlags, indexFlags, verifyFlags),
+			run:   runVerify,
+			locks: true,
+		},
+		{
+			name:  "repair",
+			help:  "download requisites the audit has found missing from the captures, without the pages themselves",
+			flags: withFlags(archiveRootFlags, lockFlags, fetchFlags, indexFlags),
+			run:   runRepair,
+			locks: true,
+		},
+		{
+			name:  "export",
+			help:  "export the archive in another tool's format, e.g. to migrate to ArchiveBox, or as EPUB books and markdown notes",
+			flags: withFlags(archiveRootFlags, exportFlags),
+			run:   runExport,
+		},
+		{
+			name:  "import",
+			help:  "import urls, and optionally snapshots, from an ArchiveBox or shiori data directory, a OneTab export or bookmarked tweets of an X export, or pages from warc files",
+			flags: withFlags(archiveRootFlags, lockFlags, indexFlags, importFlags),
+			run:   runImport,
+			locks: true,
+		},
+		{
+			name:  "checklinks",
+			help:  "check if the original urls are still alive, report the dead and moved ones into links.html",
+			flags: withFlags(archiveRootFlags, lockFlags, fetchFlags, checkLinksFlags),
+			run:   runCheckLinks,
+			locks: true,
+		},
+		{
+			name:  "prune",
+			help:  "remove captures of bookmarks that are not in the archive anymore",
+			flags: withFlags(archiveRootFlags, lockFlags),
+			run:   runPrune,
+			locks: true,
+		},
+		{
+			name:  "reindex",
+			help:  "rebuild index pages from the last run without downloading anything",
+			flags: withFlags(archiveRootFlags, lockFlags, indexFlags),
+			run:   runReindex,
+			locks: true,
+		},
+		{
+			name:  "search",
+			args:  "<words...>",
+			help:  "find archive entries which title, url, description, note, tags or page content contain all the words",
+			flags: withFlags(archiveRootFlags, listFlags),
+			run:   runSearch,
+		},
+		{
+			name: "help",
+			help: "show this message",
+			run: func(context.Context, []string) error {
+				usage()
+				return nil
+			},
+		},
+	}
+}
+
+// lookupCommand picks a command by the first argument, falls back to
+// the archive, so the old "ueb-archive -folder xxx" invocation still works.
+func lookupCommand(args []string) (command, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commands[0], args, nil
+	}
+	if isNativeHostInvocation(args) {
+		cmd, _, err := lookupCommand([]string{"native-host"})
+		return cmd, nil, err
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd, args[1:], nil
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage()
+	return command{}, nil, exitCode(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: ueb-archive <command> [flags]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"ueb-archive <command> -h\" for command flags.\n")
+}
+
+func withFlags(sets ...func(fs *flag.FlagSet)) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		for _, set := range sets {
+			set(fs)
+		}
+	}
+}
+
+func archiveRootFlags(fs *flag.FlagSet) {
+	fs.StringVar(&archiveRoot, "archive", "/tmp/archive/", "where to store saved web pages")
+}
+
+// defaultFirefoxProfile is the profile firefox creates first.
+const defaultFirefoxProfile = "Profile0"
+
+func firefoxFlags(fs *flag.FlagSet) {
+	// fs.Var takes the value as it is for the default, see Run
+	urlFiles, feeds = nil, nil
+	fs.StringVar(&browser, "browser", defaultBrowser, "where to read bookmarks from: firefox, firefox-sync for the sync server (see sync-login), a chromium one: chrome, chromium, brave, edge, vivaldi, qutebrowser for all of its bookmarks and quickmarks, lynx, w3m or elinks for all bookmarks of their files, buku or linkding for the ones tagged with the -folder, or karakeep for the links of the -folder list; comma-separated to merge several, each entry is tagged with its source")
+	fs.Var(&urlFiles, "url-file", "text file with an url per line, optionally followed by the title, to archive along with the -browser bookmarks, -browser \"\" for the file alone; can be repeated")
+	fs.StringVar(&bookmarksFolder, "folder", "archive", "bookmarks folder name to archive")
+	fs.StringVar(&ffProfileName, "profile-name", defaultFirefoxProfile, "firefox profile name, check ~/.mozilla/firefox/profiles.ini; for chromium browsers the profile directory, e.g. \"Profile 1\", Default if not set; comma-separated to merge the -folder of several profiles, each entry is tagged with its profile")
+	fs.BoolVar(&allProfiles, "all-profiles", false, "merge the -folder of every firefox or chromium profile instead of the -profile-name ones, skipping those without it")
+	fs.Var(&feeds, "feed", "RSS or Atom feed, or OPML list of feeds, a file or a url, to archive new entries of on every archive run, along with the bookmarks; can be repeated")
+	fs.StringVar(&hnUser, "hn-user", "", "hacker news user to archive favorite stories of on every archive run, both the article and the discussion")
+	fs.BoolVar(&hnUpvoted, "hn-upvoted", false, "archive the stories -hn-user has upvoted as well, needs -hn-password")
+	fs.StringVar(&hnPassword, "hn-password", "", "hacker news password of -hn-user, better set it as UEB_HN_PASSWORD")
+	fs.StringVar(&redditUser, "reddit-user", "", "reddit user to archive saved posts and comments of on every archive run, the thread and the link, tagged reddit:<subreddit>")
+	fs.StringVar(&redditPassword, "reddit-password", "", "reddit password of -reddit-user, better set it as UEB_REDDIT_PASSWORD")
+	fs.StringVar(&redditClientID, "reddit-client-id", "", "id of the \"script\" app made for -reddit-user at https://www.reddit.com/prefs/apps")
+	fs.StringVar(&redditClientSecret, "reddit-client-secret", "", "secret of the app, better set it as UEB_REDDIT_CLIENT_SECRET")
+	fs.StringVar(&mastodonURL, "mastodon-url", "", "`url` of the mastodon server to archive bookmarked statuses of on every archive run, the status page and the links of it, tagged mastodon:<hashtag>, of the account of -mastodon-token")
+	fs.StringVar(&mastodonToken, "mastodon-token", "", "access token of an app with read:bookmarks and read:favourites scopes, made in Preferences > Development, better set it as UEB_MASTODON_TOKEN")
+	fs.BoolVar(&mastodonFavourites, "mastodon-favourites", false, "archive the statuses favourited on -mastodon-url as well")
+	fs.StringVar(&imapURL, "imap-url", "", "mail folder as imaps://user@host/folder to archive new emails of on every archive run, e.g. newsletters, each email is a capture of its own, imap:// is upgraded with STARTTLS unless the host is local")
+	fs.StringVar(&imapPassword, "imap-password", "", "password of the -imap-url user, better set it as UEB_IMAP_PASSWORD")
+	fs.BoolVar(&imapLinks, "imap-links", false, "archive the links of the emails instead of the emails themselves, but those which look like an action: unsubscribe, confirm, verify, log in and the like")
+	fs.StringVar(&telegramToken, "telegram-token", "", "token of a telegram bot made with @BotFather, links sent or forwarded to it are archived on every archive run, better set it as UEB_TELEGRAM_TOKEN")
+	fs.StringVar(&telegramUsers, "telegram-users", "", "comma-separated telegram user ids the bot takes links from, or usernames, ids are better as a username can change hands, the bot logs the ids of strangers")
+	fs.StringVar(&linkdingURL, "linkding-url", "", "base `url` of the linkding instance for -browser linkding")
+	fs.StringVar(&linkdingToken, "linkding-token", "", "linkding api token, better set it as UEB_LINKDING_TOKEN")
+	fs.BoolVar(&linkdingWriteBack, "linkding-write-back", false, "put the link to the capture into the notes of the bookmark on linkding, under the -feed-base-url, which it needs")
+	fs.StringVar(&karakeepURL, "karakeep-url", "", "base `url` of the Karakeep instance for -browser karakeep")
+	fs.StringVar(&karakeepToken, "karakeep-token", "", "Karakeep api key, better set it as UEB_KARAKEEP_TOKEN")
+	fs.BoolVar(&useCookies, "cookies", false, "send firefox cookies from the same profile, the first one of several, to archive pages behind a login")
+}
+
+func downloadFlags(fs *flag.FlagSet) {
+	// fs.Var takes the value as it is for the default, see Run
+	includeURLs, excludeURLs, addedAfter, filterLists = nil, nil, sinceFlag{}, nil
+	limitRate, maxSize = 0, 0
+	fs.Var(&includeURLs, "include", "only archive urls matching the regexp (or glob:pattern), can be repeated")
+	fs.Var(&excludeURLs, "exclude", "skip urls matching the regexp (or glob:pattern), can be repeated")
+	fs.Var(&addedAfter, "added-after", "only archive bookmarks added after the date, e.g. 2024-01-31, or within the duration, e.g. 720h")
+	fs.IntVar(&workers, "workers", 4, "number of paralel downloads")
+	fs.StringVar(&trackingParams, "strip-params", defaultTrackingParams, "comma-separated query parameters to remove from urls before archiving, globs like utm_* work, empty to keep all")
+	fs.Var(&filterLists, "filter-list", "EasyList or uBlock Origin style filter list, a file or a url, don't download requisites of hosts it blocks (wget needs -span-hosts for that); can be repeated")
+	fs.IntVar(&retries, "retries", 2, "how many times to retry a page on network errors, 429 and 5xx")
+	fs.BoolVar(&waybackFallback, "wayback-fallback", false, "archive the latest web.archive.org snapshot of pages that are 404, 410 or whose host is gone")
+	fs.BoolVar(&archiveTodayFallback, "archive-today-fallback", false, "archive the latest archive.today snapshot of pages which turn out to be a paywall teaser")
+	fs.BoolVar(&savePageNow, "save-page-now", false, "ask web.archive.org to snapshot every newly archived page as well")
+	fs.StringVar(&waybackKeys, "wayback-keys", "", "archive.org \"access:secret\" keys for -save-page-now, better set it as UEB_WAYBACK_KEYS")
+	fs.DurationVar(&retryBackoff, "retry-backoff", 5*time.Second, "delay before the first retry, doubles on every next one")
+	fs.DurationVar(&perHostDelay, "per-host-delay", 0, "minimal delay between downloads from the same host, across all workers")
+	fs.IntVar(&perHostWorkers, "per-host-workers", 2, "maximum simultaneous downloads from the same host, 0 for no limit")
+	fs.Var(&limitRate, "limit-rate", "total download bandwidth of all workers as `size` per second, e.g. 2M, 0 for no limit")
+	fs.BoolVar(&ignoreRobots, "ignore-robots", defaultIgnoreRobots, "ignore robots.txt, set it to false to respect robots.txt for requisites and mirrors, the bookmarked page is downloaded anyway, left-out requisites are recorded")
+	fs.DurationVar(&downloadTimeout, "timeout", 10*time.Minute, "kill a bookmark download taking longer than that, 0 for no limit")
+	fs.Var(&maxSize, "max-size", "abort a bookmark capture growing over that `size`, e.g. 200M, 0 for no limit")
+	fs.StringVar(&enabledSteps, "post-steps", defaultSteps, "comma-separated steps to run on new captures, the title and description are always extracted: sanitize (strip trackers from the html), text (a .txt of the page's text for search and grep), summary (needs -summarizer), localize (download fonts and stylesheets wget has missed), audit (list missing requisites), thumbnail (needs chrome) and compress (gzipped copies for serve)")
+	fs.StringVar(&summarizerKind, "summarizer", "", "llm api the summary step asks: ollama, or openai for any OpenAI-compatible one")
+	fs.StringVar(&summarizerURL, "summarizer-url", "", "base `url` of the summarizer api, http://localhost:11434 for ollama and https://api.openai.com/v1 for openai if empty")
+	fs.StringVar(&summarizerModel, "summarizer-model", "", "model to summarize with, llama3.2 for ollama and gpt-4o-mini for openai if empty")
+	fs.StringVar(&summarizerKey, "summarizer-key", "", "api key of the summarizer, better set it as UEB_SUMMARIZER_KEY")
+	fs.StringVar(&beforeDownloadHook, "before-download", "", "shell command run before each download, with UEB_URL, UEB_TITLE, UEB_HASH and UEB_TAGS set; a non-zero exit skips the bookmark")
+	fs.StringVar(&afterCaptureHook, "after-capture", "", "shell command run after each capture, with UEB_CAPTURE_DIR and UEB_META set as well, and the meta.json on stdin")
+	fs.BoolVar(&noProgress, "no-progress", false, "don't show the progress line, it's only shown on a terminal anyway")
+	fs.DurationVar(&refreshAfter, "refresh-after", 0, "keep captures younger than that instead of downloading them again, 0 to always download")
+	fs.BoolVar(&resume, "resume", false, "continue the interrupted run, only download bookmarks it didn't get to")
+	fs.BoolVar(&dryRun, "dry-run", false, "print what would be downloaded or skipped, don't touch the network and the archive")
+}
+
+func indexFlags(fs *flag.FlagSet) {
+	fs.StringVar(&sortBy, "sort", "", "index order: title, date-added, archive-date, size, domain or position in the folder; empty keeps the order of the folder")
+	fs.StringVar(&sortOrder, "order", "asc", "index sort direction: asc or desc")
+	fs.IntVar(&pageSize, "page-size", 500, "split the index into pages of that many entries, 0 to keep a single page")
+	fs.StringVar(&groupBy, "group", "", "group index entries by month, domain or language, empty to disable")
+	fs.IntVar(&feedSize, "feed-size", 50, "number of recent captures in the feed.xml")
+	fs.StringVar(&feedBaseURL, "feed-base-url", "", "URL the archive is served from, feed links point to local files if empty")
+	fs.IntVar(&autoTagCount, "auto-tags", defaultAutoTagCount, "tag captures without tags with that many keywords of their text, 0 to disable")
+	fs.BoolVar(&mergeCanonical, "merge-canonical", false, "show bookmarks of pages with the same canonical url as one entry, instead of linking them to each other")
+}
@@ -0,0 +1,39 @@
+package uebarchive
+
+import (
+	"context"
+	"flag"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"no-such-command"}, 2},
+		{[]string{"archive", "-no-such-flag"}, 2},
+		{[]string{"archive", "-h"}, 0},
+	} {
+		if got := ExitCode(Run(ctx, tc.args)); got != tc.want {
+			t.Errorf("%q: got exit code %d, want %d", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestFlagsStartFromDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	downloadFlags(fs)
+	firefoxFlags(fs)
+	if err := fs.Parse([]string{"-include", "example.com", "-ignore-robots=false", "-browser", "chrome", "-url-file", "urls.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next run sees none of the previous one
+	downloadFlags(flag.NewFlagSet("archive", flag.ContinueOnError))
+	firefoxFlags(flag.NewFlagSet("archive", flag.ContinueOnError))
+	if len(includeURLs) != 0 || len(urlFiles) != 0 || !ignoreRobots || browser != defaultBrowser {
+		t.Errorf("got -include %v, -url-file %v, -ignore-robots %v, -browser %q, want the defaults", includeURLs, urlFiles, ignoreRobots, browser)
+	}
+}
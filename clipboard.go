@@ -0,0 +1,71 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var addClipboard bool
+
+// clipboardURLs returns every http(s) url found in the clipboard text.
+func clipboardURLs(ctx context.Context) ([]string, error) {
+	text, err := readClipboard(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, field := range strings.Fields(text) {
+		// links copied from a text often come in quotes or brackets
+		field = strings.Trim(field, `"'<>()[]{},;`)
+		if u, err := url.Parse(field); err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0 {
+			urls = append(urls, field)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("no urls in the clipboard")
+	}
+	return urls, nil
+}
+
+// readClipboard runs whatever clipboard tool the system has,
+// on linux that's wl-paste under wayland, or xclip or xsel under X.
+func readClipboard(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbpaste"}}
+	case "windows":
+		candidates = [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	default:
+		if len(os.Getenv("WAYLAND_DISPLAY")) > 0 {
+			candidates = append(candidates, []string{"wl-paste", "--no-newline"})
+		}
+		candidates = append(candidates,
+			[]string{"xclip", "-selection", "clipboard", "-out"},
+			[]string{"xsel", "--clipboard", "--output"},
+		)
+	}
+
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("read clipboard with %s: %w", args[0], err)
+		}
+		return string(out), nil
+	}
+	return "", errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+}
@@ -0,0 +1,10 @@
+// Command ueb-archive archives bookmarks, see ueb-archive help. Install it with
+//
+//	go install github.com/nikonov1101/ueb-archive/cmd/ueb-archive@latest
+package main
+
+import uebarchive "github.com/nikonov1101/ueb-archive"
+
+func main() {
+	uebarchive.Main()
+}
@@ -0,0 +1,153 @@
+package uebarchive
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// configFile is kept around for sections that don't map to flags,
+// nil if there is no config.
+var configFile *ini.File
+
+// defaultConfigPath is ~/.config/ueb-archive/config.ini on linux.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(dir, "ueb-archive", "config.ini")
+}
+
+// configPathFromArgs finds the -config value (or $UEB_CONFIG) before the flags
+// are parsed, we need the file to set defaults for the rest of the flags.
+func configPathFromArgs(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+
+	if fileName, ok := os.LookupEnv("UEB_CONFIG"); ok {
+		return fileName, true
+	}
+	return defaultConfigPath(), false
+}
+
+// applyConfig sets flag values from the config file, so anything
+// given on the command line overrides them. Keys on the top of the file
+// apply to every command having such flag, keys in a [command] section
+// apply only to that command.
+//
+//	archive = /home/me/archive
+//
+//	[archive]
+//	workers = 8
+//	folder = read later
+//	exclude = youtube\.com
+//	exclude = reddit\.com
+func applyConfig(fs *flag.FlagSet, cmdName, fileName string, explicit bool) error {
+	if len(fileName) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(fileName); err != nil && !explicit {
+		// no config is fine, unless asked for it
+		return nil
+	}
+
+	// shadows let repeatable flags be repeated in the config too
+	cfg, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, fileName)
+	if err != nil {
+		return fmt.Errorf("read config from %s: %w", fileName, err)
+	}
+	configFile = cfg
+
+	for _, key := range cfg.Section(ini.DefaultSection).Keys() {
+		if fs.Lookup(key.Name()) == nil {
+			continue
+		}
+		if err := setFromConfig(fs, key); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.HasSection(cmdName) {
+		return nil
+	}
+	for _, key := range cfg.Section(cmdName).Keys() {
+		if fs.Lookup(key.Name()) == nil {
+			slog.Warn("config: unknown option", "option", key.Name(), "section", cmdName)
+			continue
+		}
+		if err := setFromConfig(fs, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFromConfig(fs *flag.FlagSet, key *ini.Key) error {
+	for _, value := range key.ValueWithShadows() {
+		if err := fs.Set(key.Name(), value); err != nil {
+			return fmt.Errorf("config: set %s: %w", key.Name(), err)
+		}
+	}
+	return nil
+}
+
+// envAliases are friendlier names for the flags which names
+// don't read well as environment variables.
+var envAliases = map[string]string{
+	"UEB_ARCHIVE_ROOT": "archive",
+	"UEB_PROFILE":      "profile-name",
+}
+
+// envName turns a flag name into UEB_FLAG_NAME.
+func envName(flagName string) string {
+	return "UEB_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets flag values from UEB_* environment variables,
+// it goes after the config file and before the command line.
+func applyEnv(fs *flag.FlagSet) error {
+	set := func(name, env string) error {
+		value, ok := os.LookupEnv(env)
+		if !ok || fs.Lookup(name) == nil {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("set %s from $%s: %w", name, env, err)
+		}
+		return nil
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err == nil {
+			err = set(f.Name, envName(f.Name))
+		}
+	})
+	for env, name := range envAliases {
+		if err == nil {
+			err = set(name, env)
+		}
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package uebarchive
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	useCookies bool
+	// cookiesFile is a netscape cookies.txt exported from firefox, passed to wget.
+	cookiesFile string
+	// pageCookies are cookies.txt files of pages sent to archive right now,
+	// by url, they take precedence over the cookiesFile.
+	pageCookies sync.Map
+)
+
+// credentialHeaders are -header names which log the request in, see withCredentials.
+var credentialHeaders = []string{"authorization", "proxy-authorization", "cookie", "token", "api-key", "session"}
+
+// withCredentials says if the bookmark is fetched as someone: with cookies, an auth
+// header, or a user in the url, so the capture may have what is not public.
+func withCredentials(bmark bookmark) bool {
+	if len(bookmarkCookies(bmark)) > 0 {
+		return true
+	}
+	if u, err := url.Parse(bmark.url); err == nil && u.User != nil {
+		return true
+	}
+	for _, h := range bmark.fetch.headers {
+		name, _, _ := strings.Cut(h, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.ContainsFunc(credentialHeaders, func(c string) bool { return strings.Contains(name, c) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// bookmarkCookies is the cookies.txt to fetch the bookmark with, if any.
+func bookmarkCookies(bmark bookmark) string {
+	if bmark.fetch.noCookies {
+		return ""
+	}
+	if f, ok := pageCookies.Load(bmark.url); ok {
+		return f.(string)
+	}
+	return cookiesFile
+}
+
+// cookieJar reads a cookies.txt, as exportCookies writes it, for requests
+// made by us rather than by wget.
+func cookieJar(file string) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	cookies, err := readCookies(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range cookies {
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		if !strings.HasPrefix(cookie.Domain, ".") {
+			// a host-only one
+			cookie.Domain = ""
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cookie.Path}, []*http.Cookie{cookie})
+	}
+	return jar, nil
+}
+
+// readCookies reads a cookies.txt, as exportCookies writes it, the domain
+// of a cookie is as in the file: with a leading dot unless it's host-only.
+func readCookies(file string) ([]*http.Cookie, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("read cookies: %w", err)
+	}
+	defer f.Close()
+
+	var cookies []*http.Cookie
+	lscan := bufio.NewScanner(f)
+	for lscan.Scan() {
+		line, httpOnly := strings.CutPrefix(lscan.Text(), "#HttpOnly_")
+		fields := strings.Split(line, "\t")
+		if strings.HasPrefix(line, "#") || len(fields) != 7 {
+			continue
+		}
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   fields[3] == "TRUE",
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expiry, _ := strconv.ParseInt(fields[4], 10, 64); expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := lscan.Err(); err != nil {
+		return nil, fmt.Errorf("read cookies: %w", err)
+	}
+	return cookies, nil
+}
+
+// exportCookies writes cookies from firefox's cookies.sqlite into a temporary
+// cookies.txt only we can read. The caller must remove it after the run.
+// It's not in the archive root on purpose, the archive may be served.
+func exportCookies(dbPath string) (string, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?immutable=1", dbPath))
+	if err != nil {
+		return "", fmt.Errorf("open cookies database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`select host, path, isSecure, expiry, name, value from moz_cookies`)
+	if err != nil {
+		return "", fmt.Errorf("query moz_cookies: %w", err)
+	}
+	defer rows.Close()
+
+	f, err := os.CreateTemp("", "ueb-archive-cookies-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("create cookies file: %w", err)
+	}
+	defer f.Close()
+
+	fail := func(msg string, err error) (string, error) {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("%s: %w", msg, err)
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Netscape HTTP Cookie File")
+
+	count := 0
+	for rows.Next() {
+		var host, cpath, name, value string
+		var secure bool
+		var expiry int64
+		if err := rows.Scan(&host, &cpath, &secure, &expiry, &name, &value); err != nil {
+			return fail("query cookie row", err)
+		}
+
+		// newer firefox versions keep the expiry in milliseconds
+		if expiry > 1e11 {
+			expiry /= 1000
+		}
+
+		// leading dot means the cookie is valid for subdomains too
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			host, boolTRUE(strings.HasPrefix(host, ".")), cpath, boolTRUE(secure), expiry, name, value)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fail("query moz_cookies", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fail("write cookies file", err)
+	}
+
+	slog.Info("exported firefox cookies", "count", count)
+	return f.Name(), nil
+}
+
+// writeBrowserCookies writes cookies sent by the browser extension
+// into a temporary cookies.txt, the caller must remove it.
+func writeBrowserCookies(cookies []browserCookie) (string, error) {
+	f, err := os.CreateTemp("", "ueb-archive-cookies-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("create cookies file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Netscape HTTP Cookie File")
+	for _, c := range cookies {
+		domain := c.Domain
+		if !c.HostOnly && !strings.HasPrefix(domain, ".") {
+			domain = "." + domain
+		}
+		// no expiration date means a session cookie, that's 0 in cookies.txt
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, boolTRUE(!c.HostOnly), c.Path, boolTRUE(c.Secure), int64(c.ExpirationDate), c.Name, c.Value)
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("write cookies file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+func boolTRUE(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,164 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+var every string
+
+func daemonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&every, "every", "", "run schedule: an interval like 6h, or a cron spec like \"0 3 * * *\"")
+	fs.StringVar(&serveAddr, "addr", "localhost:8080", "serve the archive on that address, empty to disable")
+	fs.StringVar(&queueToken, "queue-token", "", "`token` to queue pages with over http, as \"Authorization: Bearer <token>\", the grpc api wants it in the \"authorization\" metadata; queueing is disabled if empty")
+	fs.StringVar(&grpcAddr, "grpc-addr", "", "serve the grpc api on that address, see archive.proto, empty to disable")
+	fs.DurationVar(&checkLinksEvery, "check-links-every", 0, "re-check original urls that often and flag dead or changed ones in the index, 0 to disable")
+
+	// a daemon shouldn't download everything all over again every few hours
+	f := fs.Lookup("refresh-after")
+	f.DefValue = (30 * 24 * time.Hour).String()
+	f.Value.Set(f.DefValue)
+}
+
+// runDaemon runs the archive on schedule and serves it in between, until interrupted.
+// Pages sent to the /queue are archived right away, without waiting for the schedule.
+func runDaemon(ctx context.Context, args []string) error {
+	if len(every) == 0 {
+		return errors.New("-every is required")
+	}
+	sched, err := parseSchedule(every)
+	if err != nil {
+		return fmt.Errorf("parse -every: %w", err)
+	}
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan queueRequest, 100)
+	served := make(chan error, 2)
+	if len(serveAddr) > 0 {
+		if len(queueToken) == 0 {
+			slog.Info("no -queue-token, pages can't be queued over http")
+		}
+		go func() {
+			served <- serve(ctx, serveAddr, archiveMux(queue))
+			// no point to keep archiving if we can't serve it
+			cancel()
+		}()
+	}
+	if len(grpcAddr) > 0 {
+		if len(queueToken) == 0 {
+			slog.Info("no -queue-token, pages can't be queued over grpc")
+		}
+		go func() {
+			served <- serveGRPC(ctx, grpcAddr, queue)
+			cancel()
+		}()
+	}
+
+	// a nil channel never fires, so no checks unless asked for
+	var checkLinks <-chan time.Time
+	if checkLinksEvery > 0 {
+		ticker := time.NewTicker(checkLinksEvery)
+		defer ticker.Stop()
+		checkLinks = ticker.C
+	}
+
+	markProgress()
+	go sdWatchdog(ctx)
+	sdNotify("READY=1")
+	defer sdNotify("STOPPING=1")
+
+	for {
+		started := time.Now()
+		sdNotify("STATUS=archiving")
+		reportRun(ctx, runArchive(ctx, args))
+
+		next := sched.next(started)
+		if now := time.Now(); next.Before(now) {
+			// the run took longer than the interval
+			next = sched.next(now)
+		}
+		slog.Info("next run", "at", next.Format(time.DateTime))
+		sdNotify("STATUS=next run at " + next.Format(time.DateTime))
+		if err := waitQueue(ctx, next, queue, checkLinks, order); err != nil {
+			break
+		}
+	}
+
+	select {
+	case err := <-served:
+		return err
+	default:
+		return nil
+	}
+}
+
+// reportRun logs why the run failed, unless it was interrupted.
+func reportRun(ctx context.Context, err error) {
+	var code exitCode
+	switch {
+	case ctx.Err() != nil:
+	case errors.As(err, &code):
+		// failures are reported by the run itself
+	case err != nil:
+		slog.Error("archive run failed", "err", err)
+	}
+}
+
+// waitQueue archives pages from the queue and checks links when it's time to,
+// until it's time for the next run.
+func waitQueue(ctx context.Context, until time.Time, queue <-chan queueRequest, checkLinks <-chan time.Time, order func(a, b bookmark) int) error {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	// waiting is progress too, for the watchdog
+	alive := time.NewTicker(time.Minute)
+	defer alive.Stop()
+
+	for {
+		markProgress()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-alive.C:
+		case <-checkLinks:
+			if err := monitorLinks(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("link check failed", "err", err)
+			}
+		case req := <-queue:
+			reportRun(ctx, archiveNow(ctx, req, order))
+		}
+	}
+}
+
+// archiveNow archives the queued page (it's an added bookmark already),
+// even if there is a fresh capture of it.
+func archiveNow(ctx context.Context, req queueRequest, order func(a, b bookmark) int) error {
+	bmark := newBookmark(req.URL, req.Title)
+	slog.Info("archiving the page now", "url", bmark.url)
+
+	if len(req.Cookies) > 0 {
+		cookies, err := writeBrowserCookies(req.Cookies)
+		if err != nil {
+			return err
+		}
+		pageCookies.Store(bmark.url, cookies)
+		defer func() {
+			pageCookies.Delete(bmark.url)
+			os.Remove(cookies)
+		}()
+	}
+
+	return archiveNew(ctx, order, map[string]bool{bmark.url: true})
+}
@@ -0,0 +1,107 @@
+package uebarchive
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// normalizeURL is the url reduced to what tells pages apart: http and https,
+// www. or not, a trailing slash, default ports, fragments and the order
+// of query parameters all lead to the same page as far as we are concerned.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || len(u.Host) == 0 {
+		return rawURL
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "https" {
+		scheme = "http"
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); len(port) > 0 && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	key := scheme + "://" + host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if len(u.RawQuery) > 0 {
+		params := strings.Split(u.RawQuery, "&")
+		slices.Sort(params)
+		key += "?" + strings.Join(params, "&")
+	}
+	return key
+}
+
+// dedupeBookmarks leaves one bookmark of those leading to the same page,
+// the https one, or else the oldest, with the other urls as its aliases,
+// and the title of another one if it has none. The list order is kept.
+// Hashes of the others are kept as merged, as mergeSamePage does, their
+// captures of earlier runs stay.
+// Tracking parameters are stripped first, see stripTrackingParams.
+func dedupeBookmarks(list []bookmark) []bookmark {
+	stripTrackingParams(list)
+
+	kept := make(map[string]int, len(list))
+	out := make([]bookmark, 0, len(list))
+	for _, bmark := range list {
+		key := normalizeURL(bmark.url)
+		i, ok := kept[key]
+		if !ok {
+			kept[key] = len(out)
+			out = append(out, bmark)
+			continue
+		}
+
+		first := &out[i]
+		slog.Debug("duplicate bookmark", "url", bmark.url, "same_as", first.url)
+		if preferBookmark(bmark, *first) {
+			bmark, *first = *first, bmark
+		}
+		if len(first.title) == 0 {
+			first.title = bmark.title
+		}
+		if !bmark.dateAdded.IsZero() && bmark.dateAdded.Before(first.dateAdded) {
+			first.dateAdded = bmark.dateAdded
+		}
+		for _, tag := range bmark.tags {
+			if !slices.Contains(first.tags, tag) {
+				first.tags = append(first.tags, tag)
+			}
+		}
+		for _, alias := range append(bmark.aliases, bmark.url) {
+			if alias != first.url && !slices.Contains(first.aliases, alias) {
+				first.aliases = append(first.aliases, alias)
+			}
+		}
+		for _, hash := range append(bmark.merged, bmark.hash) {
+			if hash != first.hash && !slices.Contains(first.merged, hash) {
+				first.merged = append(first.merged, hash)
+			}
+		}
+	}
+	return out
+}
+
+// againAliases replaces urls in again which are aliases of the deduplicated bookmarks
+// with the bookmarks' urls, since that's what is going to be downloaded.
+func againAliases(list []bookmark, again map[string]bool) {
+	for _, bmark := range list {
+		for _, alias := range bmark.aliases {
+			if again[alias] {
+				delete(again, alias)
+				again[bmark.url] = true
+			}
+		}
+	}
+}
+
+// preferBookmark tells if a is a better one to download than b of the two duplicates.
+func preferBookmark(a, b bookmark) bool {
+	aSecure, bSecure := strings.HasPrefix(a.url, "https:"), strings.HasPrefix(b.url, "https:")
+	if aSecure != bSecure {
+		return aSecure
+	}
+	return a.dateAdded.Before(b.dateAdded)
+}
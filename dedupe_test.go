@@ -0,0 +1,36 @@
+package uebarchive
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDedupeBookmarks(t *testing.T) {
+	old := newBookmark("http://www.example.com/page/", "old")
+	old.dateAdded = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	secure := newBookmark("https://example.com/page", "")
+	other := newBookmark("https://example.com/other", "other")
+
+	list := dedupeBookmarks([]bookmark{old, secure, other})
+	if len(list) != 2 {
+		t.Fatalf("got %d bookmarks, want 2: %+v", len(list), list)
+	}
+	kept := list[0]
+	if kept.url != secure.url {
+		t.Errorf("kept %s, want the https one", kept.url)
+	}
+	if kept.title != "old" || !kept.dateAdded.Equal(old.dateAdded) {
+		t.Errorf("got title %q, added %s, want those of the other one", kept.title, kept.dateAdded)
+	}
+	if !slices.Equal(kept.aliases, []string{old.url}) {
+		t.Errorf("got aliases %v", kept.aliases)
+	}
+	// or prune would remove the capture of the http one
+	if !slices.Equal(kept.merged, []int64{old.hash}) {
+		t.Errorf("got merged %v, want %v", kept.merged, []int64{old.hash})
+	}
+	if list[1].url != other.url || len(list[1].merged) > 0 {
+		t.Errorf("the other page is changed: %+v", list[1])
+	}
+}
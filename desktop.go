@@ -0,0 +1,45 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	desktopNotify         bool
+	desktopNotifyFailures int
+)
+
+// desktopNotification shows the summary with notify-send, or osascript on macOS.
+func desktopNotification(ctx context.Context, summary runSummary) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	title := "ueb-archive"
+	body := fmt.Sprintf("archived %d of %d bookmarks in %s", summary.Archived, summary.Total, summary.Duration)
+	if summary.Failed > 0 {
+		body += fmt.Sprintf(", %d failed", summary.Failed)
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+		script := fmt.Sprintf(`display notification "%s" with title "%s"`, quote(body), quote(title))
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	} else {
+		urgency := "normal"
+		if summary.Failed > 0 {
+			urgency = "critical"
+		}
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name", title, "--urgency", urgency, title, body)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
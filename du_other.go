@@ -0,0 +1,9 @@
+//go:build !unix
+
+package uebarchive
+
+import "os"
+
+func fileDiskUsage(info os.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package uebarchive
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileDiskUsage is what the file takes on the disk, in whole blocks.
+func fileDiskUsage(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return info.Size()
+}
@@ -0,0 +1,254 @@
+package uebarchive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+// exportEPUB writes a book per archived article into out, or, with -digest,
+// a single one of the articles archived in the last -digest, oldest first.
+// The text only, e-readers have little use for the pages' images and styles.
+func exportEPUB(ctx context.Context, entries []store.Entry, out string) error {
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", out, err)
+	}
+
+	now := time.Now()
+	var chapters []article
+	var archived []time.Time
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bmark := entryBookmark(entry)
+		if bmark.archiveMeta == nil || exportDigest > 0 && now.Sub(bmark.archiveMeta.archivedAt) > exportDigest {
+			continue
+		}
+		chapter, ok, err := readArticle(bmark)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if exportDigest > 0 {
+			chapters = append(chapters, chapter)
+			archived = append(archived, bmark.archiveMeta.archivedAt)
+			continue
+		}
+
+		name := uniqueSlug(seen, chapter.title, bmark.hash)
+		id := fmt.Sprintf("urn:ueb-archive:%d", bmark.hash)
+		if err := writeEPUB(path.Join(out, name+".epub"), id, chapter.title, chapter.author, []article{chapter}, now); err != nil {
+			return err
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	if exportDigest == 0 || len(chapters) == 0 {
+		slog.Info("exported", "format", "epub", "articles", len(chapters), "out", out)
+		return nil
+	}
+
+	order := make([]int, len(chapters))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return archived[a].Compare(archived[b]) })
+	digest := make([]article, 0, len(chapters))
+	for _, i := range order {
+		digest = append(digest, chapters[i])
+	}
+
+	const dateFormat = "Jan 2, 2006"
+	title := fmt.Sprintf("Archive digest, %s – %s", archived[order[0]].Format(dateFormat), now.Format(dateFormat))
+	name := path.Join(out, "digest-"+now.Format("2006-01-02")+".epub")
+	id := fmt.Sprintf("urn:ueb-archive:digest:%d", now.Unix())
+	if err := writeEPUB(name, id, title, "", digest, now); err != nil {
+		return err
+	}
+	slog.Info("exported", "format", "epub", "digest", name, "articles", len(digest))
+	return nil
+}
+
+// writeEPUB writes an EPUB 3 book, with an NCX table of contents too,
+// for the readers which only know EPUB 2.
+func writeEPUB(name, id, title, author string, chapters []article, modified time.Time) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create epub: %w", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	// the mimetype must be the first one, and not compressed
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err == nil {
+		_, err = w.Write([]byte("application/epub+zip"))
+	}
+	if err != nil {
+		return fmt.Errorf("write epub: %w", err)
+	}
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="utf-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>
+`},
+		{"OEBPS/content.opf", epubPackage(id, title, author, chapters, modified)},
+		{"OEBPS/nav.xhtml", epubNav(title, chapters)},
+		{"OEBPS/toc.ncx", epubNCX(id, title, chapters)},
+	}
+	for i, chapter := range chapters {
+		files = append(files, struct{ name, content string }{fmt.Sprintf("OEBPS/c%d.xhtml", i+1), articlePage(chapter)})
+	}
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err == nil {
+			_, err = w.Write([]byte(file.content))
+		}
+		if err != nil {
+			return fmt.Errorf("write epub: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("write epub: %w", err)
+	}
+	return f.Close()
+}
+
+func epubPackage(id, title, author string, chapters []article, modified time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&sb, "<dc:identifier id=\"id\">%s</dc:identifier>\n", xmlText(id))
+	fmt.Fprintf(&sb, "<dc:title>%s</dc:title>\n", xmlText(title))
+	// we don't know it, and it's required
+	sb.WriteString("<dc:language>en</dc:language>\n")
+	if len(author) > 0 {
+		fmt.Fprintf(&sb, "<dc:creator>%s</dc:creator>\n", xmlText(author))
+	}
+	if len(chapters) == 1 {
+		fmt.Fprintf(&sb, "<dc:source>%s</dc:source>\n", xmlText(chapters[0].url))
+	}
+	fmt.Fprintf(&sb, "<meta property=\"dcterms:modified\">%s</meta>\n", modified.UTC().Format("2006-01-02T15:04:05Z"))
+	sb.WriteString(`</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+`)
+	for i := range chapters {
+		fmt.Fprintf(&sb, "<item id=\"c%d\" href=\"c%d.xhtml\" media-type=\"application/xhtml+xml\"/>\n", i+1, i+1)
+	}
+	sb.WriteString("</manifest>\n<spine toc=\"ncx\">\n")
+	for i := range chapters {
+		fmt.Fprintf(&sb, "<itemref idref=\"c%d\"/>\n", i+1)
+	}
+	sb.WriteString("</spine>\n</package>\n")
+	return sb.String()
+}
+
+func epubNav(title string, chapters []article) string {
+	var sb strings.Builder
+	sb.WriteString(epubPageHead(title))
+	sb.WriteString("<nav epub:type=\"toc\"><h1>Contents</h1><ol>\n")
+	for i, chapter := range chapters {
+		fmt.Fprintf(&sb, "<li><a href=\"c%d.xhtml\">%s</a></li>\n", i+1, xmlText(chapter.title))
+	}
+	sb.WriteString("</ol></nav>\n</body></html>\n")
+	return sb.String()
+}
+
+func epubNCX(id, title string, chapters []article) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+`)
+	fmt.Fprintf(&sb, "<head><meta name=\"dtb:uid\" content=\"%s\"/></head>\n", xmlText(id))
+	fmt.Fprintf(&sb, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", xmlText(title))
+	for i, chapter := range chapters {
+		fmt.Fprintf(&sb, "<navPoint id=\"n%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"c%d.xhtml\"/></navPoint>\n",
+			i+1, i+1, xmlText(chapter.title), i+1)
+	}
+	sb.WriteString("</navMap>\n</ncx>\n")
+	return sb.String()
+}
+
+// articlePage renders the article, its own headings a level down
+// from the title's one.
+func articlePage(chapter article) string {
+	var sb strings.Builder
+	sb.WriteString(epubPageHead(chapter.title))
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n", xmlText(chapter.title))
+	var byline []string
+	if len(chapter.author) > 0 {
+		byline = append(byline, xmlText(chapter.author))
+	}
+	if !chapter.published.IsZero() {
+		byline = append(byline, chapter.published.Format("Jan 2, 2006"))
+	}
+	if len(byline) > 0 {
+		fmt.Fprintf(&sb, "<p><em>%s</em></p>\n", strings.Join(byline, ", "))
+	}
+	fmt.Fprintf(&sb, "<p><a href=\"%s\">%s</a></p>\n", xmlText(chapter.url), xmlText(chapter.url))
+
+	list := false
+	for i, block := range chapter.blocks {
+		if block.tag == "li" && !list {
+			sb.WriteString("<ul>\n")
+			list = true
+		} else if block.tag != "li" && list {
+			sb.WriteString("</ul>\n")
+			list = false
+		}
+
+		tag := block.tag
+		if len(tag) == 2 && tag[0] == 'h' {
+			if i == 0 && block.text == chapter.title {
+				// it's there already
+				continue
+			}
+			tag = fmt.Sprintf("h%d", min(int(tag[1]-'0')+1, 6))
+		}
+		text := xmlText(block.text)
+		if tag == "blockquote" {
+			text = "<p>" + text + "</p>"
+		}
+		fmt.Fprintf(&sb, "<%s>%s</%s>\n", tag, text, tag)
+	}
+	if list {
+		sb.WriteString("</ul>\n")
+	}
+	sb.WriteString("</body></html>\n")
+	return sb.String()
+}
+
+func epubPageHead(title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><meta charset="utf-8"/><title>%s</title></head>
+<body>
+`, xmlText(title))
+}
+
+// xmlText escapes the text for xml, characters xml doesn't allow are replaced.
+func xmlText(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
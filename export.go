@@ -0,0 +1,185 @@
+package uebarchive
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var (
+	exportFormat string
+	exportDir    string
+	exportDigest time.Duration
+)
+
+func exportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&exportFormat, "format", "archivebox", "export format: archivebox, epub for e-readers, or markdown for note-taking apps")
+	fs.StringVar(&exportDir, "out", "", "`directory` to export into")
+	fs.DurationVar(&exportDigest, "digest", 0, "with -format epub, a single book of the articles archived in the last `duration`, instead of a book per article")
+}
+
+func runExport(ctx context.Context, _ []string) error {
+	if len(exportDir) == 0 {
+		return errors.New("-out is required")
+	}
+	export, ok := map[string]func(context.Context, []store.Entry, string) error{
+		"archivebox": exportArchiveBox,
+		"epub":       exportEPUB,
+		"markdown":   exportMarkdown,
+	}[exportFormat]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", exportFormat)
+	}
+
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	return export(ctx, entries, exportDir)
+}
+
+// archiveBoxLink is the snapshot's index.json, ArchiveBox calls it a Link.
+type archiveBoxLink struct {
+	URL            string                               `json:"url"`
+	Timestamp      string                               `json:"timestamp"`
+	Title          string                               `json:"title,omitempty"`
+	Sources        []string                             `json:"sources"`
+	BookmarkedDate string                               `json:"bookmarked_date"`
+	Updated        string                               `json:"updated,omitempty"`
+	History        map[string][]archiveBoxArchiveResult `json:"history"`
+	Schema         string                               `json:"schema"`
+}
+
+type archiveBoxArchiveResult struct {
+	Cmd     []string `json:"cmd"`
+	Pwd     string   `json:"pwd"`
+	Output  string   `json:"output"`
+	Status  string   `json:"status"`
+	StartTS string   `json:"start_ts"`
+	EndTS   string   `json:"end_ts"`
+	Schema  string   `json:"schema"`
+}
+
+// archiveBoxMainIndex is the legacy json main index,
+// newer versions keep it in sqlite, but still read the snapshot folders.
+type archiveBoxMainIndex struct {
+	Info  string           `json:"info"`
+	Links []archiveBoxLink `json:"links"`
+}
+
+// exportArchiveBox writes snapshot folders the way ArchiveBox lays them out:
+// archive/<timestamp>/index.json plus the wget output under the host directory,
+// "archivebox init" in the out directory picks them up as orphaned snapshots.
+func exportArchiveBox(ctx context.Context, entries []store.Entry, out string) error {
+	const dateFormat = "2006-01-02 15:04"
+
+	index := archiveBoxMainIndex{Info: "exported by ueb-archive"}
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		added := entry.DateAdded
+		if added.IsZero() {
+			added = entry.ArchivedAt
+		}
+		// timestamps are snapshot ids, archivebox itself dedupes them with a suffix
+		ts := fmt.Sprint(added.Unix())
+		if n := seen[ts]; n > 0 {
+			seen[ts]++
+			ts = fmt.Sprintf("%s.%d", ts, n)
+		} else {
+			seen[ts] = 1
+		}
+
+		link := archiveBoxLink{
+			URL:            entry.URL,
+			Timestamp:      ts,
+			Title:          cmp.Or(entry.Title, entry.PageTitle),
+			Sources:        []string{"ueb-archive"},
+			BookmarkedDate: added.UTC().Format(dateFormat),
+			History:        map[string][]archiveBoxArchiveResult{},
+			Schema:         "Link",
+		}
+
+		dir := path.Join(out, "archive", ts)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create snapshot dir: %w", err)
+		}
+		if entry.Status == "OK" {
+			result, err := exportArchiveBoxCapture(entry, dir)
+			if err != nil {
+				return err
+			}
+			link.Updated = entry.ArchivedAt.UTC().Format(dateFormat)
+			link.History["wget"] = []archiveBoxArchiveResult{result}
+		}
+
+		if err := writeJSONFile(path.Join(dir, "index.json"), link); err != nil {
+			return err
+		}
+		index.Links = append(index.Links, link)
+	}
+
+	if err := writeJSONFile(path.Join(out, "index.json"), index); err != nil {
+		return err
+	}
+	slog.Info("exported", "format", "archivebox", "snapshots", len(index.Links), "out", out)
+	return nil
+}
+
+// exportArchiveBoxCapture copies captured files into the snapshot dir,
+// wget output in archivebox is relative to the snapshot, so is ours to the capture dir.
+func exportArchiveBoxCapture(entry store.Entry, dir string) (archiveBoxArchiveResult, error) {
+	captureDir := bookmark{hash: entry.Hash}.captureDir() + "/"
+	for _, file := range entry.Files {
+		rel, ok := strings.CutPrefix(file, captureDir)
+		if !ok {
+			continue
+		}
+		to := path.Join(dir, rel)
+		if err := os.MkdirAll(path.Dir(to), 0o755); err != nil {
+			return archiveBoxArchiveResult{}, fmt.Errorf("create snapshot dir: %w", err)
+		}
+		// hard links are free, copy only across filesystems; post-processing
+		// replaces the capture's files rather than rewrites them, see replaceFile
+		if err := os.Link(path.Join(archiveRoot, file), to); err != nil && !errors.Is(err, os.ErrExist) {
+			if err := copyFile(path.Join(archiveRoot, file), to); err != nil {
+				return archiveBoxArchiveResult{}, fmt.Errorf("copy captured file: %w", err)
+			}
+		}
+	}
+
+	fetchTime, _ := time.ParseDuration(entry.FetchTime)
+	return archiveBoxArchiveResult{
+		Cmd:     []string{"wget", entry.URL},
+		Pwd:     dir,
+		Output:  strings.TrimPrefix(entry.Path, captureDir),
+		Status:  "succeeded",
+		StartTS: entry.ArchivedAt.Add(-fetchTime).Format(time.RFC3339),
+		EndTS:   entry.ArchivedAt.Format(time.RFC3339),
+		Schema:  "ArchiveResult",
+	}, nil
+}
+
+func writeJSONFile(name string, v any) error {
+	bs, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", path.Base(name), err)
+	}
+	if err := os.WriteFile(name, bs, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
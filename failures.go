@@ -0,0 +1,91 @@
+package uebarchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+// how many lines of the wget log to keep in the report,
+// the reason is usually somewhere at the very end.
+const failureLogTail = 20
+
+type failureEntry struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Attempts int    `json:"attempts"`
+	Logfile  string `json:"logfile"`
+	LogTail  string `json:"log_tail"`
+}
+
+// makeFailureReport writes failures.html and failures.json
+// listing every bookmark failed to archive, along with its wget log excerpt,
+// skipped ones are not failures, failed refreshes of a kept capture are.
+func makeFailureReport(list []bookmark) error {
+	failures := make([]failureEntry, 0)
+	for _, bmark := range list {
+		if bmark.archiveMeta != nil && !bmark.refreshFailed() || bmark.skipped() {
+			continue
+		}
+
+		failures = append(failures, failureEntry{
+			Title:    bmark.title,
+			URL:      bmark.url,
+			Error:    bmark.failure,
+			ExitCode: bmark.exitCode,
+			Attempts: bmark.attempts,
+			Logfile:  bmark.logfile(),
+			LogTail:  tailFile(bmark.logfile(), failureLogTail),
+		})
+	}
+
+	bs, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal failures: %w", err)
+	}
+	if err := os.WriteFile(path.Join(archiveRoot, "failures.json"), bs, 0o600); err != nil {
+		return fmt.Errorf("write failures json: %w", err)
+	}
+
+	page := `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>μeb-archive failures</title></head><body><h1>μeb-archive failures</h1>`
+	page += fmt.Sprintf(`<p><a href="index.html">back to index</a> | %d failed</p>`, len(failures))
+	for _, f := range failures {
+		if index.IsWebURL(f.URL) {
+			page += fmt.Sprintf(`<h2><a href="%s">%s</a></h2>`, html.EscapeString(f.URL), html.EscapeString(f.URL))
+		} else {
+			page += fmt.Sprintf(`<h2>%s</h2>`, html.EscapeString(f.URL))
+		}
+		page += fmt.Sprintf("<p>%s, exit code %d, %d attempts, log: %s</p>",
+			html.EscapeString(f.Error), f.ExitCode, f.Attempts, html.EscapeString(f.Logfile))
+		page += fmt.Sprintf("<pre>%s</pre>", html.EscapeString(f.LogTail))
+	}
+	page += "</body></html>"
+
+	if err := os.WriteFile(path.Join(archiveRoot, "failures.html"), []byte(page), 0o600); err != nil {
+		return fmt.Errorf("write failures page: %w", err)
+	}
+
+	return nil
+}
+
+// tailFile returns up to n last lines of a file,
+// an empty string if it can't be read.
+func tailFile(name string, n int) string {
+	bs, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(strings.TrimRight(string(bs), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
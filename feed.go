@@ -0,0 +1,106 @@
+package uebarchive
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary,omitempty"`
+	// Published is read from the -feed feeds, ours don't have it
+	Published string `xml:"published,omitempty"`
+}
+
+// makeFeed writes the feed.xml with the most recent captures,
+// so the archive could be followed from a feed reader.
+func makeFeed(list []bookmark) error {
+	var recent []bookmark
+	for _, bmark := range list {
+		if bmark.archiveMeta != nil {
+			recent = append(recent, bmark)
+		}
+	}
+	slices.SortStableFunc(recent, func(a, b bookmark) int {
+		return b.archiveMeta.archivedAt.Compare(a.archiveMeta.archivedAt)
+	})
+	if len(recent) > feedSize {
+		recent = recent[:feedSize]
+	}
+
+	feed := atomFeed{
+		ID:      "urn:ueb-archive:" + archiveLink("index.html"),
+		Title:   "μeb-archive",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: archiveLink("index.html")},
+	}
+	for _, bmark := range recent {
+		index, ok := bmark.captured()
+		if !ok {
+			continue
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			// url hash stays the same between runs, so readers won't show the same page twice
+			ID:      fmt.Sprintf("urn:ueb-archive:%d", bmark.hash),
+			Title:   bmark.displayTitle(),
+			Updated: bmark.archiveMeta.archivedAt.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: archiveLink(index)},
+				{Href: bmark.url, Rel: "via"},
+			},
+			Summary: bmark.url,
+		})
+	}
+
+	bs, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal feed: %w", err)
+	}
+	bs = append([]byte(xml.Header), bs...)
+
+	if err := os.WriteFile(path.Join(archiveRoot, "feed.xml"), bs, 0o600); err != nil {
+		return fmt.Errorf("write feed file: %w", err)
+	}
+
+	return nil
+}
+
+// archiveLink turns a path relative to the archive root into an absolute URL,
+// either under the -feed-base-url, or to the local file.
+func archiveLink(rel string) string {
+	if len(feedBaseURL) > 0 {
+		return strings.TrimSuffix(feedBaseURL, "/") + "/" + index.FileHref(rel)
+	}
+
+	abs, err := filepath.Abs(path.Join(archiveRoot, rel))
+	if err != nil {
+		abs = path.Join(archiveRoot, rel)
+	}
+	return (&url.URL{Scheme: "file", Path: abs}).String()
+}
@@ -0,0 +1,179 @@
+package uebarchive
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// feeds are -feed urls of RSS and Atom feeds, and OPML lists of them,
+// new entries of the feeds are archived as added bookmarks.
+var feeds listFlag
+
+// feeds are small, a bigger one is not a feed
+const maxFeedSize = 16 << 20
+
+// feedDoc is an RSS 2.0, RSS 1.0, Atom or OPML document,
+// whichever it is, the rest of the fields stay empty.
+type feedDoc struct {
+	XMLName xml.Name
+	// rss 2.0 has items in the channel, rss 1.0 next to it
+	Items    []feedItem `xml:"channel>item"`
+	RDFItems []feedItem `xml:"item"`
+	// atomEntry is the one of our own feed.xml
+	Entries  []atomEntry   `xml:"entry"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+type feedItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	PubDate string `xml:"pubDate"`
+	DCDate  string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type opmlOutline struct {
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// addFeedEntries adds entries of the -feed feeds as bookmarks, see addedSources.
+// A feed failing to load is reported and skipped, the rest are added.
+func addFeedEntries(ctx context.Context, state *sql.DB) error {
+	var feedURLs []string
+	var docs []feedDoc
+	for _, src := range feeds {
+		doc, err := loadFeed(ctx, src)
+		if err != nil {
+			slog.Warn("failed to read the feed", "feed", src, "err", err)
+			continue
+		}
+		if doc.XMLName.Local != "opml" {
+			docs = append(docs, doc)
+			continue
+		}
+		var walk func(outlines []opmlOutline)
+		walk = func(outlines []opmlOutline) {
+			for _, o := range outlines {
+				if len(o.XMLURL) > 0 {
+					feedURLs = append(feedURLs, o.XMLURL)
+				}
+				walk(o.Outlines)
+			}
+		}
+		walk(doc.Outlines)
+	}
+	for _, src := range feedURLs {
+		doc, err := loadFeed(ctx, src)
+		if err != nil {
+			slog.Warn("failed to read the feed", "feed", src, "err", err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	entries := 0
+	for _, doc := range docs {
+		for _, b := range doc.bookmarks() {
+			if err := addBookmark(state, b); err != nil {
+				return err
+			}
+			entries++
+		}
+	}
+	slog.Info("feeds read", "feeds", len(docs), "entries", entries)
+	return nil
+}
+
+// bookmarks are the feed's entries, added when they were published, if the feed tells.
+func (doc feedDoc) bookmarks() []bookmark {
+	var list []bookmark
+	add := func(link, title, published string) {
+		link = strings.TrimSpace(link)
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		// titles of feeds in other charsets are mangled, the meta step takes the page's own anyway
+		b := newBookmark(link, cleanText(strings.ToValidUTF8(title, "")))
+		if date, ok := parseFeedDate(published); ok {
+			b.dateAdded = date
+		}
+		list = append(list, b)
+	}
+
+	for _, item := range append(doc.Items, doc.RDFItems...) {
+		add(item.Link, item.Title, cmp.Or(item.PubDate, item.DCDate))
+	}
+	for _, entry := range doc.Entries {
+		for _, link := range entry.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				add(link.Href, entry.Title, cmp.Or(entry.Published, entry.Updated))
+				break
+			}
+		}
+	}
+	return list
+}
+
+// parseFeedDate parses RFC 822 dates of RSS and RFC 3339 ones of Atom and Dublin Core.
+func parseFeedDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// loadFeed reads the feed or OPML from the url or the file.
+func loadFeed(ctx context.Context, src string) (feedDoc, error) {
+	var body io.Reader
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		f, err := os.Open(src)
+		if err != nil {
+			return feedDoc{}, err
+		}
+		defer f.Close()
+		body = f
+	} else {
+		transport, err := proxyTransport(defaultFetch.proxy)
+		if err != nil {
+			return feedDoc{}, err
+		}
+		client := &http.Client{Timeout: time.Minute, Transport: transport}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+		if err != nil {
+			return feedDoc{}, err
+		}
+		req.Header.Set("User-Agent", defaultFetch.userAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return feedDoc{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return feedDoc{}, fmt.Errorf("http status %d", resp.StatusCode)
+		}
+		body = resp.Body
+	}
+
+	var doc feedDoc
+	dec := xml.NewDecoder(io.LimitReader(body, maxFeedSize))
+	// feeds are often in latin-1 or windows-1251, the urls are ascii anyway
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := dec.Decode(&doc); err != nil {
+		return feedDoc{}, fmt.Errorf("parse: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,168 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// cdpConn talks the devtools protocol to chrome started with --remote-debugging-pipe,
+// the messages are json, each one ends with a zero byte.
+type cdpConn struct {
+	w      io.WriteCloser
+	r      io.ReadCloser
+	msgs   chan cdpMessage
+	done   chan struct{}
+	lastID int
+	// events which came while waiting for a reply, waitEvent looks at them first
+	events []cdpMessage
+}
+
+type cdpMessage struct {
+	ID        int             `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// startCDP starts chrome with the pipe as its fds 3 and 4, it reads
+// the commands from the first and writes replies into the other.
+// There is no way to pass those on windows, cmd fails to start there.
+func startCDP(cmd *exec.Cmd) (*cdpConn, error) {
+	cmdIn, toChrome, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	fromChrome, cmdOut, err := os.Pipe()
+	if err != nil {
+		cmdIn.Close()
+		toChrome.Close()
+		return nil, err
+	}
+	cmd.ExtraFiles = []*os.File{cmdIn, cmdOut}
+	err = cmd.Start()
+	// chrome has its own copies now, reading gets EOF once it exits
+	cmdIn.Close()
+	cmdOut.Close()
+	if err != nil {
+		toChrome.Close()
+		fromChrome.Close()
+		return nil, err
+	}
+
+	return newCDPConn(toChrome, fromChrome), nil
+}
+
+func newCDPConn(w io.WriteCloser, r io.ReadCloser) *cdpConn {
+	c := &cdpConn{w: w, r: r, msgs: make(chan cdpMessage), done: make(chan struct{})}
+	go c.read()
+	return c
+}
+
+func (c *cdpConn) read() {
+	defer close(c.msgs)
+	br := bufio.NewReader(c.r)
+	for {
+		bs, err := br.ReadBytes(0)
+		if err != nil {
+			return
+		}
+		var msg cdpMessage
+		if err := json.Unmarshal(bs[:len(bs)-1], &msg); err != nil {
+			continue
+		}
+		select {
+		case c.msgs <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *cdpConn) close() {
+	close(c.done)
+	c.w.Close()
+	c.r.Close()
+}
+
+func (c *cdpConn) next(ctx context.Context) (cdpMessage, error) {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			return cdpMessage{}, errors.New("chrome has closed the pipe")
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return cdpMessage{}, ctx.Err()
+	}
+}
+
+// call sends the command to the session (the browser itself if empty)
+// and waits for the reply, decoding it into result if it's not nil.
+func (c *cdpConn) call(ctx context.Context, session, method string, params, result any) error {
+	if params == nil {
+		params = struct{}{}
+	}
+	c.lastID++
+	req := cdpMessage{ID: c.lastID, SessionID: session, Method: method}
+	var err error
+	if req.Params, err = json.Marshal(params); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if _, err := c.w.Write(append(bs, 0)); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	for {
+		msg, err := c.next(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		switch {
+		case msg.ID == req.ID:
+			if msg.Error != nil {
+				return fmt.Errorf("%s: %s", method, msg.Error.Message)
+			}
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(msg.Result, result)
+		case len(msg.Method) > 0:
+			c.events = append(c.events, msg)
+		}
+	}
+}
+
+// waitEvent waits for the event the match func says yes to, skipping the others.
+func (c *cdpConn) waitEvent(ctx context.Context, method string, match func(params json.RawMessage) bool) error {
+	for i, msg := range c.events {
+		if msg.Method == method && match(msg.Params) {
+			c.events = c.events[i+1:]
+			return nil
+		}
+	}
+	c.events = nil
+
+	for {
+		msg, err := c.next(ctx)
+		if err != nil {
+			return err
+		}
+		if msg.Method == method && match(msg.Params) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeChrome answers the commands it reads with reply, it's done once the pipe is closed.
+func fakeChrome(t *testing.T, reply func(req cdpMessage) []string) *cdpConn {
+	t.Helper()
+	cmdIn, toChrome := io.Pipe()
+	fromChrome, cmdOut := io.Pipe()
+	go func() {
+		defer cmdOut.Close()
+		br := bufio.NewReader(cmdIn)
+		for {
+			bs, err := br.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			var req cdpMessage
+			if err := json.Unmarshal(bs[:len(bs)-1], &req); err != nil {
+				t.Errorf("bad command %q: %v", bs, err)
+				return
+			}
+			for _, msg := range reply(req) {
+				if _, err := io.WriteString(cmdOut, msg+"\x00"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	conn := newCDPConn(toChrome, fromChrome)
+	t.Cleanup(conn.close)
+	return conn
+}
+
+func TestCDPCall(t *testing.T) {
+	ctx := context.Background()
+	conn := fakeChrome(t, func(req cdpMessage) []string {
+		switch req.Method {
+		case "Page.navigate":
+			return []string{
+				`{"method":"Page.lifecycleEvent","sessionId":"s1","params":{"loaderId":"l0","name":"networkIdle"}}`,
+				`{"method":"Page.lifecycleEvent","sessionId":"s1","params":{"loaderId":"l1","name":"load"}}`,
+				`{"id":` + jsonString(req.ID) + `,"sessionId":"s1","result":{"loaderId":"l1"}}`,
+				`{"method":"Page.lifecycleEvent","sessionId":"s1","params":{"loaderId":"l1","name":"networkIdle"}}`,
+			}
+		case "Page.enable":
+			if req.SessionID != "s1" || string(req.Params) != "{}" {
+				t.Errorf("Page.enable got session %q, params %s", req.SessionID, req.Params)
+			}
+			return []string{`{"id":` + jsonString(req.ID) + `,"result":{}}`}
+		default:
+			return []string{`{"id":` + jsonString(req.ID) + `,"error":{"code":-32601,"message":"'` + req.Method + `' wasn't found"}}`}
+		}
+	})
+
+	if err := conn.call(ctx, "s1", "Page.enable", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var nav struct {
+		LoaderID string `json:"loaderId"`
+	}
+	if err := conn.call(ctx, "s1", "Page.navigate", map[string]any{"url": "https://example.com/"}, &nav); err != nil {
+		t.Fatal(err)
+	}
+	if nav.LoaderID != "l1" {
+		t.Errorf("got loader %q, want l1", nav.LoaderID)
+	}
+
+	// the event of about:blank came first, it's not the one
+	var names []string
+	err := conn.waitEvent(ctx, "Page.lifecycleEvent", func(params json.RawMessage) bool {
+		var event struct {
+			LoaderID string `json:"loaderId"`
+			Name     string `json:"name"`
+		}
+		_ = json.Unmarshal(params, &event)
+		names = append(names, event.LoaderID+" "+event.Name)
+		return event.LoaderID == nav.LoaderID && event.Name == "networkIdle"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ", "); got != "l0 networkIdle, l1 load, l1 networkIdle" {
+		t.Errorf("got events %s", got)
+	}
+
+	err = conn.call(ctx, "", "Browser.crash", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "wasn't found") {
+		t.Errorf("want the error of the reply, got %v", err)
+	}
+}
+
+func TestCDPClosed(t *testing.T) {
+	conn := fakeChrome(t, func(req cdpMessage) []string { return nil })
+	conn.w.Close()
+	if err := conn.call(context.Background(), "", "Browser.close", nil, nil); err == nil {
+		t.Error("want an error once chrome is gone, got none")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := conn.waitEvent(ctx, "Page.lifecycleEvent", func(json.RawMessage) bool { return true }); err == nil {
+		t.Error("want an error when interrupted, got none")
+	}
+}
+
+func jsonString(v any) string {
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
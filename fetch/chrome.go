@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// chromeBinaries are the names chrome goes by, the first one found is used.
+var chromeBinaries = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// ChromeRenderBudget is how long the page scripts are given to render it,
+// a download is done earlier once the network is idle.
+const ChromeRenderBudget = 10 * time.Second
+
+// ChromeOptions are how Chrome requests the page.
+type ChromeOptions struct {
+	UserAgent string
+	Proxy     string
+	// Headers are "Name: value" ones
+	Headers []string
+	Cookies []*http.Cookie
+	// NoSandbox runs chrome without its sandbox, which it can't set up
+	// in some containers, it's turned off as root anyway.
+	NoSandbox bool
+}
+
+// FindChrome returns the path of chrome, or of a chromium.
+func FindChrome() (string, error) {
+	for _, name := range chromeBinaries {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("chrome is not found, tried " + fmt.Sprint(chromeBinaries))
+}
+
+// ChromeSandboxArgs turn off the sandbox if asked to, or when running as root,
+// chrome refuses to start as root with the sandbox on.
+func ChromeSandboxArgs(noSandbox bool) []string {
+	if noSandbox || os.Geteuid() == 0 {
+		return []string{"--no-sandbox"}
+	}
+	return nil
+}
+
+// Chrome renders the page in headless chrome, scripts included, and returns its html.
+// Nothing is saved, the request's Dir and MaxSize are not used. A failure is an *Error.
+func Chrome(ctx context.Context, req Request, opts ChromeOptions) (string, error) {
+	logger := req.Logger
+	chrome, err := FindChrome()
+	if err != nil {
+		logger.Warn("can't run chrome", "url", req.URL, "err", err)
+		return "", &Error{Reason: err.Error()}
+	}
+	// a profile of its own, so the cookies don't stay anywhere
+	profile, err := os.MkdirTemp("", "ueb-archive-chrome-*")
+	if err != nil {
+		logger.Warn("can't run chrome", "url", req.URL, "err", err)
+		return "", failed("create chrome profile: %v", err)
+	}
+	defer os.RemoveAll(profile)
+
+	args := append([]string{
+		"--headless=new",
+		"--disable-gpu",
+		"--no-first-run",
+		"--remote-debugging-pipe",
+		"--user-data-dir=" + profile,
+		"--user-agent=" + opts.UserAgent,
+	}, ChromeSandboxArgs(opts.NoSandbox)...)
+	if len(opts.Proxy) > 0 {
+		args = append(args, "--proxy-server="+opts.Proxy)
+	}
+	args = append(args, "about:blank")
+
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+	logfile, err := os.Create(req.Log)
+	if err != nil {
+		logger.Warn("can't run chrome", "url", req.URL, "err", err)
+		return "", failed("create log: %v", err)
+	}
+	defer logfile.Close()
+
+	cmd := exec.CommandContext(ctx, chrome, args...)
+	cmd.Stderr = logfile
+	SetProcessGroup(cmd)
+	cmd.Cancel = func() error { return KillProcessGroup(cmd) }
+	conn, err := startCDP(cmd)
+	if err != nil {
+		logger.Warn("can't run chrome", "url", req.URL, "err", err)
+		return "", failed("start chrome: %v", err)
+	}
+	defer func() {
+		conn.close()
+		_ = KillProcessGroup(cmd)
+		_ = cmd.Wait()
+	}()
+
+	dom, err := renderChrome(ctx, conn, req.URL, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			reason := "interrupted"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				reason = "timeout"
+			}
+			logger.Warn("chrome interrupted", "url", req.URL, "reason", reason)
+			return "", &Error{Reason: reason}
+		}
+		logger.Warn("chrome failed", "url", req.URL, "err", err)
+		return "", &Error{Reason: "chrome failed: " + err.Error(), Transient: true}
+	}
+	if len(dom) == 0 {
+		logger.Warn("chrome rendered nothing", "url", req.URL)
+		return "", &Error{Reason: "chrome rendered nothing", Transient: true}
+	}
+	return dom, nil
+}
+
+// renderChrome opens the page in a new tab with the headers and cookies,
+// and returns its html once the network is idle, or when out of the render budget.
+func renderChrome(ctx context.Context, conn *cdpConn, url string, opts ChromeOptions) (string, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := conn.call(ctx, "", "Target.createTarget", map[string]any{"url": "about:blank"}, &target); err != nil {
+		return "", err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := conn.call(ctx, "", "Target.attachToTarget", map[string]any{"targetId": target.TargetID, "flatten": true}, &attached); err != nil {
+		return "", err
+	}
+	session := attached.SessionID
+
+	headers := make(map[string]string)
+	for _, h := range opts.Headers {
+		name, value, _ := strings.Cut(h, ":")
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	type step struct {
+		method string
+		params any
+	}
+	setup := []step{
+		{"Network.enable", nil},
+		{"Network.setExtraHTTPHeaders", map[string]any{"headers": headers}},
+		{"Page.enable", nil},
+		{"Page.setLifecycleEventsEnabled", map[string]any{"enabled": true}},
+	}
+	if len(opts.Cookies) > 0 {
+		setup = append(setup, step{"Network.setCookies", map[string]any{"cookies": chromeCookies(opts.Cookies)}})
+	}
+	for _, step := range setup {
+		if err := conn.call(ctx, session, step.method, step.params, nil); err != nil {
+			return "", err
+		}
+	}
+
+	var nav struct {
+		LoaderID  string `json:"loaderId"`
+		ErrorText string `json:"errorText"`
+	}
+	if err := conn.call(ctx, session, "Page.navigate", map[string]any{"url": url}, &nav); err != nil {
+		return "", err
+	}
+	if len(nav.ErrorText) > 0 {
+		return "", errors.New(nav.ErrorText)
+	}
+
+	budget, cancel := context.WithTimeout(ctx, ChromeRenderBudget)
+	err := conn.waitEvent(budget, "Page.lifecycleEvent", func(params json.RawMessage) bool {
+		var event struct {
+			LoaderID string `json:"loaderId"`
+			Name     string `json:"name"`
+		}
+		return json.Unmarshal(params, &event) == nil && event.LoaderID == nav.LoaderID && event.Name == "networkIdle"
+	})
+	cancel()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return "", err
+	}
+
+	var eval struct {
+		Result struct {
+			Value string `json:"value"`
+		} `json:"result"`
+	}
+	expr := map[string]any{"expression": "document.documentElement.outerHTML", "returnByValue": true}
+	if err := conn.call(ctx, session, "Runtime.evaluate", expr, &eval); err != nil {
+		return "", err
+	}
+	return eval.Result.Value, nil
+}
+
+// chromeCookies are the cookies as Network.setCookies takes them.
+func chromeCookies(cookies []*http.Cookie) []map[string]any {
+	params := make([]map[string]any, 0, len(cookies))
+	for _, c := range cookies {
+		p := map[string]any{"name": c.Name, "value": c.Value, "path": c.Path, "secure": c.Secure, "httpOnly": c.HttpOnly}
+		if strings.HasPrefix(c.Domain, ".") {
+			p["domain"] = c.Domain
+		} else {
+			// a host-only one is set by the url
+			scheme := "http"
+			if c.Secure {
+				scheme = "https"
+			}
+			p["url"] = scheme + "://" + c.Domain + c.Path
+		}
+		if !c.Expires.IsZero() {
+			p["expires"] = c.Expires.Unix()
+		}
+		params = append(params, p)
+	}
+	return params
+}
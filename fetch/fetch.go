@@ -0,0 +1,42 @@
+// Package fetch runs the download backends, wget and headless chrome,
+// and reads what they have done.
+package fetch
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Request is a page to download. The backend runs in the Root,
+// the Dir it saves into and the files saved are relative to it.
+type Request struct {
+	URL  string
+	Root string
+	Dir  string
+	// Log is the file the backend logs into
+	Log string
+	// Timeout kills the download, MaxSize does once the Dir has grown over it, 0 for no limit
+	Timeout time.Duration
+	MaxSize int64
+	Logger  *slog.Logger
+}
+
+// Error is a failed download, which the request's logger has reported already.
+type Error struct {
+	Reason string
+	// ExitCode is of the backend, 0 if it hasn't got that far
+	ExitCode int
+	// Transient failures are worth retrying
+	Transient bool
+	// Size is of the Dir, when it has grown over the MaxSize
+	Size int64
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+func failed(format string, args ...any) *Error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fetch
+
+import "os/exec"
+
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+func KillProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
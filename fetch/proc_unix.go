@@ -0,0 +1,19 @@
+//go:build unix
+
+package fetch
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup makes the command a leader of its own process group,
+// so it could be killed along with anything it has spawned.
+func SetProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// KillProcessGroup kills the command started with SetProcessGroup, and its children.
+func KillProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
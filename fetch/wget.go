@@ -0,0 +1,161 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Wget runs wget with the args, the url and the log file among them, and reads
+// what it has done from the log. A failure is an *Error.
+func Wget(ctx context.Context, req Request, args []string) (WgetLog, error) {
+	logger := req.Logger
+	cmd := exec.CommandContext(ctx, "wget", args...)
+	// pretend to be a simble terminal,
+	// without that, wget weirdly use some sort of
+	// fancy unicode single brackets, which i unable
+	// to just cut with string slicing. so kindly
+	// requesting wget to produce normal ascii stuff.
+	// The C locale keeps the log in english, translated
+	// messages are not something ParseWgetLog could read.
+	cmd.Env = append(cmd.Env, WgetEnv...)
+	cmd.Dir = req.Root
+	SetProcessGroup(cmd)
+	// the default is to kill wget only, not what it may have spawned
+	cmd.Cancel = func() error { return KillProcessGroup(cmd) }
+
+	if err := cmd.Start(); err != nil {
+		logger.Warn("can't run wget", "url", req.URL, "err", err)
+		return WgetLog{}, failed("start wget: %v", err)
+	}
+
+	var killed killSwitch
+	kill := func(reason string, size int64) {
+		if !killed.set(reason, size) {
+			return
+		}
+		if err := KillProcessGroup(cmd); err != nil {
+			logger.Warn("failed to kill wget", "url", req.URL, "err", err)
+		}
+	}
+
+	// a hung download would stall the worker forever otherwise
+	if req.Timeout > 0 {
+		timer := time.AfterFunc(req.Timeout, func() { kill("timeout", 0) })
+		defer timer.Stop()
+	}
+
+	dir := filepath.Join(req.Root, req.Dir)
+	done := make(chan struct{})
+	defer close(done)
+	if req.MaxSize > 0 {
+		go watchSize(dir, req.MaxSize, done, kill)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		code := cmd.ProcessState.ExitCode()
+		if ctx.Err() != nil {
+			logger.Warn("wget interrupted", "url", req.URL)
+			return WgetLog{}, &Error{Reason: "interrupted", ExitCode: code}
+		}
+		if reason, size := killed.get(); len(reason) > 0 {
+			logger.Warn("wget killed", "url", req.URL, "reason", reason)
+			return WgetLog{}, &Error{Reason: reason, ExitCode: code, Size: size}
+		}
+
+		// from "man 1 wget":
+		// > 8   Server issued an error response.
+		//
+		// any 404 returned by any sequential requests (for images, .css, .js, etc)
+		// will lead to this error code, even if we have succesfully downloaded
+		// everyting else, so just ignore this particular code
+		if code != 8 {
+			logger.Warn("wget failed", "url", req.URL, "status", code)
+			// > 4   Network failure.
+			return WgetLog{}, &Error{Reason: fmt.Sprintf("wget failed with status=%d", code), ExitCode: code, Transient: code == 4}
+		}
+	}
+
+	wlog, err := ReadWgetLog(req.Log)
+	if err != nil {
+		logger.Warn("can't read wget log", "url", req.URL, "err", err)
+		return WgetLog{}, failed("read wget log: %v", err)
+	}
+	if len(wlog.Saved) == 0 {
+		// e.g. the page itself is 404, which is the same exit code 8
+		logger.Warn("wget saved nothing", "url", req.URL, "http_status", wlog.Status)
+		return WgetLog{}, &Error{
+			Reason:   fmt.Sprintf("nothing saved, http status=%d", wlog.Status),
+			ExitCode: cmd.ProcessState.ExitCode(),
+			// no status at all means we haven't got any response
+			Transient: wlog.Status == 0 || wlog.Status == 429 || wlog.Status >= 500,
+		}
+	}
+	if size := dirSize(dir); req.MaxSize > 0 && size > req.MaxSize {
+		// too fast for the watcher to notice
+		logger.Warn("capture is too big", "url", req.URL, "size", size)
+		return WgetLog{}, &Error{Reason: "capture is too big", Size: size}
+	}
+	return wlog, nil
+}
+
+// killSwitch remembers why we've killed wget, only the first reason counts.
+type killSwitch struct {
+	mu     sync.Mutex
+	reason string
+	size   int64
+}
+
+func (k *killSwitch) set(reason string, size int64) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.reason) > 0 {
+		return false
+	}
+	k.reason, k.size = reason, size
+	return true
+}
+
+func (k *killSwitch) get() (string, int64) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.reason, k.size
+}
+
+// watchSize polls the capture directory size until done is closed,
+// calls kill once it's over the limit.
+func watchSize(dir string, limit int64, done <-chan struct{}, kill func(reason string, size int64)) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+			if size := dirSize(dir); size > limit {
+				kill("capture is too big", size)
+				return
+			}
+		}
+	}
+}
+
+// dirSize sums sizes of all regular files under the dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
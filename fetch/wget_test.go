@@ -0,0 +1,48 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWget(t *testing.T) {
+	if _, err := exec.LookPath("wget"); err != nil {
+		t.Skip("no wget")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><body>hello</body></html>")
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	get := func(url string) (WgetLog, error) {
+		req := Request{URL: url, Root: root, Dir: "page", Log: filepath.Join(root, "wget.log"), Logger: slog.Default()}
+		return Wget(context.Background(), req, []string{"--output-file", req.Log, "--directory-prefix", req.Dir, url})
+	}
+
+	wlog, err := get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wlog.Status != 200 || len(wlog.Saved) != 1 || !strings.HasPrefix(wlog.Saved[0], "page/") {
+		t.Errorf("got status %d, saved %v", wlog.Status, wlog.Saved)
+	}
+
+	_, err = get(srv.URL + "/missing")
+	var ferr *Error
+	if !errors.As(err, &ferr) || ferr.Reason != "nothing saved, http status=404" || ferr.Transient {
+		t.Errorf("want a permanent failure of the 404, got %v", err)
+	}
+}
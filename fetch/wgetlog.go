@@ -0,0 +1,98 @@
+package fetch
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WgetEnv makes wget log in english, in ascii, which is what ParseWgetLog reads.
+var WgetEnv = []string{"TERM=xterm", "LC_ALL=C", "LANG=C"}
+
+var (
+	// "--2006-01-02 15:04:05--  https://...", or with "(try: 2)" in between
+	wgetRequestRe = regexp.MustCompile(`^--\d{4}-\d\d-\d\d \d\d:\d\d:\d\d--\s+(?:\(try:\s*\d+\)\s+)?(\S+)$`)
+	wgetStatusRe  = regexp.MustCompile(`awaiting response\.\.\. (\d{3})\b`)
+	wgetSavingRe  = regexp.MustCompile(`^Saving to: '(.+)'$`)
+	// "2006-01-02 15:04:05 (61.6 MB/s) - 'file' saved [344/344]", the total is unknown for chunked responses
+	wgetSavedRe = regexp.MustCompile(` saved \[(\d+)(?:/\d+)?\]$`)
+)
+
+// WgetLog is what wget has done, as its log says.
+type WgetLog struct {
+	// Saved are the files saved, the page itself goes first
+	Saved []string
+	// Status is the http status of the page itself
+	Status int
+	// Statuses counts responses by http status
+	Statuses map[int]int
+	// Requests wget has made, redirects and retries included
+	Requests int
+	// Received is the bytes of all responses wget saved
+	Received int64
+	// Redirects are the urls the page redirected through, the last one is the final url
+	Redirects []string
+	// Finished and Downloaded are of wget's summary at the end
+	Finished   string
+	Downloaded string
+}
+
+// ReadWgetLog parses the log file of wget, see ParseWgetLog.
+func ReadWgetLog(logfile string) (WgetLog, error) {
+	f, err := os.Open(logfile)
+	if err != nil {
+		return WgetLog{}, err
+	}
+	defer f.Close()
+	return ParseWgetLog(f)
+}
+
+// ParseWgetLog reads the log of wget run with WgetEnv.
+func ParseWgetLog(r io.Reader) (WgetLog, error) {
+	wlog := WgetLog{
+		// no idea, should we measure the average?
+		Saved:    make([]string, 0, 10),
+		Statuses: make(map[int]int),
+	}
+
+	redirected := false
+	lscan := bufio.NewScanner(r)
+	for lscan.Scan() {
+		line := lscan.Text()
+		if m := wgetRequestRe.FindStringSubmatch(line); m != nil {
+			wlog.Requests++
+			if redirected {
+				wlog.Redirects = append(wlog.Redirects, m[1])
+			}
+			redirected = false
+		}
+		if m := wgetSavingRe.FindStringSubmatch(line); m != nil {
+			wlog.Saved = append(wlog.Saved, m[1])
+		}
+		if m := wgetStatusRe.FindStringSubmatch(line); m != nil {
+			status, _ := strconv.Atoi(m[1])
+			wlog.Statuses[status]++
+			// the status of the page itself is the last one before anything
+			// has been saved, earlier ones are redirects.
+			if len(wlog.Saved) == 0 {
+				wlog.Status = status
+				redirected = status >= 300 && status < 400
+			}
+		}
+		if m := wgetSavedRe.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.ParseInt(m[1], 10, 64)
+			wlog.Received += n
+		}
+		if finished, ok := strings.CutPrefix(line, "FINISHED --"); ok {
+			wlog.Finished = strings.TrimSpace(strings.TrimSuffix(finished, "--"))
+		}
+		if downloaded, ok := strings.CutPrefix(line, "Downloaded:"); ok && len(wlog.Finished) > 0 {
+			wlog.Downloaded = strings.TrimSpace(downloaded)
+		}
+	}
+
+	return wlog, lscan.Err()
+}
@@ -0,0 +1,71 @@
+package fetch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const redirectedLog = `--2024-05-01 10:00:00--  http://example.com/
+Resolving example.com (example.com)... 93.184.216.34
+Connecting to example.com (example.com)|93.184.216.34|:80... connected.
+HTTP request sent, awaiting response... 301 Moved Permanently
+Location: https://example.com/ [following]
+--2024-05-01 10:00:01--  https://example.com/
+Connecting to example.com (example.com)|93.184.216.34|:443... connected.
+HTTP request sent, awaiting response... 200 OK
+Length: unspecified [text/html]
+Saving to: 'example.com/index.html'
+
+2024-05-01 10:00:01 (1.2 MB/s) - 'example.com/index.html' saved [1256]
+
+--2024-05-01 10:00:02--  (try: 2)  https://example.com/style.css
+HTTP request sent, awaiting response... 200 OK
+Length: 300 [text/css]
+Saving to: 'example.com/style.css'
+
+2024-05-01 10:00:02 (3.1 MB/s) - 'example.com/style.css' saved [300/300]
+
+--2024-05-01 10:00:02--  https://example.com/missing.png
+HTTP request sent, awaiting response... 404 Not Found
+2024-05-01 10:00:02 ERROR 404: Not Found.
+
+FINISHED --2024-05-01 10:00:03--
+Total wall clock time: 3.0s
+Downloaded: 2 files, 1.5K in 0.001s (1.4 MB/s)
+`
+
+func TestParseWgetLog(t *testing.T) {
+	wlog, err := ParseWgetLog(strings.NewReader(redirectedLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := WgetLog{
+		Saved:      []string{"example.com/index.html", "example.com/style.css"},
+		Status:     200,
+		Statuses:   map[int]int{200: 2, 301: 1, 404: 1},
+		Requests:   4,
+		Received:   1556,
+		Redirects:  []string{"https://example.com/"},
+		Finished:   "2024-05-01 10:00:03",
+		Downloaded: "2 files, 1.5K in 0.001s (1.4 MB/s)",
+	}
+	if !reflect.DeepEqual(wlog, want) {
+		t.Errorf("got  %+v\nwant %+v", wlog, want)
+	}
+}
+
+func TestParseWgetLogNotFound(t *testing.T) {
+	log := `--2024-05-01 10:00:00--  https://example.com/gone
+HTTP request sent, awaiting response... 404 Not Found
+2024-05-01 10:00:00 ERROR 404: Not Found.
+`
+	wlog, err := ParseWgetLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wlog.Status != 404 || len(wlog.Saved) != 0 || len(wlog.Redirects) != 0 || len(wlog.Downloaded) > 0 {
+		t.Errorf("got %+v", wlog)
+	}
+}
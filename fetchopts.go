@@ -0,0 +1,285 @@
+package uebarchive
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// some sites serve wget's own user-agent a 403 or a stripped-down page,
+// so pretend to be a regular firefox.
+const defaultUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:140.0) Gecko/20100101 Firefox/140.0"
+
+// fetchOptions tune how much of a site a single capture pulls in.
+type fetchOptions struct {
+	// depth > 0 turns on the recursive download
+	depth     int
+	quota     byteSize
+	accept    string
+	reject    string
+	spanHosts bool
+
+	// domains requisites may be fetched from, comma-separated,
+	// the bookmark's own host is always allowed.
+	domains        string
+	excludeDomains string
+
+	userAgent string
+	// headers are "Name: value" lines
+	headers headerList
+	// proxy is http://, https:// or socks5:// url
+	proxy string
+	// backend is wget, or chrome for pages which need scripts to show anything
+	backend string
+	// noCookies leaves out the -cookies and the page's own, see public
+	noCookies bool
+}
+
+// public are the options to fetch the page from a public archive,
+// the site's headers and cookies are not for anyone else.
+func (o fetchOptions) public() fetchOptions {
+	o.headers = nil
+	o.noCookies = true
+	return o
+}
+
+// headerList is a repeatable flag of "Name: value" headers.
+type headerList []string
+
+func (h *headerList) String() string {
+	if h == nil {
+		return ""
+	}
+	return strings.Join(*h, "; ")
+}
+
+func (h *headerList) Set(s string) error {
+	name, _, ok := strings.Cut(s, ":")
+	if !ok || len(strings.TrimSpace(name)) == 0 {
+		return fmt.Errorf("header must look like \"Name: value\", got %q", s)
+	}
+	// don't modify the defaults' backing array through a copy
+	*h = append(slices.Clip(*h), strings.TrimSpace(s))
+	return nil
+}
+
+// mirrors are bookmarks tagged "mirror", or "mirror:<depth>",
+// or with mirror = true|<depth> in the config, see fetchOptions.mirror.
+var (
+	mirrorDepth   int
+	mirrorQuota   byteSize = defaultMirrorQuota
+	mirrorTimeout time.Duration
+)
+
+const defaultMirrorQuota byteSize = 500 << 20
+
+// defaultFetch is set by flags, and applies to every bookmark
+// unless the config has a [fetch <url prefix>] section for it.
+var defaultFetch fetchOptions
+
+func fetchFlags(fs *flag.FlagSet) {
+	// fs.Var takes the value as it is for the default, see Run
+	defaultFetch = fetchOptions{}
+	mirrorQuota = defaultMirrorQuota
+	fs.IntVar(&defaultFetch.depth, "depth", 0, "follow links that many levels deep, 0 saves only the page itself")
+	fs.Var(&defaultFetch.quota, "quota", "stop a recursive download after that `size`, e.g. 50M")
+	fs.StringVar(&defaultFetch.accept, "accept", "", "comma-separated file suffixes or patterns to download, see wget --accept")
+	fs.StringVar(&defaultFetch.reject, "reject", "", "comma-separated file suffixes or patterns to skip, see wget --reject")
+	fs.BoolVar(&defaultFetch.spanHosts, "span-hosts", false, "allow requisites and recursion to go to other hosts")
+	fs.StringVar(&defaultFetch.domains, "domains", "", "comma-separated domains requisites may come from (e.g. CDNs), implies -span-hosts")
+	fs.Var(&defaultFetch.headers, "header", "extra `header` for all requests, like \"Accept-Language: en\", can be repeated")
+	fs.StringVar(&defaultFetch.proxy, "proxy", "", "http://, https:// or socks5:// proxy for all requests")
+	fs.StringVar(&torProxy, "tor-proxy", "", "tor socks5:// proxy for .onion bookmarks, e.g. socks5://127.0.0.1:9050")
+	fs.StringVar(&defaultFetch.userAgent, "user-agent", defaultUserAgent, "User-Agent header for all requests")
+	fs.StringVar(&defaultFetch.backend, "backend", "wget", "download pages with wget, or chrome, which runs page scripts but saves the html only")
+	fs.BoolVar(&chromeNoSandbox, "chrome-no-sandbox", false, "run chrome without its sandbox, e.g. in a container, it's always off as root")
+	fs.StringVar(&defaultFetch.excludeDomains, "exclude-domains", "", "comma-separated domains never to fetch from, e.g. ad and tracker hosts, with -span-hosts or -domains")
+	fs.IntVar(&mirrorDepth, "mirror-depth", 5, "recursion depth for bookmarks tagged \"mirror\", a \"mirror:<depth>\" tag overrides it")
+	fs.Var(&mirrorQuota, "mirror-quota", "stop mirroring a site after that `size`, unless -quota or the config says otherwise")
+	fs.DurationVar(&mirrorTimeout, "mirror-timeout", 3*time.Hour, "kill a mirror, or any recursive download, taking longer than that, 0 for no limit")
+}
+
+// wgetArgs turns options into wget flags, host is the bookmark's own host.
+func (o fetchOptions) wgetArgs(host string) []string {
+	var args []string
+	if o.depth > 0 {
+		args = append(args, "--recursive", "--level", fmt.Sprint(o.depth))
+	}
+	if o.quota > 0 {
+		args = append(args, "--quota", fmt.Sprint(int64(o.quota)))
+	}
+	if len(o.accept) > 0 {
+		args = append(args, "--accept", o.accept)
+	}
+	if len(o.reject) > 0 {
+		args = append(args, "--reject", o.reject)
+	}
+	if len(o.userAgent) > 0 {
+		args = append(args, "--user-agent", o.userAgent)
+	}
+	for _, h := range o.headers {
+		args = append(args, "--header", h)
+	}
+	if len(o.domains) > 0 {
+		// wget checks the list for every url, the page's host included
+		args = append(args, "--domains", o.domains+","+host)
+	}
+	if o.spanHosts || len(o.domains) > 0 {
+		// the domain list doesn't mean anything without it
+		args = append(args, "--span-hosts")
+		// nor do the excluded ones, wget stays on the page's host otherwise,
+		// they don't turn it on, that would change what every capture fetches.
+		if len(o.excludeDomains) > 0 {
+			args = append(args, "--exclude-domains", o.excludeDomains)
+		}
+	}
+	return args
+}
+
+// timeout is how long the download may take, a recursive one gets the -mirror-timeout.
+func (o fetchOptions) timeout() time.Duration {
+	if o.depth > 0 {
+		return mirrorTimeout
+	}
+	return downloadTimeout
+}
+
+// set applies a single option by its flag name, for overrides.
+func (o *fetchOptions) set(name, value string) error {
+	var err error
+	switch name {
+	case "depth":
+		o.depth, err = strconv.Atoi(value)
+	case "quota":
+		err = o.quota.Set(value)
+	case "accept":
+		o.accept = value
+	case "reject":
+		o.reject = value
+	case "span-hosts":
+		o.spanHosts, err = strconv.ParseBool(value)
+	case "domains":
+		o.domains = value
+	case "exclude-domains":
+		o.excludeDomains = value
+	case "user-agent":
+		o.userAgent = value
+	case "header":
+		err = o.headers.Set(value)
+	case "proxy":
+		o.proxy = value
+	case "mirror":
+		err = o.mirror(value)
+	case "backend":
+		if value != "wget" && value != "chrome" {
+			return fmt.Errorf("backend must be wget or chrome, got %q", value)
+		}
+		o.backend = value
+	default:
+		return fmt.Errorf("unknown fetch option %q", name)
+	}
+	return err
+}
+
+// mirror turns on the recursive download of the whole site, or a part of it
+// under the bookmark's path, value is either a depth, or true or false.
+func (o *fetchOptions) mirror(value string) error {
+	depth := mirrorDepth
+	if n, err := strconv.Atoi(value); err == nil {
+		depth = n
+	} else if on, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("mirror must be a depth or true/false, got %q", value)
+	} else if !on {
+		return nil
+	}
+
+	o.depth = depth
+	if o.quota == 0 {
+		o.quota = mirrorQuota
+	}
+	return nil
+}
+
+// applyTags applies options the bookmark's tags ask for, on top of the config:
+// "ueb:<option>=<value>" sets any option of a [fetch] section, like ueb:depth=2
+// or ueb:backend=chrome, and "mirror" or "mirror:<depth>" is a shortcut for ueb:mirror.
+func (o *fetchOptions) applyTags(tags []string) error {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		var name, value string
+		if option, ok := strings.CutPrefix(tag, "ueb:"); ok {
+			var found bool
+			if name, value, found = strings.Cut(option, "="); !found {
+				return fmt.Errorf("tag %q: must look like ueb:<option>=<value>", tag)
+			}
+		} else if mirror, depth, found := strings.Cut(tag, ":"); strings.EqualFold(mirror, "mirror") {
+			name, value = "mirror", "true"
+			if found {
+				value = depth
+			}
+		} else {
+			continue
+		}
+
+		if err := o.set(strings.TrimSpace(name), strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("tag %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// fetchOptionsFor returns options for the url: the defaults,
+// overridden by the config section with the longest matching prefix:
+//
+//	[fetch https://docs.example.com/]
+//	depth = 3
+//	quota = 100M
+//	header = Authorization: Bearer xxx
+//	proxy = socks5://localhost:1080
+//	backend = chrome
+//
+// Bookmark's tags override those, see applyTags.
+func fetchOptionsFor(rawURL string) (fetchOptions, error) {
+	opts := defaultFetch
+	if len(opts.backend) > 0 {
+		// the flag isn't checked otherwise
+		if err := opts.set("backend", opts.backend); err != nil {
+			return opts, err
+		}
+	}
+	if isOnion(rawURL) {
+		// the regular -proxy can't reach hidden services anyway
+		opts.proxy = torProxy
+	}
+	if configFile == nil {
+		return opts, nil
+	}
+
+	var best *ini.Section
+	for _, section := range configFile.Sections() {
+		prefix, ok := strings.CutPrefix(section.Name(), "fetch ")
+		if !ok || !strings.HasPrefix(rawURL, strings.TrimSpace(prefix)) {
+			continue
+		}
+		if best == nil || len(section.Name()) > len(best.Name()) {
+			best = section
+		}
+	}
+	if best == nil {
+		return opts, nil
+	}
+
+	for _, key := range best.Keys() {
+		for _, value := range key.ValueWithShadows() {
+			if err := opts.set(key.Name(), value); err != nil {
+				return opts, fmt.Errorf("config: [%s]: %w", best.Name(), err)
+			}
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,316 @@
+package uebarchive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// filterLists are -filter-list files and urls, in the adblock syntax of EasyList and uBlock Origin.
+var filterLists listFlag
+
+// a downloaded list is kept for that long, EasyList itself asks for 4 days
+const filterListMaxAge = 24 * time.Hour
+
+// filterConfig is a wgetrc with the filter lists' rules, made for the run
+// by prepareFilterLists, wget gets it instead of the user's one.
+var filterConfig string
+
+var (
+	// userRC and filterDomains are what filterConfig is made of,
+	// for the ones with -exclude-domains of their own, see wgetConfig.
+	userRC        []byte
+	filterDomains []string
+
+	// filterConfigs are filterConfig with -exclude-domains merged in, by those
+	filterConfigs   = make(map[string]string)
+	filterConfigsMu sync.Mutex
+)
+
+// filteredHosts are hosts the filter lists block, subdomains included, see isFilteredHost.
+var filteredHosts map[string]bool
+
+// listFlag is a repeatable flag of strings.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// filterOptions are the rule $options which only narrow down what's blocked,
+// blocking it everywhere is close enough. Rules with other options are skipped.
+var filterOptions = []string{
+	"script", "image", "stylesheet", "font", "media", "object", "xmlhttprequest", "xhr",
+	"subdocument", "frame", "ping", "beacon", "websocket", "other",
+	"third-party", "3p", "important",
+}
+
+// ||example.com^, the host and its subdomains
+var filterDomainRe = regexp.MustCompile(`^\|\|([a-z0-9.-]+\.[a-z]{2,})\^?$`)
+
+// prepareFilterLists turns -filter-list rules of whole hosts into a wgetrc with
+// exclude_domains, which only matters with -span-hosts, since wget doesn't go to
+// other hosts otherwise. The hosts are kept in filteredHosts for what doesn't
+// run wget, see isFilteredHost. Rules of url patterns are skipped: tens of
+// thousands of them make a regexp too big for wget to match on every request.
+// The system and user's wgetrc come first, so their settings stay.
+// The caller must remove the file after the run.
+func prepareFilterLists(ctx context.Context) (string, error) {
+	var domains []string
+	hosts := make(map[string]bool)
+	for _, src := range filterLists {
+		list, err := loadFilterList(ctx, src)
+		if err != nil {
+			return "", fmt.Errorf("filter list %s: %w", src, err)
+		}
+
+		skipped := 0
+		lscan := bufio.NewScanner(bytes.NewReader(list))
+		lscan.Buffer(nil, 1<<20)
+		for lscan.Scan() {
+			domain, ok := parseFilterRule(strings.TrimSpace(lscan.Text()))
+			switch {
+			case !ok:
+				skipped++
+			case len(domain) > 0 && !hosts[domain]:
+				hosts[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+		if err := lscan.Err(); err != nil {
+			return "", fmt.Errorf("filter list %s: %w", src, err)
+		}
+		slog.Debug("filter list loaded", "list", src, "skipped", skipped)
+	}
+	slog.Info("filter lists loaded", "domains", len(domains))
+	filteredHosts = hosts
+
+	var rc bytes.Buffer
+	for _, name := range userWgetrc() {
+		if bs, err := os.ReadFile(name); err == nil {
+			rc.Write(bs)
+			rc.WriteString("\n")
+		}
+	}
+	userRC, filterDomains = rc.Bytes(), domains
+	return writeWgetrc(domains)
+}
+
+// wgetConfig is the filterConfig for a bookmark with the -exclude-domains, those are
+// merged into the same exclude_domains setting, so one doesn't replace the other.
+func wgetConfig(excludeDomains string) (string, error) {
+	if len(filterConfig) == 0 || len(excludeDomains) == 0 {
+		return filterConfig, nil
+	}
+
+	filterConfigsMu.Lock()
+	defer filterConfigsMu.Unlock()
+	if name, ok := filterConfigs[excludeDomains]; ok {
+		return name, nil
+	}
+	domains := slices.Clone(filterDomains)
+	for _, domain := range strings.Split(excludeDomains, ",") {
+		if domain = strings.TrimSpace(domain); len(domain) > 0 && !filteredHosts[domain] {
+			domains = append(domains, domain)
+		}
+	}
+	name, err := writeWgetrc(domains)
+	if err != nil {
+		return "", err
+	}
+	filterConfigs[excludeDomains] = name
+	return name, nil
+}
+
+// writeWgetrc writes the user's wgetrc with the domains excluded into a temporary file.
+func writeWgetrc(domains []string) (string, error) {
+	f, err := os.CreateTemp("", "ueb-archive-wgetrc-*")
+	if err != nil {
+		return "", fmt.Errorf("create wgetrc: %w", err)
+	}
+	rc := slices.Clone(userRC)
+	if len(domains) > 0 {
+		rc = append(rc, "exclude_domains = "+strings.Join(domains, ",")+"\n"...)
+	}
+	if _, err := f.Write(rc); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write wgetrc: %w", err)
+	}
+	return f.Name(), f.Close()
+}
+
+// removeFilterConfigs removes the wgetrc files of the run.
+func removeFilterConfigs() {
+	os.Remove(filterConfig)
+	filterConfig = ""
+	filteredHosts = nil
+	userRC, filterDomains = nil, nil
+
+	filterConfigsMu.Lock()
+	defer filterConfigsMu.Unlock()
+	for key, name := range filterConfigs {
+		os.Remove(name)
+		delete(filterConfigs, key)
+	}
+}
+
+// isFilteredHost tells if the filter lists block the host, or a domain it's a subdomain of.
+func isFilteredHost(host string) bool {
+	if len(filteredHosts) == 0 {
+		return false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for len(host) > 0 {
+		if filteredHosts[host] {
+			return true
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			return false
+		}
+		host = parent
+	}
+	return false
+}
+
+// userWgetrc are the startup files wget would read if not given --config.
+func userWgetrc() []string {
+	files := []string{"/etc/wgetrc"}
+	if name := os.Getenv("WGETRC"); len(name) > 0 {
+		return append(files, name)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, path.Join(home, ".wgetrc"))
+	}
+	return files
+}
+
+// dropFiltered removes scripts, frames, images and links of hosts the filter lists
+// block from a page chrome has rendered, there are no requisites downloaded
+// for exclude_domains to apply to, the page loads them when it's opened.
+func dropFiltered(page string) string {
+	if len(filteredHosts) == 0 {
+		return page
+	}
+	for _, elem := range []struct {
+		re   *regexp.Regexp
+		attr string
+	}{
+		{scriptElemRe, "src"},
+		{iframeElemRe, "src"},
+		{imgTagRe, "src"},
+		{linkElemRe, "href"},
+	} {
+		page = elem.re.ReplaceAllStringFunc(page, func(tag string) string {
+			u, err := url.Parse(strings.TrimSpace(tagAttrs(openTagRe.FindString(tag))[elem.attr]))
+			if err == nil && isFilteredHost(u.Hostname()) {
+				return ""
+			}
+			return tag
+		})
+	}
+	return page
+}
+
+// parseFilterRule returns the host of a rule blocking a whole host, ok is false
+// for the rest: exceptions, element hiding, url patterns and rules with options
+// other than filterOptions. Comments are neither.
+func parseFilterRule(rule string) (domain string, ok bool) {
+	if len(rule) == 0 || strings.HasPrefix(rule, "!") || strings.HasPrefix(rule, "[") {
+		return "", true
+	}
+	if strings.HasPrefix(rule, "@@") || strings.Contains(rule, "#") {
+		return "", false
+	}
+
+	if i := strings.LastIndex(rule, "$"); i >= 0 {
+		for _, opt := range strings.Split(rule[i+1:], ",") {
+			if !slices.Contains(filterOptions, strings.ToLower(strings.TrimSpace(opt))) {
+				return "", false
+			}
+		}
+		rule = rule[:i]
+	}
+	// hosts are case-insensitive, unlike the rest of a url
+	if m := filterDomainRe.FindStringSubmatch(strings.ToLower(rule)); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// loadFilterList reads the list from a file, or downloads it, a downloaded
+// list is cached for filterListMaxAge, and used longer if the update fails.
+func loadFilterList(ctx context.Context, src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(src))
+	cached := path.Join(cacheDir, "ueb-archive", "filters", hex.EncodeToString(sum[:8])+".txt")
+	if info, err := os.Stat(cached); err == nil && time.Since(info.ModTime()) < filterListMaxAge {
+		return os.ReadFile(cached)
+	}
+
+	list, err := downloadFilterList(ctx, src)
+	if err != nil {
+		if stale, staleErr := os.ReadFile(cached); staleErr == nil {
+			slog.Warn("can't update filter list, using the old one", "list", src, "err", err)
+			return stale, nil
+		}
+		return nil, err
+	}
+	if err := os.MkdirAll(path.Dir(cached), 0o700); err == nil {
+		_ = os.WriteFile(cached, list, 0o600)
+	}
+	return list, nil
+}
+
+func downloadFilterList(ctx context.Context, src string) ([]byte, error) {
+	transport, err := proxyTransport(defaultFetch.proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: time.Minute, Transport: transport}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", defaultFetch.userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: http status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+}
@@ -0,0 +1,42 @@
+package uebarchive
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWgetConfigMergesExcludeDomains(t *testing.T) {
+	userRC, filterDomains = []byte("tries = 3\n"), []string{"ads.example"}
+	filteredHosts = map[string]bool{"ads.example": true}
+	var err error
+	if filterConfig, err = writeWgetrc(filterDomains); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(removeFilterConfigs)
+
+	if name, err := wgetConfig(""); err != nil || name != filterConfig {
+		t.Errorf("got %q, %v without -exclude-domains, want the filter lists' one", name, err)
+	}
+	name, err := wgetConfig("cdn.example, ads.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "tries = 3\nexclude_domains = ads.example,cdn.example\n"; string(bs) != want {
+		t.Errorf("got wgetrc %q, want %q", bs, want)
+	}
+	if again, _ := wgetConfig("cdn.example, ads.example"); again != name {
+		t.Errorf("got another wgetrc %s for the same domains", again)
+	}
+
+	removeFilterConfigs()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("%s is left after the run", name)
+	}
+	if name, _ := wgetConfig("cdn.example"); len(name) > 0 {
+		t.Errorf("got %q without filter lists, want none", name)
+	}
+}
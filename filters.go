@@ -0,0 +1,114 @@
+package uebarchive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	includeURLs patternList
+	excludeURLs patternList
+	addedAfter  sinceFlag
+)
+
+// sinceFlag is a point in time, given as a date, or as a duration back from now,
+// which is counted on every run, so a daemon or watch keeps the window moving.
+type sinceFlag struct {
+	date time.Time
+	ago  time.Duration
+}
+
+// cutoff is the point in time, zero if it isn't set.
+func (s sinceFlag) cutoff() time.Time {
+	if s.ago > 0 {
+		return time.Now().Add(-s.ago)
+	}
+	return s.date
+}
+
+func (s *sinceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	if s.ago > 0 {
+		return s.ago.String()
+	}
+	if s.date.IsZero() {
+		return ""
+	}
+	return s.date.Format(time.DateOnly)
+}
+
+func (s *sinceFlag) Set(v string) error {
+	if d, err := time.ParseDuration(v); err == nil {
+		*s = sinceFlag{ago: d}
+		return nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		return fmt.Errorf("neither a date like 2024-01-31 nor a duration like 720h: %q", v)
+	}
+	*s = sinceFlag{date: t}
+	return nil
+}
+
+// patternList is a repeatable flag of url patterns: regular expressions,
+// or shell-like globs with the "glob:" prefix, e.g. glob:*.pdf
+type patternList []*regexp.Regexp
+
+func (p *patternList) String() string {
+	if p == nil {
+		return ""
+	}
+	ss := make([]string, 0, len(*p))
+	for _, re := range *p {
+		ss = append(ss, re.String())
+	}
+	return strings.Join(ss, " ")
+}
+
+func (p *patternList) Set(s string) error {
+	if glob, ok := strings.CutPrefix(s, "glob:"); ok {
+		s = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(glob)) + "$"
+	}
+
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+// match returns the first pattern matching the url, or nil.
+func (p patternList) match(url string) *regexp.Regexp {
+	for _, re := range p {
+		if re.MatchString(url) {
+			return re
+		}
+	}
+	return nil
+}
+
+// addedReason tells if the bookmark is older than -added-after,
+// the ones which don't know when they were added aren't.
+func addedReason(bmark bookmark) string {
+	cutoff := addedAfter.cutoff()
+	if cutoff.IsZero() || bmark.dateAdded.IsZero() || bmark.dateAdded.After(cutoff) {
+		return ""
+	}
+	return "added on " + bmark.dateAdded.Format(time.DateOnly) + ", before -added-after " + cutoff.Format(time.DateOnly)
+}
+
+// filterReason tells if the url is filtered out by -include/-exclude.
+func filterReason(url string) string {
+	if len(includeURLs) > 0 && includeURLs.match(url) == nil {
+		return "doesn't match any -include"
+	}
+	if re := excludeURLs.match(url); re != nil {
+		return "matches -exclude " + re.String()
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package uebarchive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+	"golang.org/x/term"
+)
+
+var (
+	syncEmail          string
+	syncAccountsURL    string
+	syncTokenServerURL string
+
+	// syncAccount is read once, it keeps the storage credentials between reads
+	syncAccount *sources.SyncAccount
+)
+
+// syncTimeout is for a whole read of the bookmarks, they come in a single response
+const syncTimeout = 2 * time.Minute
+
+func syncLoginFlags(fs *flag.FlagSet) {
+	fs.StringVar(&syncEmail, "email", "", "email of the firefox account")
+	fs.StringVar(&syncAccountsURL, "accounts-url", sources.FirefoxAccountsURL, "api `url` of the accounts server, for a self-hosted one")
+	fs.StringVar(&syncTokenServerURL, "token-server-url", sources.SyncTokenServerURL, "`url` of the sync token server, for a self-hosted one")
+}
+
+// runSyncLogin signs in to the firefox account and keeps the session and the sync key
+// in the config directory, for -browser firefox-sync. The password is read from
+// $UEB_SYNC_PASSWORD or the first line of stdin, it's not kept.
+func runSyncLogin(ctx context.Context, _ []string) error {
+	if len(syncEmail) == 0 {
+		return errors.New("-email is required")
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	password, ok := os.LookupEnv("UEB_SYNC_PASSWORD")
+	if !ok {
+		fmt.Fprint(os.Stderr, "password: ")
+		if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+			// not echoed, it's a terminal
+			bs, err := term.ReadPassword(fd)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return fmt.Errorf("read password: %w", err)
+			}
+			password = string(bs)
+		} else {
+			line, err := in.ReadString('\n')
+			if err != nil && len(line) == 0 {
+				return fmt.Errorf("read password: %w", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+	}
+
+	client := &http.Client{Timeout: syncTimeout}
+	signIn, err := sources.SignInSync(ctx, client, syncAccountsURL, syncTokenServerURL, syncEmail, password)
+	if err != nil {
+		return err
+	}
+	if !signIn.Verified {
+		switch signIn.Method {
+		case "totp-2fa":
+			fmt.Fprint(os.Stderr, "code of the authenticator app: ")
+		case "email-otp", "":
+			fmt.Fprintf(os.Stderr, "code sent to %s: ", syncEmail)
+		default:
+			return fmt.Errorf("the sign in must be confirmed with %s, which is not supported", signIn.Method)
+		}
+		code, err := in.ReadString('\n')
+		if err != nil && len(code) == 0 {
+			return fmt.Errorf("read code: %w", err)
+		}
+		if err := signIn.Confirm(ctx, strings.TrimSpace(code)); err != nil {
+			return err
+		}
+	}
+
+	account, err := signIn.Account(ctx)
+	if err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := syncAccountPath()
+	if err := os.MkdirAll(path.Dir(name), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, bs, 0o600); err != nil {
+		return fmt.Errorf("save account: %w", err)
+	}
+	slog.Info("signed in to firefox sync", "email", account.Email, "saved", name)
+	return nil
+}
+
+// syncAccountPath is ~/.config/ueb-archive/firefox-sync.json on linux.
+func syncAccountPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "firefox-sync.json"
+	}
+	return path.Join(dir, "ueb-archive", "firefox-sync.json")
+}
+
+// loadSyncAccount reads the account saved by sync-login.
+func loadSyncAccount() (*sources.SyncAccount, error) {
+	if syncAccount != nil {
+		return syncAccount, nil
+	}
+	bs, err := os.ReadFile(syncAccountPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("not signed in to firefox sync, run \"ueb-archive sync-login -email ...\" first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var account sources.SyncAccount
+	if err := json.Unmarshal(bs, &account); err != nil {
+		return nil, fmt.Errorf("read %s: %w", syncAccountPath(), err)
+	}
+	syncAccount = &account
+	return syncAccount, nil
+}
+
+// readSyncBookmarks reads the -folder bookmarks from the firefox sync server.
+func readSyncBookmarks(ctx context.Context) ([]bookmark, error) {
+	account, err := loadSyncAccount()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "sync", account.Email)
+
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	list, err := sources.FirefoxSyncFolder(ctx, &http.Client{}, account, bookmarksFolder)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
+
+// syncModTime is the last time the synced bookmarks were changed, for watch.
+func syncModTime(ctx context.Context) (time.Time, error) {
+	account, err := loadSyncAccount()
+	if err != nil {
+		return time.Time{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	return sources.SyncModTime(ctx, &http.Client{}, account)
+}
@@ -3,6 +3,14 @@ module github.com/nikonov1101/ueb-archive
 go 1.24.1
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	gopkg.in/ini.v1 v1.67.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/net v0.49.0
+	golang.org/x/sys v0.40.0
+	golang.org/x/term v0.39.0
+	golang.org/x/text v0.33.0
+	google.golang.org/grpc v1.80.0
+	google.golang.org/protobuf v1.36.11
+	gopkg.in/ini.v1 v1.67.0
 )
+
+require google.golang.org/genproto/googleapis/rpc v0.0.0-20260120221211-b8f7ae30c516 // indirect
@@ -0,0 +1,171 @@
+package uebarchive
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/nikonov1101/ueb-archive/uebarchivepb"
+)
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/nikonov1101/ueb-archive --go-grpc_out=. --go-grpc_opt=module=github.com/nikonov1101/ueb-archive archive.proto
+
+var grpcAddr string
+
+// grpcServer implements the Archive service on top of the daemon's queue.
+type grpcServer struct {
+	pb.UnimplementedArchiveServer
+	// ctx is the daemon's, streams end when it stops
+	ctx   context.Context
+	queue chan<- queueRequest
+}
+
+func (s grpcServer) ArchiveURL(req *pb.ArchiveRequest, stream grpc.ServerStreamingServer[pb.ProgressEvent]) error {
+	if err := checkGRPCToken(stream.Context()); err != nil {
+		return err
+	}
+	qreq := queueRequest{URL: req.GetUrl(), Title: req.GetTitle()}
+	if err := qreq.validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// subscribe before the page is queued, not to miss anything; events are
+	// of the bookmark's url, which has no tracking parameters
+	events, unsubscribe := progressEvents.subscribe(newBookmark(qreq.URL, "").url)
+	defer unsubscribe()
+
+	bmark, queued, err := enqueue(s.queue, qreq)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if !queued {
+		return status.Error(codes.ResourceExhausted, "the queue is full, the page is left for the next run")
+	}
+	if err := stream.Send(&pb.ProgressEvent{Stage: pb.ProgressEvent_QUEUED, Id: bmark.hash, Url: bmark.url}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			// the client has gone
+			return stream.Context().Err()
+		case <-s.ctx.Done():
+			return status.Error(codes.Unavailable, "the daemon is stopping")
+		case event := <-events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			if event.Stage == pb.ProgressEvent_DONE || event.Stage == pb.ProgressEvent_FAILED {
+				return nil
+			}
+		}
+	}
+}
+
+// checkGRPCToken makes sure the call has the -queue-token as its "authorization: Bearer <token>"
+// metadata, like pages queued over http; there is no queueing without the token.
+func checkGRPCToken(ctx context.Context) error {
+	if len(queueToken) == 0 {
+		return status.Error(codes.PermissionDenied, "no -queue-token, pages can't be queued")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+queueToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "bad or missing token")
+}
+
+// serveGRPC runs the grpc server, blocks until the context is done.
+func serveGRPC(ctx context.Context, addr string, queue chan<- queueRequest) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serve grpc: %w", err)
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterArchiveServer(srv, grpcServer{ctx: ctx, queue: queue})
+	stop := context.AfterFunc(ctx, srv.GracefulStop)
+	defer stop()
+
+	slog.Info("serving grpc", "addr", ln.Addr())
+	if err := srv.Serve(ln); err != nil {
+		return fmt.Errorf("serve grpc: %w", err)
+	}
+	return nil
+}
+
+// progressEvents lets grpc streams follow bookmarks being archived, by url.
+var progressEvents = &eventBus{subs: make(map[string][]chan *pb.ProgressEvent)}
+
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[string][]chan *pb.ProgressEvent
+}
+
+func (b *eventBus) subscribe(url string) (<-chan *pb.ProgressEvent, func()) {
+	ch := make(chan *pb.ProgressEvent, 64)
+	b.mu.Lock()
+	b.subs[url] = append(b.subs[url], ch)
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subs := b.subs[url]
+		for i := range subs {
+			if subs[i] == ch {
+				b.subs[url] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(b.subs[url]) == 0 {
+			delete(b.subs, url)
+		}
+	}
+}
+
+// publish never blocks, a slow subscriber misses events instead of stalling workers.
+// Subscribers of the bookmark's aliases get them too, they have queued a duplicate.
+func (b *eventBus) publish(bmark bookmark, e *pb.ProgressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, url := range append([]string{bmark.url}, bmark.aliases...) {
+		for _, ch := range b.subs[url] {
+			select {
+			case ch <- e:
+			default:
+				slog.Debug("progress subscriber is too slow, dropping the event", "url", url)
+			}
+		}
+	}
+}
+
+func (b *eventBus) started(bmark bookmark) {
+	b.publish(bmark, &pb.ProgressEvent{Stage: pb.ProgressEvent_DOWNLOADING, Id: bmark.hash, Url: bmark.url})
+}
+
+// finished reports saved files and the outcome of the bookmark.
+func (b *eventBus) finished(bmark bookmark) {
+	meta := bmark.archiveMeta
+	if meta == nil {
+		b.publish(bmark, &pb.ProgressEvent{Stage: pb.ProgressEvent_FAILED, Id: bmark.hash, Url: bmark.url, Error: bmark.failure})
+		return
+	}
+
+	for _, file := range meta.saved {
+		b.publish(bmark, &pb.ProgressEvent{Stage: pb.ProgressEvent_SAVED_FILE, Id: bmark.hash, Url: bmark.url, File: file})
+	}
+	index, _ := meta.index()
+	b.publish(bmark, &pb.ProgressEvent{Stage: pb.ProgressEvent_DONE, Id: bmark.hash, Url: bmark.url, Size: meta.size, Path: index})
+}
@@ -0,0 +1,61 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	hnUser     string
+	hnPassword string
+	hnUpvoted  bool
+)
+
+// addHNStories adds favorite, and optionally upvoted, stories of the -hn-user, see addedSources.
+// A story is both the linked article and the discussion on hn, which is often worth more.
+func addHNStories(ctx context.Context, state *sql.DB) error {
+	transport, err := proxyTransport(defaultFetch.proxy)
+	if err != nil {
+		return err
+	}
+	hn := sources.HackerNews{
+		Client:   &http.Client{Timeout: time.Minute, Transport: transport},
+		User:     hnUser,
+		Password: hnPassword,
+	}
+
+	stories, err := hn.Favorites(ctx)
+	if err != nil {
+		return err
+	}
+	if hnUpvoted {
+		upvoted, err := hn.Upvoted(ctx)
+		if err != nil {
+			return err
+		}
+		stories = append(stories, upvoted...)
+	}
+
+	for _, story := range stories {
+		discussion := newBookmark(story.Discussion, story.Title+" | Hacker News")
+		links := []bookmark{discussion}
+		if story.URL != story.Discussion {
+			links = append(links, newBookmark(story.URL, story.Title))
+		}
+		for _, b := range links {
+			if !story.Posted.IsZero() {
+				b.dateAdded = story.Posted
+			}
+			if err := addBookmark(state, b); err != nil {
+				return err
+			}
+		}
+	}
+	slog.Info("hacker news stories read", "user", hnUser, "stories", len(stories))
+	return nil
+}
@@ -0,0 +1,118 @@
+package uebarchive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/fetch"
+)
+
+// hook commands, run with sh -c
+var (
+	beforeDownloadHook string
+	afterCaptureHook   string
+)
+
+// a hook is given that long, so a stuck one doesn't hold a worker forever
+const hookTimeout = 10 * time.Minute
+
+// hookEnv tells the hook about the bookmark, dir is the capture directory, if any.
+func hookEnv(bmark bookmark, dir string) []string {
+	env := append(os.Environ(),
+		"UEB_URL="+bmark.url,
+		"UEB_TITLE="+bmark.displayTitle(),
+		fmt.Sprintf("UEB_HASH=%d", bmark.hash),
+		"UEB_TAGS="+strings.Join(bmark.tags, ","),
+	)
+	if len(dir) > 0 {
+		env = append(env, "UEB_CAPTURE_DIR="+dir, "UEB_META="+path.Join(dir, "meta.json"))
+	}
+	return env
+}
+
+// runHook runs the hook command, returns its exit status, which is -1 if it didn't run
+// to the end, along with its output for the log.
+func runHook(ctx context.Context, command string, env []string, stdin []byte) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = env
+	cmd.Dir = archiveRoot
+	cmd.Stdin = bytes.NewReader(stdin)
+	fetch.SetProcessGroup(cmd)
+	cmd.Cancel = func() error { return fetch.KillProcessGroup(cmd) }
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if ctx.Err() != nil {
+		return -1, output, ctx.Err()
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), output, nil
+		}
+		return -1, output, err
+	}
+	return 0, output, nil
+}
+
+// vetoedByHook runs the -before-download hook, the bookmark is skipped if it exits
+// with a non-zero status. A hook which couldn't run fails the bookmark instead.
+func vetoedByHook(ctx context.Context, logger *slog.Logger, bmark *bookmark) bool {
+	if len(beforeDownloadHook) == 0 {
+		return false
+	}
+
+	status, output, err := runHook(ctx, beforeDownloadHook, hookEnv(*bmark, ""), nil)
+	logger.Debug("before-download hook finished", "url", bmark.url, "status", status, "output", output)
+	switch {
+	case err != nil:
+		bmark.failure = "before-download hook: " + err.Error()
+		logger.Warn("before-download hook failed", "url", bmark.url, "err", err, "output", output)
+		return true
+	case status != 0:
+		// it's a skip, not a failure: the bookmark may have been archived
+		// by an earlier run, as with skipReason, and keeps that capture.
+		bmark.archiveMeta = loadCapture(*bmark)
+		if bmark.archiveMeta == nil {
+			bmark.failure = fmt.Sprintf("skipped: vetoed by the before-download hook, status=%d", status)
+		}
+		logger.Info("skipping, vetoed by the before-download hook", "url", bmark.url, "status", status, "output", output)
+		return true
+	}
+	return false
+}
+
+// runAfterCaptureHook runs the -after-capture hook with the capture's meta.json on stdin,
+// it's too late to undo the capture, so a failed hook is only a warning.
+func runAfterCaptureHook(ctx context.Context, logger *slog.Logger, bmark bookmark) {
+	if len(afterCaptureHook) == 0 || bmark.archiveMeta == nil {
+		return
+	}
+
+	dir, err := filepath.Abs(path.Join(archiveRoot, bmark.captureDir()))
+	if err != nil {
+		logger.Warn("can't run the after-capture hook", "url", bmark.url, "err", err)
+		return
+	}
+	meta, err := os.ReadFile(path.Join(dir, "meta.json"))
+	if err != nil {
+		logger.Warn("can't run the after-capture hook", "url", bmark.url, "err", err)
+		return
+	}
+
+	status, output, err := runHook(ctx, afterCaptureHook, hookEnv(bmark, dir), meta)
+	if err != nil || status != 0 {
+		logger.Warn("after-capture hook failed", "url", bmark.url, "status", status, "err", err, "output", output)
+		return
+	}
+	logger.Debug("after-capture hook finished", "url", bmark.url, "output", output)
+}
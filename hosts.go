@@ -0,0 +1,83 @@
+package uebarchive
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	perHostDelay   time.Duration
+	perHostWorkers int
+)
+
+// hostLimiter spaces out downloads from the same host across all workers,
+// and caps how many of them may run at once.
+type hostLimiter struct {
+	mu    sync.Mutex
+	delay time.Duration
+	next  map[string]time.Time
+
+	limit  int
+	active map[string]int
+	freed  *sync.Cond
+}
+
+func newHostLimiter(delay time.Duration, limit int) *hostLimiter {
+	h := &hostLimiter{
+		delay:  delay,
+		next:   make(map[string]time.Time),
+		limit:  limit,
+		active: make(map[string]int),
+	}
+	h.freed = sync.NewCond(&h.mu)
+	return h
+}
+
+// acquire blocks until there is less than limit downloads from the host running,
+// the caller must release the host when done.
+func (h *hostLimiter) acquire(host string) {
+	if h == nil || h.limit <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	for h.active[host] >= h.limit {
+		h.freed.Wait()
+	}
+	h.active[host]++
+	h.mu.Unlock()
+}
+
+func (h *hostLimiter) release(host string) {
+	if h == nil || h.limit <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	h.active[host]--
+	if h.active[host] <= 0 {
+		delete(h.active, host)
+	}
+	h.mu.Unlock()
+	h.freed.Broadcast()
+}
+
+// wait blocks until the host may be requested again,
+// and reserves the slot for the caller.
+func (h *hostLimiter) wait(ctx context.Context, host string) error {
+	if h == nil || h.delay <= 0 {
+		return ctx.Err()
+	}
+
+	h.mu.Lock()
+	now := time.Now()
+	at := h.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	h.next[host] = at.Add(h.delay)
+	h.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
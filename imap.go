@@ -0,0 +1,193 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	imapURL      string
+	imapPassword string
+	imapLinks    bool
+)
+
+// the imap table remembers the last message read of the folder,
+// see sources.IMAP.Messages for the validity.
+const imapSchema = `
+create table if not exists imap_folders (
+	folder text primary key,
+	uid_validity integer not null,
+	last_uid integer not null
+);
+`
+
+// emails are bookmarks of mid: urls, of their Message-ID, RFC 2392
+const emailScheme = "mid:"
+
+var emailLinkRe = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+
+// emailActions are words of links which do something just by being opened:
+// unsubscribe, confirm a subscription or an order, log in with a magic link.
+// Anyone may send an email, an article about verifying signatures is rather
+// left out than a stranger's confirmation link opened.
+var emailActions = []string{
+	"unsubscribe", "confirm", "verify", "verification", "activate", "approve",
+	"reject", "decline", "cancel", "opt-out", "optout", "reset", "login", "log in", "signin", "sign in", "magic",
+}
+
+// addIMAPMessages adds new messages of the -imap-url folder, see addedSources:
+// each one is a capture of its own, its html body as the page, or with -imap-links
+// the links of it are added as bookmarks, for newsletters which are just links.
+func addIMAPMessages(ctx context.Context, state *sql.DB) error {
+	u, err := url.Parse(imapURL)
+	if err != nil {
+		return fmt.Errorf("-imap-url: %w", err)
+	}
+	if (u.Scheme != "imap" && u.Scheme != "imaps") || u.User == nil {
+		return errors.New("-imap-url must look like imaps://user@host/folder")
+	}
+	m := sources.IMAP{
+		Addr:     u.Host,
+		TLS:      u.Scheme == "imaps",
+		User:     u.User.Username(),
+		Password: imapPassword,
+		Folder:   strings.Trim(u.Path, "/"),
+	}
+	if len(u.Port()) == 0 && m.TLS {
+		m.Addr += ":993"
+	} else if len(u.Port()) == 0 {
+		m.Addr += ":143"
+	}
+	if len(m.Folder) == 0 {
+		m.Folder = "INBOX"
+	}
+	// the folder is known by the url, without the password if it's there
+	folder := u.Scheme + "://" + u.User.Username() + "@" + m.Addr + "/" + m.Folder
+
+	var validity, last uint32
+	err = state.QueryRow(`select uid_validity, last_uid from imap_folders where folder = ?`, folder).Scan(&validity, &last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read imap state: %w", err)
+	}
+
+	messages, validity, err := m.Messages(ctx, validity, last)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, msg := range messages {
+		email, err := sources.ParseEmail(msg.Raw)
+		if err != nil {
+			slog.Warn("failed to parse the email, skipping", "uid", msg.UID, "err", err)
+		} else {
+			if len(email.MessageID) == 0 {
+				email.MessageID = fmt.Sprintf("%d.%d@%s", validity, msg.UID, u.Hostname())
+			}
+			if email.Date.IsZero() {
+				email.Date = time.Now()
+			}
+			if imapLinks {
+				for _, b := range emailLinks(email) {
+					if err := addBookmark(state, b); err != nil {
+						return err
+					}
+					added++
+				}
+			} else {
+				if err := captureEmail(state, email); err != nil {
+					return err
+				}
+				added++
+			}
+		}
+
+		last = msg.UID
+		_, err = state.Exec(`insert into imap_folders (folder, uid_validity, last_uid) values (?, ?, ?)
+			on conflict (folder) do update set uid_validity=excluded.uid_validity, last_uid=excluded.last_uid`,
+			folder, validity, last)
+		if err != nil {
+			return fmt.Errorf("save imap state: %w", err)
+		}
+	}
+	slog.Info("emails read", "folder", folder, "emails", len(messages), "added", added)
+	return nil
+}
+
+// emailLinks are the web links of the email, without the ones doing something, see emailActions.
+func emailLinks(email sources.Email) []bookmark {
+	var list []bookmark
+	seen := make(map[string]bool)
+	for _, m := range emailLinkRe.FindAllSubmatch(email.HTML, -1) {
+		link := html.UnescapeString(string(m[1]))
+		text := html.UnescapeString(anyTagRe.ReplaceAllString(string(m[2]), " "))
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		if seen[link] || isEmailAction(link, text) {
+			continue
+		}
+		seen[link] = true
+
+		// link texts are "read more" and the like, the meta step takes the page's title
+		b := newBookmark(link, "")
+		b.dateAdded = email.Date
+		b.tags = []string{"email"}
+		list = append(list, b)
+	}
+	return list
+}
+
+func isEmailAction(link, text string) bool {
+	s := strings.ToLower(link + " " + text)
+	for _, action := range emailActions {
+		if strings.Contains(s, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureEmail writes the email as a capture of its mid: url, which is
+// never downloaded, see skipReason, and adds it as a bookmark.
+func captureEmail(state *sql.DB, email sources.Email) error {
+	b := newBookmark(emailScheme+url.PathEscape(email.MessageID), email.Subject)
+	b.dateAdded = email.Date
+	b.tags = []string{"email"}
+
+	page := email.HTML
+	if len(page) == 0 {
+		page = []byte(`<!DOCTYPE html><meta charset="utf-8"><title>` + html.EscapeString(email.Subject) +
+			`</title><pre style="white-space: pre-wrap">` + html.EscapeString(string(email.Text)) + `</pre>`)
+	}
+
+	dir := b.captureDir()
+	if err := os.MkdirAll(path.Join(archiveRoot, dir), 0o700); err != nil {
+		return fmt.Errorf("create capture dir: %w", err)
+	}
+	index := path.Join(dir, "index.html")
+	if err := os.WriteFile(path.Join(archiveRoot, index), page, 0o600); err != nil {
+		return fmt.Errorf("write email: %w", err)
+	}
+	meta := &archiveMeta{saved: []string{index}, archivedAt: time.Now(), httpStatus: 200}
+	meta.files = hashCapturedFiles(meta.saved)
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+	b.archiveMeta = meta
+	if err := writeCaptureMeta(b); err != nil {
+		return err
+	}
+	return addBookmark(state, b)
+}
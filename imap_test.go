@@ -0,0 +1,29 @@
+package uebarchive
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+func TestEmailLinks(t *testing.T) {
+	email := sources.Email{HTML: []byte(`<p>This week:
+		<a href="https://example.com/post?id=1">A post</a>,
+		<a href="https://example.com/post?id=1">A post, again</a>,
+		<a href="mailto:editor@example.com">write to us</a>,
+		<a href="https://example.com/subscription/confirm?token=x">Yes, sign me up</a>,
+		<a href="https://example.com/t/abc">Verify your email</a>,
+		<a href="https://example.com/u/abc">Unsubscribe</a>,
+		<a href="https://example.com/a?x=1&amp;y=2"><b>Read</b> more</a>
+	</p>`)}
+
+	var got []string
+	for _, b := range emailLinks(email) {
+		got = append(got, b.url)
+	}
+	want := []string{"https://example.com/post?id=1", "https://example.com/a?x=1&y=2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
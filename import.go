@@ -0,0 +1,329 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	importFrom      string
+	importSnapshots bool
+)
+
+func importFlags(fs *flag.FlagSet) {
+	fs.StringVar(&importFrom, "from", "", "archivebox, shiori, warc, onetab (its \"export URLs\" text) or x (bookmarked tweets of a data export), guessed by the data directory if empty")
+	fs.BoolVar(&importSnapshots, "snapshots", false, "copy stored snapshots along with the urls, archivebox only")
+}
+
+// importedBookmark is a bookmark from another archive,
+// snapshot is its capture directory over there, if any.
+type importedBookmark struct {
+	bookmark
+	// snapshot is the directory to copy, index is the page
+	// to open, relative to the directory's parent.
+	snapshot string
+	index    string
+	fetched  time.Time
+	// warc is set for pages from a warc file, they are captures already
+	warc *warcRef
+}
+
+// runImport adds urls from an ArchiveBox or shiori data directory, OneTab's or X's export,
+// or pages from warc files, as added bookmarks, and rebuilds the index.
+// The ones without a snapshot are archived by the next run.
+func runImport(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ueb-archive import [flags] <data dir | warc files... | onetab or x export>")
+		return exitCode(2)
+	}
+
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+
+	from := importFrom
+	if len(from) == 0 {
+		from = guessImportSource(args[0])
+	}
+	if from != "warc" && len(args) > 1 {
+		return fmt.Errorf("%s is imported from a single data directory or file", from)
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	var imported []importedBookmark
+	switch from {
+	case "archivebox":
+		imported, err = readArchiveBox(args[0])
+	case "shiori":
+		imported, err = readShiori(args[0])
+	case "warc":
+		imported, err = readWARCs(state, args)
+	case "onetab":
+		imported, err = readOneTab(args[0])
+	case "x":
+		imported, err = readXExport(args[0])
+	default:
+		return fmt.Errorf("can't tell what %s is, set -from archivebox, shiori, warc, onetab or x", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	// no manifest means nothing is archived yet
+	entries, _ := readManifest()
+	archived := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		archived[entry.URL] = true
+	}
+
+	added, snapshots := 0, 0
+	for _, b := range imported {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if archived[b.url] {
+			slog.Debug("already in the archive, skipping", "url", b.url)
+			continue
+		}
+
+		if b.warc != nil {
+			if err := importWARCPage(b); err != nil {
+				slog.Warn("failed to import the page, it will be archived again", "url", b.url, "err", err)
+			} else {
+				snapshots++
+			}
+		} else if importSnapshots && len(b.snapshot) > 0 {
+			if err := importSnapshot(b); err != nil {
+				slog.Warn("failed to import the snapshot, the page will be archived again", "url", b.url, "err", err)
+			} else {
+				snapshots++
+			}
+		}
+		if err := addBookmark(state, b.bookmark); err != nil {
+			return err
+		}
+		added++
+	}
+	slog.Info("imported", "from", from, "found", len(imported), "added", added, "snapshots", snapshots)
+
+	list, _, err := archivedBookmarks(state, nil)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].archiveMeta == nil {
+			list[i].archiveMeta = loadCapture(list[i])
+		}
+	}
+
+	// that's not a run, so it doesn't go to the history
+	return makeArchivePages(ctx, list, order, collectStats(list, time.Now()), state)
+}
+
+func guessImportSource(dataDir string) string {
+	if strings.HasSuffix(dataDir, ".warc") || strings.HasSuffix(dataDir, ".warc.gz") {
+		return "warc"
+	}
+	if looksLikeOneTab(dataDir) {
+		return "onetab"
+	}
+	if looksLikeXExport(dataDir) {
+		return "x"
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(dataDir, name))
+		return err == nil
+	}
+	switch {
+	case exists("shiori.db"):
+		return "shiori"
+	case exists("index.sqlite3"), exists("archive"):
+		return "archivebox"
+	}
+	return ""
+}
+
+// readArchiveBox reads snapshot folders, archive/<timestamp>/index.json,
+// every ArchiveBox version keeps them, whatever the main index is.
+func readArchiveBox(dataDir string) ([]importedBookmark, error) {
+	indexes, err := filepath.Glob(path.Join(dataDir, "archive", "*", "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no snapshots in %s", path.Join(dataDir, "archive"))
+	}
+
+	list := make([]importedBookmark, 0, len(indexes))
+	for _, name := range indexes {
+		bs, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot index: %w", err)
+		}
+		var link archiveBoxLink
+		if err := json.Unmarshal(bs, &link); err != nil || len(link.URL) == 0 {
+			slog.Warn("skipping unreadable snapshot", "path", name, "err", err)
+			continue
+		}
+
+		b := importedBookmark{bookmark: newBookmark(link.URL, link.Title)}
+		// the timestamp is when the url was added, as unix seconds with a dedup suffix
+		if sec, err := strconv.ParseFloat(link.Timestamp, 64); err == nil {
+			b.dateAdded = time.Unix(int64(sec), 0)
+		}
+
+		dir := path.Dir(name)
+		for _, method := range []string{"wget", "singlefile"} {
+			result, ok := lastSucceeded(link.History[method])
+			if !ok {
+				continue
+			}
+			// the index.json may be from anywhere, an output
+			// out of the snapshot is not going to be copied.
+			output := path.Clean(result.Output)
+			if !filepath.IsLocal(filepath.FromSlash(output)) || output == "." {
+				slog.Warn("skipping snapshot output outside of the snapshot", "path", name, "output", result.Output)
+				continue
+			}
+			// wget output is <host>/<path>, single file is a file in the snapshot
+			top, _, _ := strings.Cut(output, "/")
+			b.snapshot = path.Join(dir, top)
+			b.index = output
+			b.fetched, _ = time.Parse(time.RFC3339, result.EndTS)
+			break
+		}
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+func lastSucceeded(results []archiveBoxArchiveResult) (archiveBoxArchiveResult, bool) {
+	for i := len(results) - 1; i >= 0; i-- {
+		if results[i].Status == "succeeded" && len(results[i].Output) > 0 {
+			return results[i], true
+		}
+	}
+	return archiveBoxArchiveResult{}, false
+}
+
+// readShiori reads bookmarks from shiori.db, shiori keeps snapshots
+// in its own format, so only urls are imported.
+func readShiori(dataDir string) ([]importedBookmark, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path.Join(dataDir, "shiori.db")))
+	if err != nil {
+		return nil, fmt.Errorf("open shiori database: %w", err)
+	}
+	defer db.Close()
+
+	// the column got renamed between versions
+	dateColumn := ""
+	for _, name := range []string{"created_at", "modified_at", "modified"} {
+		var n int
+		if err := db.QueryRow(`select count(*) from pragma_table_info('bookmark') where name=?`, name).Scan(&n); err != nil {
+			return nil, fmt.Errorf("query shiori database: %w", err)
+		}
+		if n > 0 {
+			dateColumn = name
+			break
+		}
+	}
+	if len(dateColumn) == 0 {
+		return nil, errors.New("unknown shiori database schema")
+	}
+
+	rows, err := db.Query(`select url, title, ` + dateColumn + ` from bookmark order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("query shiori bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	var list []importedBookmark
+	for rows.Next() {
+		var u, title, date string
+		if err := rows.Scan(&u, &title, &date); err != nil {
+			return nil, fmt.Errorf("query shiori bookmark row: %w", err)
+		}
+
+		b := importedBookmark{bookmark: newBookmark(u, title)}
+		for _, layout := range []string{time.DateTime, time.RFC3339Nano} {
+			if t, err := time.Parse(layout, date); err == nil {
+				b.dateAdded = t
+				break
+			}
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// importSnapshot copies the snapshot into the bookmark's capture directory,
+// and writes its meta.json, as if we've captured it ourselves.
+func importSnapshot(b importedBookmark) error {
+	dir := b.captureDir()
+	to := path.Join(archiveRoot, dir, path.Base(b.snapshot))
+	var saved []string
+	err := filepath.WalkDir(b.snapshot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(b.snapshot, name)
+		if err != nil {
+			return err
+		}
+		if name == b.snapshot {
+			// the snapshot is a single file
+			rel = ""
+		}
+		target := path.Join(to, rel)
+		if err := os.MkdirAll(path.Dir(target), 0o700); err != nil {
+			return err
+		}
+		if err := copyFile(name, target); err != nil {
+			return err
+		}
+		saved = append(saved, path.Join(dir, path.Base(b.snapshot), rel))
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(path.Join(archiveRoot, dir))
+		return err
+	}
+
+	// the page goes first, see archiveMeta.index
+	index := path.Join(dir, b.index)
+	for i := range saved {
+		if saved[i] == index {
+			saved[0], saved[i] = saved[i], saved[0]
+		}
+	}
+	if len(saved) == 0 || saved[0] != index {
+		os.RemoveAll(path.Join(archiveRoot, dir))
+		return fmt.Errorf("no %s in the snapshot", b.index)
+	}
+
+	meta := &archiveMeta{saved: saved, archivedAt: b.fetched}
+	meta.files = hashCapturedFiles(saved)
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+	b.archiveMeta = meta
+	return writeCaptureMeta(b.bookmark)
+}
@@ -0,0 +1,46 @@
+package uebarchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadArchiveBox(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := func(ts, url, output string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, "archive", ts), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		index := `{"url": "` + url + `", "timestamp": "` + ts + `", "history": {"wget": [` +
+			`{"output": "` + output + `", "status": "succeeded", "end_ts": "2024-01-02T03:04:05+00:00"}]}}`
+		if err := os.WriteFile(filepath.Join(dir, "archive", ts, "index.json"), []byte(index), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot("1700000000.0", "https://example.com/", "example.com/index.html")
+	snapshot("1700000001.0", "https://example.com/up", "../../../etc/passwd")
+	snapshot("1700000002.0", "https://example.com/abs", "/etc/passwd")
+	snapshot("1700000003.0", "https://example.com/sneaky", "example.com/../../1700000000.0/x")
+
+	list, err := readArchiveBox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots := make(map[string]string)
+	for _, b := range list {
+		snapshots[b.url] = b.snapshot
+	}
+	if len(snapshots) != 4 {
+		t.Fatalf("got %d bookmarks, want all 4: %v", len(snapshots), snapshots)
+	}
+	if want := filepath.Join(dir, "archive", "1700000000.0", "example.com"); snapshots["https://example.com/"] != want {
+		t.Errorf("got snapshot %q, want %q", snapshots["https://example.com/"], want)
+	}
+	for _, url := range []string{"https://example.com/up", "https://example.com/abs", "https://example.com/sneaky"} {
+		if len(snapshots[url]) > 0 {
+			t.Errorf("%s: got snapshot %q out of its folder, want none", url, snapshots[url])
+		}
+	}
+}
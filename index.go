@@ -0,0 +1,72 @@
+package uebarchive
+
+import (
+	"fmt"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+// makeIndexPage writes the index pages of the list, see index.Write.
+func makeIndexPage(list []bookmark) error {
+	// -group is validated before anything is downloaded
+	group, _ := groupKey(groupBy)
+	entries := make([]index.Entry, 0, len(list))
+	for _, bmark := range list {
+		entries = append(entries, indexEntry(bmark, group))
+	}
+	return index.Write(archiveRoot, entries, pageSize)
+}
+
+// indexEntry is the bookmark as the index shows it, group is nil if -group is not set.
+func indexEntry(bmark bookmark, group func(b bookmark) string) index.Entry {
+	e := index.Entry{
+		Entry:         newManifestEntry(bmark),
+		DisplayTitle:  bmark.displayTitle(),
+		LinkRot:       bmark.linkRot,
+		RefreshFailed: bmark.refreshFailed(),
+		// redirects to https or to a trailing slash are not worth mentioning
+		Redirected: normalizeURL(bookmarkFinalURL(bmark)) != normalizeURL(bmark.url),
+	}
+	if _, ok := bmark.captured(); ok {
+		e.DiskUsage = humanBytes(bmark.diskUsage())
+	}
+	if group != nil {
+		e.Group = group(bmark)
+	}
+	for _, other := range bmark.sameAs {
+		if rel, ok := other.captured(); ok {
+			e.SameAs = append(e.SameAs, index.Capture{Path: rel, Title: other.displayTitle()})
+		}
+	}
+	return e
+}
+
+// groupKey returns a function that names bookmark's group,
+// or nil if grouping is disabled.
+func groupKey(by string) (func(b bookmark) string, error) {
+	switch by {
+	case "":
+		return nil, nil
+	case "month":
+		return func(b bookmark) string { return b.dateAdded.Format("January 2006") }, nil
+	case "domain":
+		return func(b bookmark) string { return b.domain() }, nil
+	case "language":
+		return func(b bookmark) string {
+			if b.archiveMeta == nil {
+				return languageName("")
+			}
+			return languageName(b.archiveMeta.page.lang)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown -group key %q", by)
+	}
+}
+
+// bookmarkFinalURL is where the bookmark's url leads, after redirects.
+func bookmarkFinalURL(bmark bookmark) string {
+	if bmark.archiveMeta == nil || len(bmark.archiveMeta.finalURL()) == 0 {
+		return bmark.url
+	}
+	return bmark.archiveMeta.finalURL()
+}
@@ -0,0 +1,318 @@
+// Package index writes the index pages of the archive: its bookmarks
+// as the manifest has them, and what the run knows on top of that.
+package index
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+const header = `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title></title></head><body><h1>μeb-archive</h1><p><a href="stats.html">stats</a> | <a href="failures.html">failures</a> | <a href="feed.xml">feed</a> | <a href="index.json">json</a></p>`
+
+// Entry is a bookmark of the index.
+type Entry struct {
+	store.Entry
+	// DisplayTitle is the best title there is: the bookmark's, the page's or the url
+	DisplayTitle string
+	// DiskUsage is what the capture takes on the disk, as it's shown
+	DiskUsage string
+	// Group is where the entry goes, see Write
+	Group string
+	// Redirected is set if the FinalURL is another page
+	Redirected bool
+	// SameAs are the captures of other urls with the same canonical url
+	SameAs []Capture
+	// LinkRot says if the original is gone or has changed
+	LinkRot string
+	// RefreshFailed is set if the capture is of an earlier run,
+	// the latest one has failed with the Error
+	RefreshFailed bool
+}
+
+// Capture is a link to the page captured.
+type Capture struct {
+	Path  string
+	Title string
+}
+
+// Write writes the index pages into the archive root, pageSize entries each, 0 for a single page.
+// Entries are grouped by their Group if any of them has one, groups follow the order
+// of their first entry.
+func Write(root string, list []Entry, pageSize int) error {
+	// TODO(nikonov): worker probably should return some metadata about the download:
+	// ok/fail, time taken, files downloaded, its size, etc.
+	// we could show that on the index page as well.
+	pages := paginate(list, pageSize)
+	for n, page := range pages {
+		index := header
+		index += pageNav(n, len(pages))
+		index += renderGroups(page, n*pageSize+1)
+		index += pageNav(n, len(pages))
+		index += "</body></html>"
+
+		if err := os.WriteFile(path.Join(root, PageName(n)), []byte(index), 0o600); err != nil {
+			return fmt.Errorf("write index file: %w", err)
+		}
+	}
+
+	// the archive may have shrunk since the last run, drop pages that are not linked anymore
+	stale, _ := filepath.Glob(path.Join(root, "index-*.html"))
+	for _, name := range stale {
+		var n int
+		if _, err := fmt.Sscanf(filepath.Base(name), "index-%d.html", &n); err == nil && n > len(pages) {
+			_ = os.Remove(name)
+		}
+	}
+
+	return nil
+}
+
+// paginate splits the list into chunks of at most size entries,
+// size <= 0 means everything goes to a single page.
+func paginate(list []Entry, size int) [][]Entry {
+	if size <= 0 || len(list) <= size {
+		return [][]Entry{list}
+	}
+
+	var pages [][]Entry
+	for len(list) > size {
+		pages = append(pages, list[:size])
+		list = list[size:]
+	}
+	if len(list) > 0 {
+		pages = append(pages, list)
+	}
+	return pages
+}
+
+// PageName returns a file name for the n-th (zero-based) index page,
+// the first one is always the index.html.
+func PageName(n int) string {
+	if n == 0 {
+		return "index.html"
+	}
+	return fmt.Sprintf("index-%d.html", n+1)
+}
+
+func pageNav(n, total int) string {
+	if total < 2 {
+		return ""
+	}
+
+	nav := "<p>"
+	if n > 0 {
+		nav += fmt.Sprintf(`<a href="%s">&laquo; prev</a> | `, PageName(n-1))
+	}
+	nav += fmt.Sprintf("page %d of %d", n+1, total)
+	if n < total-1 {
+		nav += fmt.Sprintf(` | <a href="%s">next &raquo;</a>`, PageName(n+1))
+	}
+	nav += "</p>"
+	return nav
+}
+
+type group struct {
+	name string
+	list []Entry
+}
+
+// groupEntries splits the list by the Group, groups follow
+// the order of their first entry, so the sort order is preserved.
+func groupEntries(list []Entry) []group {
+	var groups []group
+	seen := make(map[string]int)
+	for _, e := range list {
+		i, ok := seen[e.Group]
+		if !ok {
+			i = len(groups)
+			seen[e.Group] = i
+			groups = append(groups, group{name: e.Group})
+		}
+		groups[i].list = append(groups[i].list, e)
+	}
+	return groups
+}
+
+// renderGroups renders the list as one or more ordered lists,
+// with a table of contents on top if the entries are grouped.
+// The first entry is numbered as start.
+func renderGroups(list []Entry, start int) string {
+	groups := groupEntries(list)
+	if len(groups) == 1 && len(groups[0].name) == 0 {
+		return renderList(groups[0].list, start)
+	}
+
+	out := "<ul>"
+	for i, g := range groups {
+		out += fmt.Sprintf(`<li><a href="#group-%d">%s</a> (%d)</li>`, i, html.EscapeString(g.name), len(g.list))
+	}
+	out += "</ul>"
+
+	for i, g := range groups {
+		out += fmt.Sprintf(`<h2 id="group-%d">%s</h2>`, i, html.EscapeString(g.name))
+		out += renderList(g.list, 1)
+	}
+	return out
+}
+
+func renderList(list []Entry, start int) string {
+	out := fmt.Sprintf(`<ol start="%d">`, start)
+	for _, e := range list {
+		out += renderEntry(e)
+	}
+	out += "</ol>"
+	return out
+}
+
+func renderEntry(e Entry) string {
+	const newTab = `target="_blank" rel="noopener noreferrer"`
+
+	title := html.EscapeString(e.DisplayTitle)
+
+	entry := fmt.Sprintf(`<li><a href="#">%s | MISSING</a>`, title)
+	if len(e.Path) > 0 {
+		target := FileHref(e.Path)
+		li := "<li>"
+		if len(e.Lang) > 0 {
+			// so the browser picks the fonts and hyphenation for it
+			li = fmt.Sprintf(`<li lang="%s">`, html.EscapeString(e.Lang))
+		}
+		entry = fmt.Sprintf(`%s<a href="%s" %s>%s | OK</a> <small>%s</small>`, li, html.EscapeString(target), newTab, title, e.DiskUsage)
+	}
+	if IsWebURL(e.URL) {
+		entry += fmt.Sprintf(` <small>(<a href="%s" %s>original</a>)</small>`, html.EscapeString(e.URL), newTab)
+	} else {
+		entry += fmt.Sprintf(` <small>(original: %s)</small>`, html.EscapeString(e.URL))
+	}
+	entry += renderBookmarked(e)
+	if e.Redirected {
+		entry += fmt.Sprintf(` <small>redirects to <a href="%s" %s title="%s">%s</a></small>`,
+			html.EscapeString(e.FinalURL), newTab, html.EscapeString(strings.Join(e.Redirects, " → ")), html.EscapeString(e.FinalURL))
+	}
+	for _, alias := range e.Aliases {
+		if !IsWebURL(alias) {
+			entry += fmt.Sprintf(` <small>also bookmarked as %s</small>`, html.EscapeString(alias))
+			continue
+		}
+		entry += fmt.Sprintf(` <small>also bookmarked as <a href="%s" %s>%s</a></small>`, html.EscapeString(alias), newTab, html.EscapeString(alias))
+	}
+	for _, other := range e.SameAs {
+		entry += fmt.Sprintf(` <small>same page as <a href="%s" %s>%s</a></small>`,
+			html.EscapeString(FileHref(other.Path)), newTab, html.EscapeString(other.Title))
+	}
+	if len(e.Wayback) > 0 {
+		entry += fmt.Sprintf(` <small>(<a href="%s" %s>wayback</a>)</small>`, html.EscapeString(e.Wayback), newTab)
+	}
+	if len(e.Recovered) > 0 {
+		entry += " <small>recovered from " + html.EscapeString(e.Recovered) + "</small>"
+	}
+	if e.RefreshFailed {
+		entry += fmt.Sprintf(` <small title="%s">refresh failed, captured %s</small>`,
+			html.EscapeString(e.Error), e.ArchivedAt.Format(time.DateOnly))
+	}
+	if len(e.LinkRot) > 0 {
+		entry += ` <small class="rot">` + html.EscapeString(e.LinkRot) + "</small>"
+	}
+	if len(e.Missing) > 0 {
+		entry += renderMissing(e)
+	}
+	entry += renderPageMeta(e)
+	if len(e.Note) > 0 {
+		entry += `<p class="note">` + strings.ReplaceAll(html.EscapeString(e.Note), "\n", "<br>") + "</p>"
+	}
+	if len(e.Summary) > 0 {
+		entry += `<p class="summary">` + html.EscapeString(e.Summary) + "</p>"
+	}
+	entry += renderTags(e)
+	if len(e.Thumbnail) > 0 {
+		entry += fmt.Sprintf(`<br><img src="%s" width="320" loading="lazy" alt="">`, html.EscapeString(FileHref(e.Thumbnail)))
+	}
+	entry += "</li>"
+	return entry
+}
+
+// renderBookmarked shows when the page was bookmarked, and when the bookmark was edited.
+func renderBookmarked(e Entry) string {
+	if e.DateAdded.IsZero() {
+		return ""
+	}
+	added := e.DateAdded.Format(time.DateOnly)
+	if modified := e.Modified.Format(time.DateOnly); !e.Modified.IsZero() && modified != added {
+		return fmt.Sprintf(` <small title="edited on %s">bookmarked on %s</small>`, modified, added)
+	}
+	return " <small>bookmarked on " + added + "</small>"
+}
+
+// renderMissing shows how complete the capture is, with the missing requisites folded.
+func renderMissing(e Entry) string {
+	complete := 100
+	if e.Requisites > 0 {
+		complete = 100 * (e.Requisites - len(e.Missing)) / e.Requisites
+	}
+	out := fmt.Sprintf(`<details class="incomplete"><summary><small>%d%% complete, %d of %d requisites missing</small></summary><small>`,
+		complete, len(e.Missing), e.Requisites)
+	for _, missing := range e.Missing {
+		out += html.EscapeString(missing) + "<br>"
+	}
+	return out + "</small></details>"
+}
+
+// renderTags lists the bookmark's tags, or the keywords it's tagged with automatically.
+func renderTags(e Entry) string {
+	tags, class := e.Tags, "tags"
+	if len(tags) == 0 {
+		tags, class = e.AutoTags, "tags auto"
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	out := fmt.Sprintf(`<br><small class="%s">`, class)
+	for i, tag := range tags {
+		if i > 0 {
+			out += " "
+		}
+		out += "#" + html.EscapeString(tag)
+	}
+	return out + "</small>"
+}
+
+// renderPageMeta shows a byline and a blurb under the link, if the page has any.
+func renderPageMeta(e Entry) string {
+	var byline []string
+	if !e.Published.IsZero() {
+		byline = append(byline, "published "+e.Published.Format(time.DateOnly))
+	}
+	if len(e.Author) > 0 {
+		byline = append(byline, "by "+e.Author)
+	}
+
+	out := ""
+	if len(byline) > 0 {
+		out += "<br><small>" + html.EscapeString(strings.Join(byline, ", ")) + "</small>"
+	}
+	if len(e.Description) > 0 {
+		out += "<p>" + html.EscapeString(e.Description) + "</p>"
+	}
+	return out
+}
+
+// IsWebURL is true for http and https urls, only those are linked to,
+// a bookmark may be javascript: or anything else.
+func IsWebURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
+
+// FileHref escapes a path relative to the archive root to be used as a link,
+// wget keeps query strings in file names, so there may be a "?" or "%".
+func FileHref(rel string) string {
+	return (&url.URL{Path: rel}).EscapedPath()
+}
@@ -0,0 +1,64 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+func TestRenderEntryOriginal(t *testing.T) {
+	for _, tc := range []struct {
+		url  string
+		link bool
+	}{
+		{"https://example.com/a?b=c", true},
+		{"HTTP://example.com/", true},
+		{"javascript:alert(document.cookie)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"file:///etc/passwd", false},
+	} {
+		entry := renderEntry(Entry{
+			Entry:        store.Entry{URL: tc.url, Aliases: []string{tc.url}},
+			DisplayTitle: "page",
+		})
+		if got := strings.Contains(entry, `>original</a>`); got != tc.link {
+			t.Errorf("%s: original is a link: %v, want %v\n%s", tc.url, got, tc.link, entry)
+		}
+		if !tc.link && strings.Contains(strings.ToLower(entry), `href="`+strings.ToLower(tc.url[:4])) {
+			t.Errorf("%s: linked to\n%s", tc.url, entry)
+		}
+	}
+}
+
+func TestWriteGroups(t *testing.T) {
+	root := t.TempDir()
+	list := []Entry{
+		{Entry: store.Entry{URL: "https://a.example/1"}, DisplayTitle: "one", Group: "a.example"},
+		{Entry: store.Entry{URL: "https://b.example/"}, DisplayTitle: "two", Group: "b.example"},
+		{Entry: store.Entry{URL: "https://a.example/2"}, DisplayTitle: "three", Group: "a.example"},
+	}
+	if err := Write(root, list, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	first := readFile(t, root, PageName(0))
+	if !strings.Contains(first, `<a href="#group-0">a.example</a> (1)`) || !strings.Contains(first, `<a href="#group-1">b.example</a> (1)`) {
+		t.Errorf("want both groups of the first page in its contents\n%s", first)
+	}
+	if second := readFile(t, root, PageName(1)); !strings.Contains(second, "three") || strings.Contains(second, "one") {
+		t.Errorf("want the third entry alone on the second page\n%s", second)
+	}
+}
+
+func readFile(t *testing.T, root, name string) string {
+	t.Helper()
+	bs, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
@@ -0,0 +1,44 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	karakeepURL   string
+	karakeepToken string
+)
+
+// newKarakeep is the -karakeep-url instance.
+func newKarakeep() (sources.Karakeep, error) {
+	if len(karakeepURL) == 0 || len(karakeepToken) == 0 {
+		return sources.Karakeep{}, errors.New("-browser karakeep needs -karakeep-url and -karakeep-token")
+	}
+	return sources.Karakeep{
+		Client: &http.Client{Timeout: time.Minute},
+		URL:    karakeepURL,
+		Token:  karakeepToken,
+	}, nil
+}
+
+// readKarakeepBookmarks reads the links of the Karakeep list named as the -folder.
+func readKarakeepBookmarks(ctx context.Context) ([]bookmark, error) {
+	kk, err := newKarakeep()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "karakeep", karakeepURL, "list", bookmarksFolder)
+
+	list, err := kk.ListBookmarks(ctx, bookmarksFolder)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
@@ -0,0 +1,183 @@
+package uebarchive
+
+import (
+	"cmp"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// autoTagCount is how many keywords untagged captures are tagged with, 0 disables it.
+var autoTagCount = defaultAutoTagCount
+
+const defaultAutoTagCount = 3
+
+const (
+	// shorter words are rarely worth a tag
+	minKeywordLen = 4
+	// a keyword is mentioned a few times, once is by chance
+	minKeywordCount = 2
+	// words kept of a capture, in the index.json and its meta.json
+	maxCaptureWords = 30
+)
+
+// commonWords are too common to be keywords, the stopWords are too.
+var commonWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`
+		about above after again against also although always among another because been before being
+		below between both cannot could does doing down during each either else even ever every from
+		further have having here hers herself himself into itself just last like made make many might
+		more most much must myself never next only other ours ourselves over same several should since
+		some still such than that their theirs them themselves then there these they this those though
+		through under until upon very want well were what when where whether which while will with
+		within without would your yours yourself yourselves first second new one two three read more
+		http https www com html page home menu share comments reply login sign search skip content
+		это этот эта эти того тому тем как так что чтобы для или если когда где там тут при про без
+		над под после перед через между только ещё уже даже очень может можно нужно были было будет
+		быть который которая которые которых свой свои своих наши ваши всех всего весь вся все они
+		она оно его её них нам вам мне тебя себя есть нет ничего также тоже один два три
+	`) {
+		commonWords[w] = true
+	}
+	for _, words := range stopWords {
+		for _, w := range words {
+			commonWords[w] = true
+		}
+	}
+}
+
+// autoTag tags the captures which have no tags of their own with their keywords:
+// the words of their text with the highest tf-idf over the whole archive.
+// A keyword is shared by a few captures at least, so it's there to filter them
+// by, but not by the most of them. The words are counted once, when the page
+// is captured, see captureWords, older captures have theirs counted here
+// and kept in the index.json after that.
+func autoTag(list []bookmark) {
+	if autoTagCount <= 0 {
+		return
+	}
+
+	df := make(map[string]int)
+	n := 0
+	for _, bmark := range list {
+		meta := bmark.archiveMeta
+		if meta == nil {
+			continue
+		}
+		if meta.words == nil {
+			meta.words = captureWords(bmark)
+		}
+		if len(meta.words) == 0 {
+			continue
+		}
+		for word := range meta.words {
+			df[word]++
+		}
+		n++
+	}
+
+	type keyword struct {
+		word  string
+		score float64
+	}
+	for i := range list {
+		meta := list[i].archiveMeta
+		if meta == nil || len(meta.words) == 0 || hasOwnTags(list[i]) {
+			continue
+		}
+		total := 0
+		for _, count := range meta.words {
+			total += count
+		}
+
+		var keywords []keyword
+		for word, count := range meta.words {
+			if df[word] < 2 || df[word]*2 > n {
+				continue
+			}
+			tf := float64(count) / float64(total)
+			keywords = append(keywords, keyword{word, tf * math.Log(float64(n)/float64(df[word]))})
+		}
+		slices.SortFunc(keywords, func(a, b keyword) int {
+			return cmp.Or(cmp.Compare(b.score, a.score), strings.Compare(a.word, b.word))
+		})
+
+		list[i].autoTags = nil
+		for _, kw := range keywords[:min(autoTagCount, len(keywords))] {
+			list[i].autoTags = append(list[i].autoTags, kw.word)
+		}
+	}
+}
+
+// hasOwnTags tells if the bookmark is tagged by the user, ueb: tags are options, not tags.
+func hasOwnTags(bmark bookmark) bool {
+	return slices.ContainsFunc(bmark.tags, func(tag string) bool {
+		return !strings.HasPrefix(strings.TrimSpace(tag), "ueb:")
+	})
+}
+
+// captureWords counts the words of the capture's title and text worth a keyword,
+// the ones mentioned a few times, and keeps the most frequent of them, for autoTag.
+func captureWords(bmark bookmark) map[string]int {
+	text := captureText(bmark)
+	if len(text) == 0 {
+		return nil
+	}
+	type wordCount struct {
+		word  string
+		count int
+	}
+	var counts []wordCount
+	for word, count := range wordCounts(bmark.displayTitle() + "\n" + text) {
+		if count >= minKeywordCount {
+			counts = append(counts, wordCount{word, count})
+		}
+	}
+	slices.SortFunc(counts, func(a, b wordCount) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), strings.Compare(a.word, b.word))
+	})
+
+	words := make(map[string]int)
+	for _, wc := range counts[:min(maxCaptureWords, len(counts))] {
+		words[wc.word] = wc.count
+	}
+	return words
+}
+
+// wordCounts counts the words of the text worth a keyword.
+func wordCounts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if len([]rune(word)) < minKeywordLen || commonWords[word] {
+			continue
+		}
+		counts[word]++
+	}
+	return counts
+}
+
+// captureText is the page's text, see textStep, or the text of the page
+// itself for captures made without it. Empty if it's not an html page.
+func captureText(bmark bookmark) string {
+	if bmark.archiveMeta == nil {
+		return ""
+	}
+	if len(bmark.archiveMeta.text) > 0 {
+		bs, _ := os.ReadFile(path.Join(archiveRoot, bmark.archiveMeta.text))
+		return string(bs)
+	}
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return ""
+	}
+	if ext := strings.ToLower(path.Ext(index)); ext != ".html" && ext != ".htm" {
+		return ""
+	}
+	bs, _ := os.ReadFile(path.Join(archiveRoot, index))
+	return visibleText(string(bs))
+}
@@ -0,0 +1,173 @@
+package uebarchive
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// the text is long enough to tell the language by it
+	minLanguageLetters = 50
+	// a few pages of text are enough, there is no need to count them all
+	maxLanguageRunes = 20000
+	// stop words a latin text must have to tell its language by them
+	minStopWords = 5
+)
+
+var htmlLangRe = regexp.MustCompile(`(?is)<html\b[^>]*>`)
+
+// stopWords are the most frequent words of the languages written in latin,
+// which are rare in the others.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "that", "with", "for", "this", "are", "was", "you", "have", "not", "it"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "eine", "auf", "sich", "den", "auch", "ich", "wir"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "pas", "que", "qui", "dans", "pour", "sur", "avec", "nous"},
+	"es": {"el", "los", "las", "y", "es", "una", "del", "que", "por", "para", "con", "pero", "como", "está", "muy"},
+	"it": {"il", "di", "che", "è", "una", "della", "per", "non", "sono", "gli", "con", "del", "anche", "questo", "nel"},
+	"pt": {"o", "os", "e", "é", "uma", "do", "da", "não", "que", "para", "com", "em", "mais", "como", "você"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "met", "voor", "zijn", "ook", "maar", "wij", "ik"},
+}
+
+// languageNames name the languages detectLanguage tells apart.
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"be": "Belarusian",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// languageName is the language's name for the index, the code itself if it's not known.
+func languageName(code string) string {
+	if len(code) == 0 {
+		return "unknown"
+	}
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// pageLanguage is the page's own idea of its language, the primary subtag of it:
+// <html lang>, the Content-Language meta or og:locale.
+func pageLanguage(page string, tags map[string]string) string {
+	declared := tagAttrs(htmlLangRe.FindString(page))["lang"]
+	if len(declared) == 0 {
+		declared = firstOf(tags, "content-language", "og:locale", "dc.language", "language")
+	}
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	primary, _, _ := strings.Cut(strings.ReplaceAll(declared, "_", "-"), "-")
+	if len(primary) < 2 || len(primary) > 3 {
+		return ""
+	}
+	return primary
+}
+
+// detectLanguage tells the language by the text, by its script or by the stop words
+// of it, the declared one is taken if the text doesn't tell: sites often declare
+// the language of the template, not of the page, so the text goes first.
+func detectLanguage(declared, text string) string {
+	scripts := []struct {
+		table *unicode.RangeTable
+		lang  string
+	}{
+		{unicode.Cyrillic, "ru"},
+		{unicode.Greek, "el"},
+		{unicode.Arabic, "ar"},
+		{unicode.Hebrew, "he"},
+		{unicode.Hangul, "ko"},
+		{unicode.Hiragana, "ja"},
+		{unicode.Katakana, "ja"},
+		{unicode.Han, "zh"},
+		{unicode.Thai, "th"},
+		{unicode.Devanagari, "hi"},
+		{unicode.Latin, ""},
+	}
+
+	counts := make(map[string]int)
+	letters, ukrainian, belarusian := 0, 0, 0
+	n := 0
+	for _, r := range text {
+		if n++; n > maxLanguageRunes {
+			break
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+		switch unicode.ToLower(r) {
+		case 'і', 'ї', 'є', 'ґ':
+			ukrainian++
+		case 'ў':
+			belarusian++
+		}
+	}
+	if letters < minLanguageLetters {
+		return declared
+	}
+
+	script, most := "", 0
+	for _, s := range scripts {
+		if counts[s.lang] > most {
+			script, most = s.lang, counts[s.lang]
+		}
+	}
+	switch {
+	case script == "ru" && belarusian*100 > counts["ru"]:
+		return "be"
+	case script == "ru" && ukrainian*100 > counts["ru"]:
+		// і and the like are about 5% of a ukrainian text, a word or two in a russian one is a quote
+		return "uk"
+	case script == "zh" && counts["ja"] > 0:
+		// japanese is written in kanji too
+		return "ja"
+	case len(script) > 0:
+		return script
+	}
+
+	// latin, and the most of stop words wins
+	hits := make(map[string]int)
+	n = 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if n++; n > maxLanguageRunes/5 {
+			break
+		}
+		for lang, words := range stopWords {
+			for _, w := range words {
+				if w == word {
+					hits[lang]++
+				}
+			}
+		}
+	}
+	best, top := "", 0
+	for lang, count := range hits {
+		if count > top || count == top && lang < best {
+			best, top = lang, count
+		}
+	}
+	if top < minStopWords {
+		return declared
+	}
+	return best
+}
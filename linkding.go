@@ -0,0 +1,75 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	linkdingURL   string
+	linkdingToken string
+	// linkdingWriteBack puts links to the captures into the notes of the bookmarks
+	linkdingWriteBack bool
+)
+
+// newLinkding is the -linkding-url instance.
+func newLinkding() (sources.Linkding, error) {
+	if len(linkdingURL) == 0 || len(linkdingToken) == 0 {
+		return sources.Linkding{}, errors.New("-browser linkding needs -linkding-url and -linkding-token")
+	}
+	return sources.Linkding{
+		Client: &http.Client{Timeout: time.Minute},
+		URL:    linkdingURL,
+		Token:  linkdingToken,
+	}, nil
+}
+
+// readLinkdingBookmarks reads linkding's bookmarks tagged with the -folder,
+// tags are linkding's folders.
+func readLinkdingBookmarks(ctx context.Context) ([]bookmark, error) {
+	ld, err := newLinkding()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "linkding", linkdingURL, "tag", bookmarksFolder)
+
+	list, err := ld.Bookmarks(ctx, bookmarksFolder)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
+
+// writeBackLinkding links the bookmarks captured since the time to their captures,
+// in the notes on linkding, under the -feed-base-url, see archiveLink.
+func writeBackLinkding(ctx context.Context, list []bookmark, since time.Time) {
+	if !slices.Contains(browserNames(), "linkding") {
+		return
+	}
+	ld, err := newLinkding()
+	if err != nil {
+		slog.Warn("failed to write back to linkding", "err", err)
+		return
+	}
+
+	for _, bmark := range list {
+		if len(bmark.sourceID) == 0 || bmark.archiveMeta == nil || bmark.archiveMeta.archivedAt.Before(since) {
+			continue
+		}
+		index, ok := bmark.archiveMeta.index()
+		if !ok {
+			continue
+		}
+		link := archiveLink(index)
+		if err := ld.SetArchiveLink(ctx, bmark.sourceID, link); err != nil {
+			slog.Warn("failed to write back to linkding", "url", bmark.url, "err", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// link_drift keeps how similar the live page was to its capture,
+// when its link was checked last time.
+const linkDriftSchema = `
+create table if not exists link_drift (
+	hash integer primary key,
+	checked_at integer not null,
+	similarity real not null
+);
+`
+
+// pages sharing less than that of their words with the capture are flagged,
+// a redesign or a few new comments keep it well above.
+const driftThreshold = 0.5
+
+var checkLinksEvery time.Duration
+
+var (
+	invisibleRe = regexp.MustCompile(`(?is)<script[^>]*>.*?</script>|<style[^>]*>.*?</style>|<noscript[^>]*>.*?</noscript>|<!--.*?-->`)
+	anyTagRe    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// pageText is the visible text of an html page, more or less.
+func pageText(page string) string {
+	page = invisibleRe.ReplaceAllString(page, " ")
+	return cleanText(anyTagRe.ReplaceAllString(page, " "))
+}
+
+// textSimilarity is the share of words the texts have in common (jaccard index),
+// 1 for the same set of words, 0 for nothing in common.
+func textSimilarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.Fields(strings.ToLower(s)) {
+			set[w] = true
+		}
+		return set
+	}
+
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(wa)+len(wb)-common)
+}
+
+// liveSimilarity downloads the live page and compares its text with the capture.
+func liveSimilarity(ctx context.Context, bmark bookmark, liveURL string) (float64, error) {
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return 0, errors.New("nothing captured")
+	}
+	archived, err := os.ReadFile(path.Join(archiveRoot, index))
+	if err != nil {
+		return 0, fmt.Errorf("read capture: %w", err)
+	}
+
+	opts, err := fetchOptionsFor(bmark.url)
+	if err != nil {
+		return 0, err
+	}
+	transport, err := proxyTransport(opts.proxy)
+	if err != nil {
+		return 0, err
+	}
+	client := &http.Client{Timeout: time.Minute, Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, liveURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", opts.userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	live, err := io.ReadAll(io.LimitReader(resp.Body, pageMetaReadLimit*4))
+	if err != nil {
+		return 0, err
+	}
+
+	return textSimilarity(pageText(string(archived)), pageText(string(live))), nil
+}
+
+// monitorLinks checks original urls of the last run, compares the live pages
+// which are still there with their captures, and rebuilds the index to show it.
+func monitorLinks(ctx context.Context) error {
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	slog.Info("checking links", "urls", len(list))
+	checks := checkLinks(ctx, list)
+	dead, drifted := 0, 0
+	for i, check := range checks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := saveLinkCheck(state, check); err != nil {
+			return err
+		}
+		if check.dead() {
+			dead++
+		}
+		if check.status != http.StatusOK || list[i].archiveMeta == nil {
+			continue
+		}
+
+		similarity, err := liveSimilarity(ctx, list[i], check.finalURL)
+		if err != nil {
+			slog.Debug("can't compare the live page", "url", check.url, "err", err)
+			continue
+		}
+		if similarity < driftThreshold {
+			drifted++
+		}
+		_, err = state.Exec(`insert or replace into link_drift (hash, checked_at, similarity) values (?, ?, ?)`,
+			check.hash, time.Now().Unix(), similarity)
+		if err != nil {
+			return fmt.Errorf("save link drift: %w", err)
+		}
+	}
+	slog.Info("links checked", "urls", len(list), "dead", dead, "drifted", drifted)
+
+	return runReindex(ctx, nil)
+}
+
+// linkRotNotes describes bookmarks whose original is gone or has changed,
+// by url hash, as of the last link check.
+func linkRotNotes(db *sql.DB) (map[int64]string, error) {
+	notes := make(map[int64]string)
+
+	rows, err := db.Query(`select hash, checked_at, status from link_checks where dead`)
+	if err != nil {
+		return nil, fmt.Errorf("query link checks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash, checkedAt int64
+		var status int
+		if err := rows.Scan(&hash, &checkedAt, &status); err != nil {
+			return nil, fmt.Errorf("query link check row: %w", err)
+		}
+		// no status means the host is gone
+		reason := "unreachable"
+		if status > 0 {
+			reason = fmt.Sprintf("status=%d", status)
+		}
+		notes[hash] = fmt.Sprintf("original is gone (%s) as of %s", reason, time.Unix(checkedAt, 0).Format(time.DateOnly))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`select hash, checked_at, similarity from link_drift where similarity < ?`, driftThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("query link drift: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash, checkedAt int64
+		var similarity float64
+		if err := rows.Scan(&hash, &checkedAt, &similarity); err != nil {
+			return nil, fmt.Errorf("query link drift row: %w", err)
+		}
+		if _, ok := notes[hash]; !ok {
+			notes[hash] = fmt.Sprintf("original has changed, %.0f%% similar as of %s", similarity*100, time.Unix(checkedAt, 0).Format(time.DateOnly))
+		}
+	}
+	return notes, rows.Err()
+}
@@ -0,0 +1,129 @@
+package uebarchive
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var (
+	// listLanguages are comma-separated language codes list and search show entries in
+	listLanguages string
+	// listTag is the tag list and search show entries with, auto tags included
+	listTag string
+)
+
+func listFlags(fs *flag.FlagSet) {
+	fs.StringVar(&listLanguages, "lang", "", "only entries of pages in these comma-separated languages, e.g. en,ru, or unknown; empty for all")
+	fs.StringVar(&listTag, "tag", "", "only entries with the `tag`, the keywords untagged ones are tagged with included")
+}
+
+func runList(_ context.Context, _ []string) error {
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	for _, entry := range entries {
+		if listed(entry) {
+			printEntry(entry)
+		}
+	}
+	return nil
+}
+
+// listed tells if the entry has the -tag and its page is in one of -lang languages.
+func listed(entry store.Entry) bool {
+	if len(listTag) > 0 && !slices.Contains(entry.Tags, listTag) && !slices.Contains(entry.AutoTags, listTag) {
+		return false
+	}
+	if len(listLanguages) == 0 {
+		return true
+	}
+	for _, lang := range strings.Split(listLanguages, ",") {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == entry.Lang || lang == "unknown" && len(entry.Lang) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func runSearch(_ context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ueb-archive search <words...>")
+		return exitCode(2)
+	}
+
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	words := make([]string, 0, len(args))
+	for _, arg := range args {
+		words = append(words, strings.ToLower(arg))
+	}
+
+	found := 0
+	for _, entry := range entries {
+		if listed(entry) && matchEntry(entry, words) {
+			printEntry(entry)
+			found++
+		}
+	}
+
+	if found == 0 {
+		// like grep, so it could be used in scripts
+		return exitCode(1)
+	}
+	return nil
+}
+
+// matchEntry checks if every word is present somewhere in the entry
+// metadata or in the page's text, or the saved page itself if it has no text.
+func matchEntry(entry store.Entry, words []string) bool {
+	haystack := strings.ToLower(strings.Join([]string{
+		entry.Title, entry.PageTitle, entry.URL, entry.Description, entry.Author, entry.Note,
+		strings.Join(entry.Tags, " "), strings.Join(entry.AutoTags, " "),
+	}, "\n"))
+
+	var page string
+	for _, word := range words {
+		if strings.Contains(haystack, word) {
+			continue
+		}
+
+		// lazy, most of the time the metadata is enough
+		if len(page) == 0 && len(entry.Path) > 0 {
+			bs, _ := os.ReadFile(path.Join(archiveRoot, cmp.Or(entry.Text, entry.Path)))
+			page = strings.ToLower(string(bs))
+		}
+		if !strings.Contains(page, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func printEntry(entry store.Entry) {
+	title := entry.Title
+	if len(title) == 0 {
+		title = entry.PageTitle
+	}
+
+	fmt.Printf("%-7s %s\n", entry.Status, entry.URL)
+	if len(title) > 0 {
+		fmt.Printf("        %s\n", title)
+	}
+	if len(entry.Path) > 0 {
+		fmt.Printf("        %s\n", path.Join(archiveRoot, entry.Path))
+	}
+}
@@ -0,0 +1,347 @@
+package uebarchive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+const (
+	// assets localized for a single capture at most, a stylesheet may import many
+	maxLocalizedAssets = 200
+	maxLocalizedSize   = 20 << 20
+	// how deep @import chains are followed
+	maxImportDepth = 3
+)
+
+var (
+	cssURLRe    = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+	cssImportRe = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+	styleElemRe = regexp.MustCompile(`(?is)(<style\b[^>]*>)(.*?)(</style\s*>)`)
+	styleAttrRe = regexp.MustCompile(`(?is)(\sstyle\s*=\s*)("[^"]*"|'[^']*')`)
+	// a host with a port keeps the colon, as wget names its directories
+	unsafeHostRe = regexp.MustCompile(`[^a-z0-9.:_-]`)
+)
+
+// localizeStep downloads stylesheets, fonts and images wget has left on other hosts,
+// those referenced by the pages' <link>s and styles and by the stylesheets themselves,
+// and points the references to the local copies, so the page looks right offline.
+// It's off by default, as it fetches from hosts wget wasn't allowed to.
+type localizeStep struct{}
+
+func (localizeStep) name() string { return "localize" }
+
+func (localizeStep) run(ctx context.Context, bmark *bookmark) error {
+	l, err := newLocalizer(bmark)
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range slices.Clone(bmark.archiveMeta.saved) {
+		ext := strings.ToLower(path.Ext(fileName))
+		if ext != ".html" && ext != ".htm" && ext != ".css" {
+			continue
+		}
+		full := path.Join(archiveRoot, fileName)
+		bs, err := os.ReadFile(full)
+		if err != nil {
+			return fmt.Errorf("localize %s: %w", fileName, err)
+		}
+
+		var out string
+		if ext == ".css" {
+			// wget has converted everything it downloaded to relative urls
+			out = l.css(ctx, string(bs), fileName, nil, 0)
+		} else {
+			out = l.html(ctx, string(bs), fileName)
+		}
+		if out == string(bs) {
+			continue
+		}
+		if err := replaceFile(full, []byte(out)); err != nil {
+			return fmt.Errorf("localize %s: %w", fileName, err)
+		}
+	}
+	bmark.archiveMeta.localized += len(l.saved)
+	bmark.archiveMeta.saved = append(bmark.archiveMeta.saved, l.saved...)
+	if len(l.failed) > 0 {
+		return fmt.Errorf("can't download %d of %d assets, the first one %s: %w",
+			len(l.failed), len(l.failed)+len(l.saved), l.failed[0].url, l.failed[0].err)
+	}
+	return nil
+}
+
+type localizeFailure struct {
+	url string
+	err error
+}
+
+type localizer struct {
+	bmark  *bookmark
+	client *http.Client
+	// local are files of downloaded urls, relative to the archive root,
+	// an empty one if the download has failed.
+	local  map[string]string
+	saved  []string
+	failed []localizeFailure
+}
+
+func newLocalizer(bmark *bookmark) (*localizer, error) {
+	transport, err := proxyTransport(bmark.fetch.proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if isFilteredHost(req.URL.Hostname()) || excludedDomain(req.URL.Hostname(), bmark.fetch.excludeDomains) {
+			return fmt.Errorf("redirected to an excluded host %s", req.URL.Hostname())
+		}
+		return nil
+	}
+	// the same cookies wget has been given
+	if cookies := bookmarkCookies(*bmark); len(cookies) > 0 {
+		if client.Jar, err = cookieJar(cookies); err != nil {
+			return nil, err
+		}
+	}
+	return &localizer{
+		bmark:  bmark,
+		local:  make(map[string]string),
+		client: client,
+	}, nil
+}
+
+// html localizes the page's stylesheet links, <style> elements and style attributes.
+func (l *localizer) html(ctx context.Context, page, fileName string) string {
+	page = linkElemRe.ReplaceAllStringFunc(page, func(tag string) string {
+		attrs := tagAttrs(tag)
+		rel := strings.ToLower(attrs["rel"])
+		as := strings.ToLower(attrs["as"])
+		if !strings.Contains(rel, "stylesheet") && !(strings.Contains(rel, "preload") && (as == "font" || as == "style")) {
+			return tag
+		}
+		href := attrs["href"]
+		target, ok := remoteURL(href, nil)
+		if !ok {
+			return tag
+		}
+		local := l.fetch(ctx, target, 0)
+		if len(local) == 0 {
+			return tag
+		}
+		return strings.Replace(tag, href, relativeHref(fileName, local), 1)
+	})
+	page = styleElemRe.ReplaceAllStringFunc(page, func(elem string) string {
+		m := styleElemRe.FindStringSubmatch(elem)
+		return m[1] + l.css(ctx, m[2], fileName, nil, 0) + m[3]
+	})
+	return styleAttrRe.ReplaceAllStringFunc(page, func(attr string) string {
+		m := styleAttrRe.FindStringSubmatch(attr)
+		return m[1] + l.css(ctx, m[2], fileName, nil, 0)
+	})
+}
+
+// css localizes url()s and @imports of the stylesheet saved as fileName, base is
+// the url it's from, to resolve relative references, nil if it's saved by wget.
+func (l *localizer) css(ctx context.Context, css, fileName string, base *url.URL, depth int) string {
+	replace := func(m []string, whole string) string {
+		ref := m[1] + m[2]
+		if len(m) > 3 {
+			ref += m[3]
+		}
+		target, ok := remoteURL(ref, base)
+		if !ok {
+			return whole
+		}
+		local := l.fetch(ctx, target, depth+1)
+		if len(local) == 0 {
+			return whole
+		}
+		return strings.Replace(whole, ref, relativeHref(fileName, local), 1)
+	}
+	css = cssImportRe.ReplaceAllStringFunc(css, func(s string) string {
+		return replace(cssImportRe.FindStringSubmatch(s), s)
+	})
+	return cssURLRe.ReplaceAllStringFunc(css, func(s string) string {
+		return replace(cssURLRe.FindStringSubmatch(s), s)
+	})
+}
+
+// remoteURL resolves the reference, ok is false for anything but an http(s) url
+// of something we should download: local files, data: urls, trackers.
+func remoteURL(ref string, base *url.URL) (*url.URL, bool) {
+	// style attributes have the quotes escaped
+	ref = strings.Trim(strings.TrimSpace(html.UnescapeString(ref)), `"'`)
+	u, err := url.Parse(ref)
+	if err != nil || len(ref) == 0 {
+		return nil, false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || isTrackerURL(u.String(), "") {
+		return nil, false
+	}
+	u.Fragment = ""
+	return u, true
+}
+
+// fetch downloads the url into the capture, stylesheets are localized in turn,
+// returns the file relative to the archive root, or empty if it has failed.
+func (l *localizer) fetch(ctx context.Context, target *url.URL, depth int) string {
+	key := target.String()
+	if local, ok := l.local[key]; ok {
+		return local
+	}
+	l.local[key] = ""
+	if len(l.saved) >= maxLocalizedAssets || depth > maxImportDepth || ctx.Err() != nil {
+		return ""
+	}
+	if excludedDomain(target.Hostname(), l.bmark.fetch.excludeDomains) {
+		return ""
+	}
+
+	body, ctype, err := l.download(ctx, target)
+	if err != nil {
+		l.failed = append(l.failed, localizeFailure{url: key, err: err})
+		return ""
+	}
+	local := assetFileName(l.bmark.captureDir(), target, ctype)
+	if strings.HasSuffix(local, ".css") {
+		// reserved before the imports are fetched, they may import it back
+		l.local[key] = local
+		body = []byte(l.css(ctx, string(body), local, target, depth))
+	}
+
+	full := path.Join(archiveRoot, local)
+	if err := os.MkdirAll(path.Dir(full), 0o700); err == nil {
+		err = replaceFile(full, body)
+	}
+	if err != nil {
+		l.failed = append(l.failed, localizeFailure{url: key, err: err})
+		l.local[key] = ""
+		return ""
+	}
+	l.local[key] = local
+	l.saved = append(l.saved, local)
+	return local
+}
+
+// download fetches the asset the way wget would: with the -header, within the host's
+// limits, and without a Referer, the bookmark's url may be private.
+func (l *localizer) download(ctx context.Context, target *url.URL) ([]byte, string, error) {
+	host := strings.TrimPrefix(strings.ToLower(target.Hostname()), "www.")
+	hosts.acquire(host)
+	defer hosts.release(host)
+	if err := hosts.wait(ctx, host); err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, h := range l.bmark.fetch.headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	// fonts services pick the format by it
+	req.Header.Set("User-Agent", l.bmark.fetch.userAgent)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLocalizedSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > maxLocalizedSize {
+		return nil, "", fmt.Errorf("bigger than %s", humanBytes(maxLocalizedSize))
+	}
+	ctype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return body, ctype, nil
+}
+
+// assetFileName is where the asset goes, host/path in the capture directory as wget
+// would have it, with the query hashed into the name and the extension its type has.
+func assetFileName(dir string, u *url.URL, ctype string) string {
+	p := u.Path
+	if len(p) == 0 || strings.HasSuffix(p, "/") {
+		p += "index"
+	}
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	if len(u.RawQuery) > 0 {
+		sum := sha256.Sum256([]byte(u.RawQuery))
+		base += "-" + hex.EncodeToString(sum[:4])
+	}
+	if ctype == "text/css" {
+		ext = ".css"
+	} else if len(ext) == 0 {
+		if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return path.Join(dir, assetHostDir(u.Host), path.Clean("/"+base+ext))
+}
+
+// assetHostDir is the url host as a safe directory name, a host may have anything
+// in it, even be "..", the url parser doesn't check.
+func assetHostDir(host string) string {
+	host = unsafeHostRe.ReplaceAllString(strings.ToLower(host), "_")
+	if len(strings.Trim(host, ".")) == 0 {
+		return "_"
+	}
+	return host
+}
+
+// excludedDomain tells if the host is in the comma-separated -exclude-domains,
+// or is a subdomain of one, as wget matches them.
+func excludedDomain(host, domains string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range strings.Split(domains, ",") {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if len(domain) > 0 && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeHref links the file from the other one, both relative to the archive root.
+func relativeHref(from, to string) string {
+	rel, err := filepath.Rel(path.Dir(from), to)
+	if err != nil {
+		return index.FileHref(to)
+	}
+	href := index.FileHref(filepath.ToSlash(rel))
+	if first, _, _ := strings.Cut(href, "/"); strings.Contains(first, ":") {
+		// a host with a port would be taken for a scheme
+		href = "./" + href
+	}
+	return href
+}
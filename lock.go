@@ -0,0 +1,79 @@
+package uebarchive
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// the lock file in the archive root, see lockArchive
+const lockFileName = "ueb-archive.lock"
+
+// lockWait is how long to wait for another run to finish, 0 to give up right away.
+var lockWait time.Duration
+
+func lockFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&lockWait, "wait-lock", 0, "wait that long for another run on the same -archive to finish, instead of refusing to start")
+}
+
+// lockArchive makes sure there is one of us writing captures, the index and the state
+// of the archive root: a run started by cron while the previous one is still going
+// gives up, or waits for -wait-lock. The returned func releases the lock.
+func lockArchive(ctx context.Context, name string) (func(), error) {
+	if err := os.MkdirAll(archiveRoot, 0o700); err != nil {
+		return nil, fmt.Errorf("create archive root: %w", err)
+	}
+	f, err := os.OpenFile(path.Join(archiveRoot, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open the lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(lockWait)
+	for waiting := false; ; waiting = true {
+		locked, err := lockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock the archive: %w", err)
+		}
+		if locked {
+			break
+		}
+
+		holder := lockHolder(f)
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("another run is using %s: %s", archiveRoot, holder)
+		}
+		if !waiting {
+			slog.Info("waiting for another run to finish", "holder", holder, "wait", lockWait)
+		}
+		if err := sleep(ctx, time.Second); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	// whoever finds it locked tells who's holding it
+	f.Truncate(0)
+	fmt.Fprintf(f, "pid %d, %s since %s\n", os.Getpid(), name, time.Now().Format(time.DateTime))
+	return func() {
+		f.Truncate(0)
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// lockHolder reads who's holding the lock, as lockArchive has written it.
+func lockHolder(f *os.File) string {
+	bs, _ := io.ReadAll(io.NewSectionReader(f, 0, 1<<10))
+	if holder := strings.TrimSpace(string(bs)); len(holder) > 0 {
+		return holder
+	}
+	return "unknown"
+}
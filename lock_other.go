@@ -0,0 +1,25 @@
+//go:build !unix && !windows
+
+package uebarchive
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile creates a file next to the lock file, which must not exist yet,
+// there is no flock. A crashed run leaves it behind, it's removed by hand then.
+func lockFile(f *os.File) (bool, error) {
+	excl, err := os.OpenFile(f.Name()+".excl", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, excl.Close()
+}
+
+func unlockFile(f *os.File) {
+	os.Remove(f.Name() + ".excl")
+}
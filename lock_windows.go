@@ -0,0 +1,30 @@
+//go:build windows
+
+package uebarchive
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockedByte is where the lock is taken, far past the holder written into the file:
+// windows locks are mandatory, the locked range can't be read by the others.
+const lockedByte = 1 << 30
+
+// lockFile takes an exclusive LockFileEx lock of the file, if it's free. Windows
+// releases it when the process exits, however it exits, so it's never stale.
+func lockFile(f *os.File) (bool, error) {
+	ol := windows.Overlapped{Offset: lockedByte}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) {
+	ol := windows.Overlapped{Offset: lockedByte}
+	windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
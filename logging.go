@@ -0,0 +1,74 @@
+package uebarchive
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+var (
+	verbose   bool
+	quiet     bool
+	logFormat string
+)
+
+func loggingFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verbose, "v", false, "verbose output, including debug messages")
+	fs.BoolVar(&quiet, "quiet", false, "only print warnings and errors, handy for cron")
+	fs.StringVar(&logFormat, "log-format", "text", "log format: text, or json for one object per event")
+}
+
+// setupLogging installs the default slog logger according to -v, -quiet and -log-format.
+func setupLogging() error {
+	level := slog.LevelInfo
+	switch {
+	case verbose:
+		level = slog.LevelDebug
+	case quiet:
+		level = slog.LevelWarn
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch logFormat {
+	case "text":
+		handler = slog.NewTextHandler(console, opts)
+	case "json":
+		handler = slog.NewJSONHandler(console, opts)
+	default:
+		return fmt.Errorf("unknown -log-format %q", logFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// redactArgs hides header values and proxy passwords of a command line before it's logged,
+// those are usually auth tokens and cookies.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && args[i-1] == "--header":
+			arg = redactHeader(arg)
+		case strings.HasPrefix(arg, "--header="):
+			arg = "--header=" + redactHeader(strings.TrimPrefix(arg, "--header="))
+		case strings.Contains(arg, "://") && strings.Contains(arg, "@"):
+			// a proxy url, as wget's -e http_proxy= or chrome's --proxy-server=
+			prefix, rawURL, _ := strings.Cut(arg, "=")
+			if u, err := url.Parse(rawURL); err == nil && u.User != nil {
+				arg = prefix + "=" + u.Redacted()
+			} else if u, err := url.Parse(arg); err == nil && u.User != nil {
+				arg = u.Redacted()
+			}
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+func redactHeader(h string) string {
+	name, _, _ := strings.Cut(h, ":")
+	return name + ": xxxxx"
+}
@@ -0,0 +1,124 @@
+package uebarchive
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var (
+	mailTo       string
+	mailFrom     string
+	smtpAddr     string
+	smtpUser     string
+	smtpPassword string
+)
+
+func mailFlags(fs *flag.FlagSet) {
+	fs.StringVar(&mailTo, "mail-to", "", "comma-separated addresses to email the run summary to")
+	fs.StringVar(&mailFrom, "mail-from", "ueb-archive@localhost", "sender address of the summary email")
+	fs.StringVar(&smtpAddr, "smtp", "localhost:25", "smtp server `host:port`, port 465 means implicit TLS")
+	fs.StringVar(&smtpUser, "smtp-user", "", "smtp username, no authentication if empty")
+	fs.StringVar(&smtpPassword, "smtp-password", "", "smtp password, better set it as UEB_SMTP_PASSWORD")
+}
+
+// mailMessage renders the summary as a plain text email.
+func mailMessage(summary runSummary, to []string) []byte {
+	subject := fmt.Sprintf("ueb-archive: %d archived, %d failed", summary.Archived, summary.Failed)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", mailFrom)
+	fmt.Fprintf(&sb, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&sb, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&sb, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	sb.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+
+	sb.WriteString(summary.Text + "\r\n")
+	if len(summary.Failures) > 0 {
+		sb.WriteString("\r\nfailed:\r\n")
+		for _, e := range summary.Failures {
+			fmt.Fprintf(&sb, "  %s\r\n    %s\r\n", e.URL, e.Error)
+		}
+	}
+	if len(summary.NewCaptures) > 0 {
+		sb.WriteString("\r\nnew captures:\r\n")
+		for _, e := range summary.NewCaptures {
+			fmt.Fprintf(&sb, "  %s\r\n    %s\r\n", e.Title, e.URL)
+		}
+	}
+	return []byte(sb.String())
+}
+
+// sendMail delivers the summary to -mail-to, using STARTTLS if the server offers it.
+func sendMail(ctx context.Context, summary runSummary) error {
+	var to []string
+	for _, addr := range strings.Split(mailTo, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			to = append(to, addr)
+		}
+	}
+
+	host, port, err := net.SplitHostPort(smtpAddr)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if port == "465" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", smtpAddr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", smtpAddr)
+	}
+	if err != nil {
+		return err
+	}
+	// net/smtp knows nothing about contexts
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if len(smtpUser) > 0 {
+		// PlainAuth refuses to send the password over plain text, unless it's localhost
+		if err := c.Auth(smtp.PlainAuth("", smtpUser, smtpPassword, host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(mailFrom); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("rcpt %s: %w", addr, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mailMessage(summary, to)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
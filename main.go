@@ -1,20 +1,32 @@
-package main
+// Package uebarchive is the archiver: it reads bookmarks, downloads them with wget
+// and writes the index pages. Run runs a command of it within another program,
+// cmd/ueb-archive is the command itself, the module root has no main package:
+//
+//	go install github.com/nikonov1101/ueb-archive/cmd/ueb-archive@latest
+package uebarchive
 
 import (
-	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
-	"strings"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"sync"
+	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"gopkg.in/ini.v1"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+	"github.com/nikonov1101/ueb-archive/store"
 )
 
 var (
@@ -28,285 +40,548 @@ var (
 
 	workers       int
 	ffProfileName string
+	dryRun        bool
+	noProgress    bool
+	resume        bool
+	refreshAfter  time.Duration
+
+	sortBy    string
+	sortOrder string
+	pageSize  int
+	groupBy   string
+
+	feedSize    int
+	feedBaseURL string
 )
 
-func init() {
-	flag.StringVar(&archiveRoot, "archive", "/tmp/archive/", "where to store saved web pages")
-	flag.StringVar(&bookmarksFolder, "folder", "archive", "firefox folder name to archive")
-	flag.IntVar(&workers, "workers", 4, "number of paralel downloads")
-	flag.StringVar(&ffProfileName, "profile-name", "Profile0", "firefox profile name, check ~/.mozilla/firefox/profiles.ini")
-	flag.Parse()
-
-	// now it's a convenient version of printf
-	// without a worry about \n at the end.
-	log.SetPrefix("")
-	log.SetFlags(0)
+// Main runs the command of the process arguments and exits, it never returns.
+func Main() {
+	// the first ^C stops the run gracefully, killing wget processes,
+	// the second one kills us right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	err := Run(ctx, os.Args[1:])
+	var code exitCode
+	if err != nil && !errors.As(err, &code) {
+		slog.Error(err.Error())
+	}
+	os.Exit(ExitCode(err))
 }
 
-func main() {
-	dbPath := defaultProfileDB()
-	log.Printf("will read bookmarks from %q", dbPath)
-
-	connstr := fmt.Sprintf("file:%s?immutable=1", dbPath)
-	log.Printf("conn string: %s", connstr)
-	db, err := sql.Open("sqlite3", connstr)
+// Run runs the command of the arguments, as "ueb-archive <args>" would, until it's done
+// or the ctx is canceled, the error tells how it went. Errors which have been reported
+// already, as bad flags or a failed archive run, carry the exit code only, see ExitCode.
+//
+// The flags are package variables, and setting up the logging replaces the default slog logger,
+// so there must be one Run at a time; each one starts from the defaults of the flags though.
+func Run(ctx context.Context, args []string) error {
+	cmd, args, err := lookupCommand(args)
 	if err != nil {
-		panik(err, "open database")
+		return err
 	}
-	defer db.Close()
-
-	started := time.Now()
-	downloads := make(chan *bookmark)
-	wg := &sync.WaitGroup{}
-
-	log.Printf("starting %d workers", workers)
-	wg.Add(workers)
-	for i := range workers {
-		i := i
-		go func() {
-			worker(i, downloads)
-			wg.Done()
-		}()
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: ueb-archive %s [flags] %s\n\n%s\n\n", cmd.name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nany flag can also be set as UEB_<FLAG_NAME> environment variable, e.g. UEB_WORKERS=8\n")
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
 	}
 
-	bookmarksList, err := getBookmarksToSync(db)
+	loggingFlags(fs)
+	configPath, explicit := configPathFromArgs(args)
+	fs.String("config", configPath, "config file, flags take precedence over it")
+	err = applyConfig(fs, cmd.name, configPath, explicit)
+	if err == nil {
+		err = applyEnv(fs)
+	}
 	if err != nil {
-		panik(err, "get bookmarks")
+		fmt.Fprintln(fs.Output(), err)
+		return exitCode(2)
+	}
+	// the flag set has printed the error and the usage
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return exitCode(2)
+	}
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return exitCode(2)
 	}
 
-	for i := range bookmarksList {
-		downloads <- &bookmarksList[i]
+	// wget runs inside the archive root, so any relative
+	// path we pass to it would point to a wrong place.
+	if abs, err := filepath.Abs(archiveRoot); err == nil {
+		archiveRoot = abs
 	}
 
-	close(downloads)
-	wg.Wait()
+	// a dry run only reads, it can look at the archive while another run writes it
+	if cmd.locks && !dryRun {
+		unlock, err := lockArchive(ctx, cmd.name)
+		if err != nil {
+			slog.Error(cmd.name+" failed", "err", err)
+			return exitLocked
+		}
+		defer unlock()
+	}
 
-	makeIndexPage(bookmarksList)
-	log.Printf("done %d urls in %s", len(bookmarksList),
-		time.Since(started).Truncate(time.Second))
+	if err := cmd.run(ctx, fs.Args()); err != nil {
+		return fmt.Errorf("%s failed: %w", cmd.name, err)
+	}
+	return nil
 }
 
-func defaultProfileDB() string {
-	homedir, err := os.UserHomeDir()
-	if err != nil {
-		panik(err, "get user home dir")
+// exitCode is returned by a command that has already reported
+// what's wrong, and only needs to exit with the code.
+type exitCode int
+
+// ExitCode is the code the process running the command should exit with,
+// 1 for errors other than those of Run, and 0 for nil.
+func ExitCode(err error) int {
+	var code exitCode
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &code):
+		return int(code)
+	default:
+		return 1
 	}
+}
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// the archive run has finished, but some bookmarks are not archived
+const exitSomeFailed exitCode = 3
 
-	ffDir := path.Join(homedir, ".mozilla/firefox")
-	ffProfilePath := path.Join(ffDir, "profiles.ini")
+// another run is using the archive, see lockArchive
+const exitLocked exitCode = 4
 
-	log.Printf("reading ff profiles from %s", ffProfilePath)
-	profiles, err := ini.Load(ffProfilePath)
+// runArchive is the main thing: download everything from the bookmarks folder
+// and rebuild the index pages.
+func runArchive(ctx context.Context, _ []string) error {
+	indexOrder, err := bookmarkOrder(sortBy, sortOrder)
 	if err != nil {
-		panik(err, "read profiles.ini from "+ffProfilePath)
+		return err
+	}
+	// fail fast on a typo, rather than after an hour of downloads
+	if _, err := groupKey(groupBy); err != nil {
+		return err
 	}
 
-	profile, err := profiles.GetSection(ffProfileName)
+	bookmarksList, err := readBookmarks(ctx)
 	if err != nil {
-		panik(err, "get profile from ini")
+		return err
 	}
-	profileName, err := profile.GetKey("Name")
-	if err != nil {
-		panik(err, "get .Name section from profile")
+
+	if dryRun {
+		var done map[int64]store.Entry
+		if stateDBExists() {
+			state, err := openStateDB()
+			if err != nil {
+				return err
+			}
+			bookmarksList, err = withAddedBookmarks(state, bookmarksList)
+			if err == nil && resume {
+				done, err = processedBookmarks(state)
+			}
+			state.Close()
+			if err != nil {
+				return err
+			}
+		}
+		printPlan(dedupeBookmarks(bookmarksList), done)
+		return nil
 	}
-	profilePath, err := profile.GetKey("Path")
+
+	if _, err := exec.LookPath("wget"); err != nil {
+		return err
+	}
+
+	state, err := openStateDB()
 	if err != nil {
-		panik(err, "get .Path section from a profile")
+		return err
 	}
+	defer state.Close()
 
-	log.Printf("profile: name: %q; path: %q", profileName, profilePath)
-	return path.Join(ffDir, profilePath.String(), "places.sqlite")
-}
+	addSourceBookmarks(ctx, state)
+	if bookmarksList, err = withAddedBookmarks(state, bookmarksList); err != nil {
+		return err
+	}
+	bookmarksList = dedupeBookmarks(bookmarksList)
 
-type bookmark struct {
-	title string
-	url   string
-	hash  int64
+	var done map[int64]store.Entry
+	if resume {
+		if done, err = processedBookmarks(state); err != nil {
+			return err
+		}
+		slog.Info("resuming the previous run", "processed", len(done))
+	}
+	if len(done) == 0 {
+		if err := resetQueue(state, bookmarksList); err != nil {
+			return err
+		}
+	}
 
-	archiveMeta *archiveMeta
+	err = archiveBookmarks(ctx, state, bookmarksList, done, nil, indexOrder)
+	if err == nil || errors.Is(err, exitSomeFailed) {
+		clearQueue(state)
+	}
+	return err
 }
 
-func (b bookmark) url50() string {
-	if len(b.url) > 50 {
-		return b.url[:50] + "..."
+// archiveBookmarks downloads the list and rebuilds the index pages,
+// bookmarks in done are taken from the previous run as they are,
+// the ones in again are downloaded even if they have a fresh capture.
+func archiveBookmarks(ctx context.Context, state *sql.DB, bookmarksList []bookmark, done map[int64]store.Entry, again map[string]bool, indexOrder func(a, b bookmark) int) error {
+	if err := checkPostSteps(); err != nil {
+		return err
+	}
+	if linkdingWriteBack && len(feedBaseURL) == 0 {
+		// a file:// link to this machine means nothing to linkding's other clients
+		return errors.New("-linkding-write-back needs -feed-base-url, the link in the notes must open elsewhere")
+	}
+	if useCookies {
+		if !slices.Contains(browserNames(), "firefox") {
+			return fmt.Errorf("-cookies needs -browser firefox, cookies of %s are not supported", browser)
+		}
+		profileDir, err := defaultProfileDir()
+		if err != nil {
+			return err
+		}
+		cookiesFile, err = exportCookies(path.Join(profileDir, "cookies.sqlite"))
+		if err != nil {
+			return fmt.Errorf("export cookies: %w", err)
+		}
+		defer os.Remove(cookiesFile)
+	}
+	if len(filterLists) > 0 {
+		var err error
+		filterConfig, err = prepareFilterLists(ctx)
+		if err != nil {
+			return err
+		}
+		defer removeFilterConfigs()
 	}
-	return b.url
-}
 
-type archiveMeta struct {
-	saved    []string
-	execTime time.Duration
+	started := time.Now()
+	downloads := make(chan *bookmark)
+	wg := &sync.WaitGroup{}
 
-	wgetFinished   string
-	wgetDownloaded string
-}
+	prog := newProgress()
+	prog.setTotal(len(bookmarksList))
+	hosts = newHostLimiter(perHostDelay, perHostWorkers)
+	resetRobotsCache()
 
-func (a archiveMeta) index() string {
-	if len(a.saved) == 0 {
-		panic("empty archive referened")
+	slog.Debug("starting workers", "workers", workers)
+	wg.Add(workers)
+	for i := range workers {
+		i := i
+		go func() {
+			worker(ctx, i, downloads, prog, func(bmark *bookmark) {
+				if ctx.Err() != nil && bmark.archiveMeta == nil {
+					// interrupted, leave it for -resume
+					return
+				}
+				markProcessed(state, *bmark)
+			})
+			wg.Done()
+		}()
 	}
-	return a.saved[0]
-}
 
-// getBookmarksToSync read bookmarks from a given folder in a firefox database.
-func getBookmarksToSync(db *sql.DB) ([]bookmark, error) {
-	// exchange folder name to its id, type=2 is folder
-	row := db.QueryRow(`select id from moz_bookmarks where title=? and type=2`, bookmarksFolder)
-	var folderID int64
-	if err := row.Scan(&folderID); err != nil {
-		panik(err, "query moz_bookmarks table")
-	}
-	log.Printf("get bookmarks: got folder id = %v", folderID)
-
-	// get ids of all bookmarks in such folder, type=1 is bookmark,
-	// it is named fk as of foreign key because the fk points to the `moz_places` table
-	rows, err := db.Query(`select fk from moz_bookmarks where parent=? and type=1`, folderID)
-	if err != nil {
-		panik(err, "query bookmarks from a folder")
-	}
+	merged := mergedHashes()
+
+queue:
+	for i := range bookmarksList {
+		if entry, ok := done[bookmarksList[i].hash]; ok {
+			// keep what firefox says now, take the rest from the previous run
+			restored := entryBookmark(entry)
+			restored.title = bookmarksList[i].title
+			restored.dateAdded = bookmarksList[i].dateAdded
+			restored.lastModified = bookmarksList[i].lastModified
+			restored.position = bookmarksList[i].position
+			restored.note = bookmarksList[i].note
+			restored.sourceID = bookmarksList[i].sourceID
+			restored.aliases = bookmarksList[i].aliases
+			restored.merged = bookmarksList[i].merged
+			bookmarksList[i] = restored
+
+			prog.end(-1, 0)
+			continue
+		}
+
+		if merged[bookmarksList[i].hash] && !again[bookmarksList[i].url] {
+			// the run merges it again, as long as the capture is there
+			if meta := loadCapture(bookmarksList[i]); meta != nil {
+				bookmarksList[i].archiveMeta = meta
+				slog.Debug("merged into another entry, keeping the capture", "url", bookmarksList[i].url)
+				prog.end(-1, 0)
+				continue
+			}
+		}
 
-	var fkeys []int64
-	for rows.Next() {
-		var fk int64
-		if err := rows.Scan(&fk); err != nil {
-			panik(err, "query fk row")
+		if meta := freshCapture(bookmarksList[i]); meta != nil && !again[bookmarksList[i].url] {
+			bookmarksList[i].archiveMeta = meta
+			slog.Debug("capture is fresh, keeping it", "url", bookmarksList[i].url, "archived_at", meta.archivedAt)
+			prog.end(-1, 0)
+			continue
+		}
+
+		if reason := skipReason(bookmarksList[i]); len(reason) > 0 {
+			// the bookmark may have been archived by an earlier run
+			bookmarksList[i].archiveMeta = loadCapture(bookmarksList[i])
+			if bookmarksList[i].archiveMeta == nil {
+				bookmarksList[i].failure = "skipped: " + reason
+			}
+			slog.Info("skipping bookmark", "url", bookmarksList[i].url, "reason", reason)
+			progressEvents.finished(bookmarksList[i])
+			prog.end(-1, 0)
+			continue
+		}
+
+		opts, err := fetchOptionsFor(bookmarksList[i].url)
+		if err == nil {
+			err = opts.applyTags(bookmarksList[i].tags)
+		}
+		if err != nil {
+			bookmarksList[i].failure = err.Error()
+			slog.Warn("bad fetch options", "url", bookmarksList[i].url, "err", err)
+			progressEvents.finished(bookmarksList[i])
+			prog.end(-1, 0)
+			continue
+		}
+		bookmarksList[i].fetch = opts
+		select {
+		case downloads <- &bookmarksList[i]:
+		case <-ctx.Done():
+			break queue
 		}
-		fkeys = append(fkeys, fk)
 	}
 
-	log.Printf("get bookmarks: got %d fkeys", len(fkeys))
+	close(downloads)
+	wg.Wait()
+	prog.finish()
 
-	// finaly, we know all the keys we need, let's query the actual bookmarks data:
-	bookmarks := make([]bookmark, len(fkeys))
-	for i, placeid := range fkeys {
-		tmp := &bookmarks[i]
-		row = db.QueryRow(`select title, url_hash, url from moz_places where id=?`, placeid)
-		if err := row.Scan(&tmp.title, &tmp.hash, &tmp.url); err != nil {
-			panik(err, "query moz_places for bookmark details")
+	if ctx.Err() != nil {
+		// the index would show everything not downloaded yet as failed
+		return fmt.Errorf("interrupted, run with -resume to continue: %w", ctx.Err())
+	}
+
+	stats := collectStats(bookmarksList, started)
+	if err := saveRun(state, stats.runRecord); err != nil {
+		// the history is nice to have, the archive itself is fine
+		slog.Warn("failed to save the run", "err", err)
+	}
+	if err := makeArchivePages(ctx, bookmarksList, indexOrder, stats, state); err != nil {
+		return err
+	}
+	if linkdingWriteBack {
+		writeBackLinkding(ctx, bookmarksList, started)
+	}
+	if len(metricsFile) > 0 {
+		if err := writeMetricsFile(stats.runRecord, bookmarksList); err != nil {
+			slog.Warn("failed to write metrics", "err", err)
 		}
 	}
 
-	return bookmarks, nil
+	slog.Info("done", "urls", len(bookmarksList), "failed", stats.failed,
+		"duration", time.Since(started).Truncate(time.Second))
+	printSummary(bookmarksList, stats)
+	notify(ctx, newRunSummary(bookmarksList, stats))
+	if stats.failed > stats.skipped {
+		return exitSomeFailed
+	}
+	return nil
 }
 
-func downloadOne(bmark *bookmark) {
-	started := time.Now()
-	// the classic "linux download web-page" stackoverflow answer, works well for decades
-	logfile := path.Join(archiveRoot, fmt.Sprintf("wget-%d.log", bmark.hash))
-	cmd := exec.Command(
-		"wget",
-		"--verbose",
-		"--page-requisites",
-		"--convert-links",
-		"--adjust-extension",
-		"--no-parent",
-		"-o", logfile,
-		bmark.url,
-	)
-	// pretend to be a simble terminal,
-	// without that, wget weirdly use some sort of
-	// fancy unicode single brackets, which i unable
-	// to just cut with string slicing. so kindly
-	// requesting wget to produce normal ascii stuff.
-	cmd.Env = append(cmd.Env, "TERM=xterm")
-	cmd.Dir = archiveRoot
-
-	if err := cmd.Run(); err != nil {
-		// from "man 1 wget":
-		// > 8   Server issued an error response.
-		//
-		// any 404 returned by any sequential requests (for images, .css, .js, etc)
-		// will lead to this error code, even if we have succesfully downloaded
-		// everyting else, so just ignore this particular code
-		if cmd.ProcessState.ExitCode() != 8 {
-			log.Printf("WARN: wget failed with status=%d, url=%q",
-				cmd.ProcessState.ExitCode(), bmark.url50())
-			return
-		}
+// defaultProfileDir is the directory of the first of the firefox profiles, see browserProfiles.
+func defaultProfileDir() (string, error) {
+	profiles, err := browserProfiles("firefox")
+	if err != nil {
+		return "", err
 	}
+	return path.Dir(profiles[0].file), nil
+}
 
-	meta := parseWgetLog(logfile)
-	meta.execTime = time.Since(started).Truncate(time.Millisecond)
-	bmark.archiveMeta = &meta
+type bookmark struct {
+	title     string
+	url       string
+	hash      int64
+	dateAdded time.Time
+	// lastModified is when the bookmark was last edited in the browser, if it's known
+	lastModified time.Time
+	// position is the bookmark's place in the firefox folder, from 1, 0 if it's not from there
+	position int
+	// note is the description of the bookmark, why it's bookmarked
+	note string
+	// sourceID is the bookmark's id in the -browser, if it's written back to
+	sourceID string
+	fetch    fetchOptions
+	// tags are firefox tags of the bookmark
+	tags []string
+	// autoTags are keywords of the capture's text, if it has no tags, see autoTag
+	autoTags []string
+
+	archiveMeta *archiveMeta
+	// failure describes why the bookmark has no archive, if it does not.
+	failure  string
+	exitCode int
+	// attempts is how many times we tried to download it
+	attempts int
+	// aliases are other urls of the same page, bookmarked as well
+	aliases []string
+	// merged are hashes of bookmarks merged into this one, see mergeSamePage
+	merged []int64
+	// sameAs are bookmarks of other urls with the same canonical url, see linkCanonical
+	sameAs []bookmark
+	// linkRot says if the original is gone or has changed, as of the last link check
+	linkRot string
 }
 
-func worker(n int, downloads <-chan *bookmark) {
-	for bmark := range downloads {
-		downloadOne(bmark)
+// captureDir is where the bookmark's files are saved, relative to the archive root.
+func (b bookmark) captureDir() string {
+	return path.Join("captures", fmt.Sprint(b.hash))
+}
+
+// captured is the index of the bookmark's capture, ok is false if there is none.
+func (b bookmark) captured() (string, bool) {
+	if b.archiveMeta == nil {
+		return "", false
 	}
+	return b.archiveMeta.index()
+}
 
-	log.Printf("worker_%d: exiting", n)
+func (b bookmark) logfile() string {
+	return path.Join(archiveRoot, fmt.Sprintf("wget-%d.log", b.hash))
 }
 
-func makeIndexPage(list []bookmark) error {
-	// TODO(nikonov): worker probably should return some metadata about the download:
-	// ok/fail, time taken, files downloaded, its size, etc.
-	// we could show that on the index page as well.
-	index := `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title></title></head><body><h1>μeb-archive</h1>`
-	index += "<ol>"
-	for _, bmark := range list {
-		target := "#"
-		suffix := "MISSING"
-		if bmark.archiveMeta != nil {
-			target = bmark.archiveMeta.index()
-			suffix = "OK"
-		}
+type archiveMeta struct {
+	saved      []string
+	files      []capturedFile
+	size       int64
+	httpStatus int
+	execTime   time.Duration
+	archivedAt time.Time
 
-		title := bmark.title
-		if len(title) == 0 {
-			// TODO(nikonov): extract from a <title> tag?
-			title = target
-		}
+	wgetFinished   string
+	wgetDownloaded string
+	// requests wget has made, redirects and retries included
+	requests int
+	// statuses counts responses by http status
+	statuses map[int]int
+	// received is the bytes of all responses wget saved
+	received int64
+
+	page pageMeta
+	// requisites wget didn't download because of robots.txt
+	robotsSkipped []string
+	// recovered says where the capture is from, if not from the page itself
+	recovered string
+	// wayback is the web.archive.org snapshot taken along with the capture
+	wayback string
+	// redirects are the urls the bookmark redirected through, the last one is the final url
+	redirects []string
+	// backend has downloaded the capture: wget or chrome
+	backend string
+	// sanitized is how many tracker elements the sanitize step has removed
+	sanitized int
+	// localized is how many fonts, stylesheets and images the localize step has added
+	localized int
+	// requisites the saved pages refer to and the missing ones, see auditStep
+	requisites int
+	missing    []string
+	// thumbnail is the screenshot of the capture, if the thumbnail step is enabled
+	thumbnail string
+	// text is the page's visible text, if the text step is enabled
+	text string
+	// summary is a few sentences on the page, if the summary step is enabled
+	summary string
+	// words are the counts of the text's words worth a keyword, see captureWords
+	words map[string]int
+	// diskSize is what the capture directory takes on the disk, see captureDiskUsage
+	diskSize int64
+}
 
-		// TODO(nikonov):target=blank,noreferrer, etc
-		index += fmt.Sprintf(`<li><a href="%s">%s | %s</a></li>`, target, title, suffix)
+// finalURL is where the page's redirects have ended, empty if it didn't redirect.
+func (a archiveMeta) finalURL() string {
+	if len(a.redirects) == 0 {
+		return ""
 	}
-	index += "</ol></body></html>"
+	return a.redirects[len(a.redirects)-1]
+}
 
-	if err := os.WriteFile(path.Join(archiveRoot, "index.html"), []byte(index), 0o600); err != nil {
-		panik(err, "write index file")
+// index is the page itself, the first file saved, ok is false if there is none.
+func (a archiveMeta) index() (string, bool) {
+	if len(a.saved) == 0 {
+		return "", false
 	}
-
-	return nil
+	return a.saved[0], true
 }
 
-func parseWgetLog(logfile string) archiveMeta {
-	out, err := os.OpenFile(logfile, os.O_RDONLY, 0o600)
+// getBookmarksToSync read bookmarks from a given folder in a firefox database.
+func getBookmarksToSync(ctx context.Context, db *sql.DB) ([]bookmark, error) {
+	list, err := sources.FirefoxFolder(ctx, db, bookmarksFolder)
 	if err != nil {
-		panik(err, "read wget log at "+logfile)
+		return nil, err
 	}
-	defer out.Close()
+	return fromSource(list), nil
+}
 
-	archive := archiveMeta{
-		// no idea, should we measure the average?
-		saved: make([]string, 0, 10),
+// fromSource turns bookmarks as the browser has them into the archive's ones.
+func fromSource(list []sources.Bookmark) []bookmark {
+	bookmarks := make([]bookmark, 0, len(list))
+	for _, b := range list {
+		bookmarks = append(bookmarks, bookmark{
+			title:        b.Title,
+			url:          b.URL,
+			hash:         b.Hash,
+			dateAdded:    b.DateAdded,
+			lastModified: b.LastModified,
+			position:     b.Position + 1,
+			note:         b.Description,
+			sourceID:     b.ID,
+			tags:         b.Tags,
+		})
 	}
+	return bookmarks
+}
 
-	lscan := bufio.NewScanner(out)
-	for lscan.Scan() {
-		line := lscan.Text()
-		// WARN: that's not quite portable
-		if strings.HasPrefix(line, "Saving to: ") {
-			fileName := line[12 : len(line)-1]
-			archive.saved = append(archive.saved, fileName)
-		}
-		if strings.HasPrefix(line, "FINISHED") {
-			line = strings.TrimPrefix(line, "FINISHED")
-			line = strings.ReplaceAll(line, "--", "")
-			archive.wgetFinished = strings.TrimSpace(line)
-		}
-		if strings.HasPrefix(line, "Downloaded:") && len(archive.wgetFinished) > 0 {
-			line = strings.TrimPrefix(line, "Downloaded:")
-			archive.wgetDownloaded = strings.TrimSpace(line)
+// worker downloads bookmarks from the channel, calls processed after each one.
+func worker(ctx context.Context, n int, downloads <-chan *bookmark, prog *progress, processed func(*bookmark)) {
+	logger := slog.With("worker", n)
+	for bmark := range downloads {
+		prog.begin(n, bmark.url)
+		progressEvents.started(*bmark)
+		safeDownload(ctx, logger, bmark)
+		markProgress()
+		processed(bmark)
+		progressEvents.finished(*bmark)
+
+		var size int64
+		if bmark.archiveMeta != nil {
+			size = bmark.archiveMeta.size
 		}
+		prog.end(n, size)
 	}
 
-	return archive
+	slog.Debug("worker exiting", "worker", n)
 }
 
-func panik(err error, msg ...string) {
-	if len(msg) > 0 {
-		panic(msg[0] + ": " + err.Error())
-	}
-	panic(err)
+// safeDownload turns a panic into the bookmark's failure,
+// a bug triggered by one weird page must not take the whole run down.
+func safeDownload(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	defer func() {
+		if r := recover(); r != nil {
+			bmark.archiveMeta = nil
+			bmark.failure = fmt.Sprintf("panic: %v", r)
+			logger.Error("download panicked", "url", bmark.url, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	downloadOne(ctx, logger, bmark)
 }
@@ -0,0 +1,134 @@
+package uebarchive
+
+import (
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+func newManifestEntry(bmark bookmark) store.Entry {
+	entry := store.Entry{
+		Hash:      bmark.hash,
+		Title:     bmark.title,
+		URL:       bmark.url,
+		Status:    "MISSING",
+		DateAdded: bmark.dateAdded,
+		Modified:  bmark.lastModified,
+		Position:  bmark.position,
+		Note:      bmark.note,
+		Aliases:   bmark.aliases,
+		Merged:    bmark.merged,
+		Tags:      bmark.tags,
+		AutoTags:  bmark.autoTags,
+		Error:     bmark.failure,
+		ExitCode:  bmark.exitCode,
+		Attempts:  bmark.attempts,
+	}
+
+	if meta := bmark.archiveMeta; meta != nil {
+		entry.Status = "OK"
+		entry.PageTitle = meta.page.title
+		entry.Description = meta.page.description
+		entry.Image = meta.page.image
+		entry.Author = meta.page.author
+		entry.Published = meta.page.published
+		entry.Canonical = meta.page.canonical
+		entry.Lang = meta.page.lang
+		entry.Path, _ = meta.index()
+		entry.Files = meta.saved
+		entry.Size = meta.size
+		entry.DiskSize = meta.diskSize
+		entry.ArchivedAt = meta.archivedAt
+		entry.FetchTime = meta.execTime.String()
+		entry.HTTPStatus = meta.httpStatus
+		entry.Downloaded = meta.wgetDownloaded
+		entry.Requests = meta.requests
+		entry.Statuses = meta.statuses
+		entry.Received = meta.received
+		entry.RobotsSkipped = meta.robotsSkipped
+		entry.Recovered = meta.recovered
+		entry.Wayback = meta.wayback
+		entry.FinalURL = meta.finalURL()
+		entry.Redirects = meta.redirects
+		entry.Thumbnail = meta.thumbnail
+		entry.Text = meta.text
+		entry.Summary = meta.summary
+		entry.Sanitized = meta.sanitized
+		entry.Localized = meta.localized
+		entry.Requisites = meta.requisites
+		entry.Missing = meta.missing
+		entry.Words = meta.words
+	}
+
+	return entry
+}
+
+// entryBookmark restores what we know about a bookmark from its manifest entry.
+func entryBookmark(e store.Entry) bookmark {
+	bmark := bookmark{
+		title:        e.Title,
+		url:          e.URL,
+		hash:         e.Hash,
+		dateAdded:    e.DateAdded,
+		lastModified: e.Modified,
+		position:     e.Position,
+		note:         e.Note,
+		aliases:      e.Aliases,
+		merged:       e.Merged,
+		tags:         e.Tags,
+		autoTags:     e.AutoTags,
+		failure:      e.Error,
+		exitCode:     e.ExitCode,
+		attempts:     e.Attempts,
+	}
+	if e.Status != "OK" || len(e.Files) == 0 {
+		return bmark
+	}
+
+	execTime, _ := time.ParseDuration(e.FetchTime)
+	bmark.archiveMeta = &archiveMeta{
+		saved:          e.Files,
+		size:           e.Size,
+		diskSize:       e.DiskSize,
+		httpStatus:     e.HTTPStatus,
+		execTime:       execTime,
+		archivedAt:     e.ArchivedAt,
+		wgetDownloaded: e.Downloaded,
+		requests:       e.Requests,
+		statuses:       e.Statuses,
+		received:       e.Received,
+		robotsSkipped:  e.RobotsSkipped,
+		recovered:      e.Recovered,
+		wayback:        e.Wayback,
+		redirects:      e.Redirects,
+		thumbnail:      e.Thumbnail,
+		text:           e.Text,
+		summary:        e.Summary,
+		sanitized:      e.Sanitized,
+		localized:      e.Localized,
+		requisites:     e.Requisites,
+		missing:        e.Missing,
+		words:          e.Words,
+		page: pageMeta{
+			title:       e.PageTitle,
+			description: e.Description,
+			image:       e.Image,
+			author:      e.Author,
+			published:   e.Published,
+			canonical:   e.Canonical,
+			lang:        e.Lang,
+		},
+	}
+	return bmark
+}
+
+// makeManifest writes the index.json next to the index.html,
+// so other tools don't have to scrape the html page.
+func makeManifest(list []bookmark) error {
+	entries := make([]store.Entry, 0, len(list))
+	for _, bmark := range list {
+		entries = append(entries, newManifestEntry(bmark))
+	}
+
+	return store.WriteManifest(archiveRoot, entries)
+}
@@ -0,0 +1,132 @@
+package uebarchive
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var (
+	// inline markdown, escaped in the text
+	markdownInlineRe = regexp.MustCompile("[\\\\`*_\\[\\]<]")
+	// what would start a heading, a list or a quote at the start of a line
+	markdownBlockRe   = regexp.MustCompile(`^(#|[-+>]\s)`)
+	markdownOrderedRe = regexp.MustCompile(`^(\d+)([.)]\s)`)
+)
+
+// exportMarkdown writes a note per archived article into out: the readable text of
+// the page as markdown, with front matter note-taking apps such as Obsidian read.
+func exportMarkdown(ctx context.Context, entries []store.Entry, out string) error {
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", out, err)
+	}
+
+	exported := 0
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bmark := entryBookmark(entry)
+		if bmark.archiveMeta == nil {
+			continue
+		}
+		text, ok, err := readArticle(bmark)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		name := path.Join(out, uniqueSlug(seen, text.title, bmark.hash)+".md")
+		if err := os.WriteFile(name, []byte(markdownNote(bmark, text)), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+		exported++
+	}
+	slog.Info("exported", "format", "markdown", "notes", exported, "out", out)
+	return nil
+}
+
+// markdownNote is the article as markdown, with yaml front matter.
+func markdownNote(bmark bookmark, text article) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	fmt.Fprintf(&sb, "title: %s\n", yamlString(text.title))
+	fmt.Fprintf(&sb, "url: %s\n", yamlString(text.url))
+	added := cmp.Or(bmark.dateAdded, bmark.archiveMeta.archivedAt)
+	fmt.Fprintf(&sb, "date: %s\n", added.Format("2006-01-02"))
+	fmt.Fprintf(&sb, "archived: %s\n", bmark.archiveMeta.archivedAt.Format("2006-01-02T15:04:05Z07:00"))
+	if len(text.author) > 0 {
+		fmt.Fprintf(&sb, "author: %s\n", yamlString(text.author))
+	}
+	if !text.published.IsZero() {
+		fmt.Fprintf(&sb, "published: %s\n", text.published.Format("2006-01-02"))
+	}
+	tags := bmark.tags
+	if len(tags) == 0 {
+		tags = bmark.autoTags
+	}
+	if len(tags) > 0 {
+		sb.WriteString("tags:\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&sb, "  - %s\n", yamlString(tag))
+		}
+	}
+	sb.WriteString("---\n\n")
+
+	fmt.Fprintf(&sb, "# %s\n", markdownText(text.title))
+	list := false
+	for i, block := range text.blocks {
+		heading := len(block.tag) == 2 && block.tag[0] == 'h'
+		if heading && i == 0 && block.text == text.title {
+			continue
+		}
+		if block.tag != "li" || !list {
+			sb.WriteString("\n")
+		}
+		list = block.tag == "li"
+
+		switch {
+		case heading:
+			level := min(int(block.tag[1]-'0')+1, 6)
+			fmt.Fprintf(&sb, "%s %s\n", strings.Repeat("#", level), markdownText(block.text))
+		case block.tag == "li":
+			fmt.Fprintf(&sb, "- %s\n", markdownText(block.text))
+		case block.tag == "blockquote":
+			fmt.Fprintf(&sb, "> %s\n", markdownText(block.text))
+		case block.tag == "pre":
+			fence := "```"
+			for strings.Contains(block.text, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&sb, "%s\n%s\n%s\n", fence, block.text, fence)
+		default:
+			fmt.Fprintf(&sb, "%s\n", markdownText(block.text))
+		}
+	}
+	return sb.String()
+}
+
+// markdownText escapes the plain text, so it's not taken for markup.
+func markdownText(s string) string {
+	s = markdownInlineRe.ReplaceAllString(s, `\$0`)
+	if markdownBlockRe.MatchString(s) {
+		s = `\` + s
+	}
+	return markdownOrderedRe.ReplaceAllString(s, `$1\$2`)
+}
+
+// yamlString is the string double-quoted, go escapes are yaml ones too.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
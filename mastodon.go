@@ -0,0 +1,68 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	mastodonURL        string
+	mastodonToken      string
+	mastodonFavourites bool
+)
+
+// addMastodonStatuses adds statuses bookmarked, and optionally favourited, on -mastodon-url,
+// see addedSources: the status page, rendered by chrome as mastodon is all scripts,
+// and the links of the status, tagged with its hashtags.
+func addMastodonStatuses(ctx context.Context, state *sql.DB) error {
+	transport, err := proxyTransport(defaultFetch.proxy)
+	if err != nil {
+		return err
+	}
+	mastodon := sources.Mastodon{
+		Client: &http.Client{Timeout: time.Minute, Transport: transport},
+		URL:    mastodonURL,
+		Token:  mastodonToken,
+	}
+	statuses, err := mastodon.Bookmarks(ctx)
+	if err != nil {
+		return err
+	}
+	if mastodonFavourites {
+		favourites, err := mastodon.Favourites(ctx)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, favourites...)
+	}
+
+	for _, s := range statuses {
+		// the hashtags are someone else's, a #mirror must not start a mirror,
+		// so they don't look like the tags applyTags takes.
+		var tags []string
+		for _, tag := range s.Tags {
+			tags = append(tags, "mastodon:"+tag)
+		}
+		page := newBookmark(s.URL, excerptTitle(s.Author+": "+s.Text))
+		page.tags = append([]string{"mastodon", chromeTag}, tags...)
+		links := []bookmark{page}
+		for _, link := range s.Links {
+			b := newBookmark(link, "")
+			b.tags = tags
+			links = append(links, b)
+		}
+		for _, b := range links {
+			b.dateAdded = s.Created
+			if err := addBookmark(state, b); err != nil {
+				return err
+			}
+		}
+	}
+	slog.Info("mastodon statuses read", "server", mastodonURL, "statuses", len(statuses))
+	return nil
+}
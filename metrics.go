@@ -0,0 +1,133 @@
+package uebarchive
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var metricsFile string
+
+func metricsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&metricsFile, "metrics-file", "", "write run metrics there in prometheus text format, e.g. for node_exporter's textfile collector")
+}
+
+// renderMetrics formats the run and the archive state in the prometheus text format,
+// everything is a gauge, since each run starts from scratch.
+func renderMetrics(run runRecord, list []bookmark) string {
+	var sb strings.Builder
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	if !run.started.IsZero() {
+		gauge("ueb_archive_last_run_timestamp_seconds", "When the last archive run has started.", run.started.Unix())
+		gauge("ueb_archive_last_run_duration_seconds", "How long the last archive run took.", run.duration.Seconds())
+		gauge("ueb_archive_last_run_bookmarks", "Bookmarks processed by the last run.", run.total)
+		gauge("ueb_archive_last_run_failed_bookmarks", "Bookmarks the last run has failed to archive, skipped ones included.", run.failed)
+		gauge("ueb_archive_last_run_bytes", "Size of captures made by the last run.", run.bytes)
+	}
+
+	type key struct{ domain, status string }
+	counts := make(map[key]int)
+	var size int64
+	var fetchTime time.Duration
+	var fetched int
+	for _, bmark := range list {
+		status := "ok"
+		switch {
+		case bmark.skipped():
+			status = "skipped"
+		case bmark.archiveMeta == nil:
+			status = "failed"
+		default:
+			size += bmark.archiveMeta.size
+			fetchTime += bmark.archiveMeta.execTime
+			fetched++
+		}
+		counts[key{bmark.domain(), status}]++
+	}
+
+	gauge("ueb_archive_size_bytes", "Total size of captures in the archive.", size)
+
+	sb.WriteString("# HELP ueb_archive_bookmarks Bookmarks in the archive by domain and status.\n# TYPE ueb_archive_bookmarks gauge\n")
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b key) int {
+		return cmp.Or(cmp.Compare(a.domain, b.domain), cmp.Compare(a.status, b.status))
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "ueb_archive_bookmarks{domain=%s,status=%q} %d\n", metricsLabel(k.domain), k.status, counts[k])
+	}
+
+	sb.WriteString("# HELP ueb_archive_fetch_duration_seconds Time spent downloading archived bookmarks.\n# TYPE ueb_archive_fetch_duration_seconds summary\n")
+	fmt.Fprintf(&sb, "ueb_archive_fetch_duration_seconds_sum %v\n", fetchTime.Seconds())
+	fmt.Fprintf(&sb, "ueb_archive_fetch_duration_seconds_count %d\n", fetched)
+
+	return sb.String()
+}
+
+// metricsLabel quotes a label value, the format only escapes
+// backslashes, double quotes and newlines, unlike %q.
+func metricsLabel(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// writeMetricsFile replaces the -metrics-file atomically,
+// so the collector never reads a half-written one.
+func writeMetricsFile(run runRecord, list []bookmark) error {
+	tmp, err := os.CreateTemp(filepath.Dir(metricsFile), ".ueb-archive-metrics-*")
+	if err != nil {
+		return fmt.Errorf("create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(renderMetrics(run, list)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	// node_exporter runs as a different user
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	return os.Rename(tmp.Name(), metricsFile)
+}
+
+// serveMetrics exposes the last run and the archive state,
+// taken from the state database and the index.json.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	entries, err := readManifest()
+	if err != nil {
+		slog.Warn("metrics: read manifest", "err", err)
+		http.Error(w, "no manifest, run the archiver first", http.StatusServiceUnavailable)
+		return
+	}
+
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+
+	var last runRecord
+	if stateDBExists() {
+		if state, err := openStateDB(); err == nil {
+			if runs, err := listRuns(state, 1); err == nil && len(runs) > 0 {
+				last = runs[0]
+			}
+			state.Close()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(renderMetrics(last, list)))
+}
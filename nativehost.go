@@ -0,0 +1,225 @@
+package uebarchive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// the name browsers know the native messaging host by
+const nativeHostName = "ueb_archive"
+
+var (
+	daemonURL          string
+	installNativeHost  bool
+	firefoxExtensionID string
+	chromeExtensionID  string
+)
+
+func nativeHostFlags(fs *flag.FlagSet) {
+	fs.StringVar(&daemonURL, "daemon", "http://localhost:8080", "URL of the running daemon")
+	fs.StringVar(&queueToken, "queue-token", "", "the daemon's -queue-token")
+	fs.BoolVar(&installNativeHost, "install", false, "install the native messaging host manifests for firefox and chrome, and exit")
+	fs.StringVar(&firefoxExtensionID, "firefox-extension", "ueb-archive@nikonov1101", "firefox extension id allowed to talk to the host")
+	fs.StringVar(&chromeExtensionID, "chrome-extension", "", "chrome extension id allowed to talk to the host, chrome manifest is not installed if empty")
+}
+
+// queueRequest is what the browser extension sends,
+// it's forwarded to the daemon's /queue as is.
+type queueRequest struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Cookies are the page's cookies, as browser.cookies.getAll() returns them
+	Cookies []browserCookie `json:"cookies,omitempty"`
+}
+
+type browserCookie struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Domain         string  `json:"domain"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HostOnly       bool    `json:"hostOnly"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+}
+
+func (r queueRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+type nativeResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// runNativeHost talks the native messaging protocol over stdin and stdout:
+// every message is a json prefixed by its length as uint32 in the native byte order.
+// The browser starts it with the manifest path (firefox) or the extension origin (chrome)
+// as arguments, see lookupCommand.
+func runNativeHost(ctx context.Context, _ []string) error {
+	if installNativeHost {
+		return installNativeHostManifests()
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		var size uint32
+		if err := binary.Read(in, binary.NativeEndian, &size); err != nil {
+			if errors.Is(err, io.EOF) {
+				// the browser has closed the port
+				return nil
+			}
+			return err
+		}
+		if size > 1<<20 {
+			return fmt.Errorf("message is too big: %d bytes", size)
+		}
+
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(in, msg); err != nil {
+			return err
+		}
+
+		resp := nativeResponse{OK: true}
+		if err := forwardToDaemon(ctx, msg); err != nil {
+			resp = nativeResponse{Error: err.Error()}
+		}
+		if err := writeNativeMessage(os.Stdout, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func forwardToDaemon(ctx context.Context, msg []byte) error {
+	var req queueRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return err
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(daemonURL, "/")+"/queue", bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+queueToken)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("is the daemon running? %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("daemon: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func writeNativeMessage(w io.Writer, v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.NativeEndian, uint32(len(bs))); err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+// isNativeHostInvocation tells if we're started by a browser: firefox passes
+// the path to our manifest, chrome passes the extension origin.
+func isNativeHostInvocation(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	return strings.HasPrefix(args[0], "chrome-extension://") ||
+		filepath.Base(args[0]) == nativeHostName+".json"
+}
+
+// nativeHostManifest tells the browser how to start us and who may talk to us.
+type nativeHostManifest struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Path              string   `json:"path"`
+	Type              string   `json:"type"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+	AllowedOrigins    []string `json:"allowed_origins,omitempty"`
+}
+
+func installNativeHostManifests() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	manifest := nativeHostManifest{
+		Name:        nativeHostName,
+		Description: "ueb-archive, archive the page now",
+		Path:        exe,
+		Type:        "stdio",
+	}
+
+	firefox := manifest
+	firefox.AllowedExtensions = []string{firefoxExtensionID}
+	if err := writeNativeHostManifest(filepath.Join(homedir, ".mozilla/native-messaging-hosts"), firefox); err != nil {
+		return err
+	}
+
+	if len(chromeExtensionID) > 0 {
+		chrome := manifest
+		chrome.AllowedOrigins = []string{"chrome-extension://" + chromeExtensionID + "/"}
+		if err := writeNativeHostManifest(filepath.Join(homedir, ".config/google-chrome/NativeMessagingHosts"), chrome); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeNativeHostManifest(dir string, manifest nativeHostManifest) error {
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	name := filepath.Join(dir, nativeHostName+".json")
+	if err := os.WriteFile(name, bs, 0o644); err != nil {
+		return err
+	}
+	slog.Info("installed native messaging host", "manifest", name)
+	return nil
+}
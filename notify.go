@@ -0,0 +1,135 @@
+package uebarchive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var webhookURL string
+
+func notifyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&webhookURL, "webhook", "", "POST a JSON run summary to that URL after each run")
+	fs.BoolVar(&desktopNotify, "desktop-notify", false, "show a desktop notification when the run finishes")
+	fs.IntVar(&desktopNotifyFailures, "desktop-notify-failures", 0, "only show the desktop notification if at least that many bookmarks failed")
+}
+
+// runSummary is what notifications tell about a finished run,
+// it's sent as is to the -webhook, so be careful with renaming the fields.
+type runSummary struct {
+	// Text is a one-line summary, most chat webhooks show it as the message
+	Text string `json:"text"`
+
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Total    int       `json:"total"`
+	Archived int       `json:"archived"`
+	Failed   int       `json:"failed"`
+	Skipped  int       `json:"skipped"`
+	Bytes    int64     `json:"bytes"`
+
+	NewCaptures []summaryEntry `json:"new_captures"`
+	Failures    []summaryEntry `json:"failures"`
+}
+
+type summaryEntry struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Error string `json:"error,omitempty"`
+}
+
+func newRunSummary(list []bookmark, stats runStats) runSummary {
+	s := runSummary{
+		Started:     stats.started,
+		Duration:    stats.duration.String(),
+		Total:       stats.total,
+		Archived:    stats.total - stats.failed,
+		Failed:      stats.failed - stats.skipped,
+		Skipped:     stats.skipped,
+		Bytes:       stats.bytes,
+		NewCaptures: make([]summaryEntry, 0),
+		Failures:    make([]summaryEntry, 0),
+	}
+	s.Text = fmt.Sprintf("ueb-archive: archived %d of %d bookmarks (%s) in %s, %d failed, %d skipped",
+		s.Archived, s.Total, humanBytes(s.Bytes), s.Duration, s.Failed, s.Skipped)
+
+	for _, bmark := range list {
+		switch {
+		case bmark.archiveMeta == nil && !bmark.skipped() || bmark.refreshFailed():
+			s.Failures = append(s.Failures, summaryEntry{Title: bmark.displayTitle(), URL: bmark.url, Error: bmark.failure})
+		case bmark.archiveMeta != nil && !bmark.archiveMeta.archivedAt.Before(stats.started):
+			// restored and previously skipped captures are older than the run
+			s.NewCaptures = append(s.NewCaptures, summaryEntry{Title: bmark.displayTitle(), URL: bmark.url})
+		}
+	}
+	return s
+}
+
+// notify sends the summary everywhere it's asked to, a failed
+// notification is only a warning, the archive itself is fine.
+func notify(ctx context.Context, summary runSummary) {
+	if len(webhookURL) > 0 {
+		if err := postWebhook(ctx, webhookURL, summary); err != nil {
+			slog.Warn("webhook failed", "host", webhookHost(webhookURL), "err", err)
+		}
+	}
+	if len(mailTo) > 0 {
+		if err := sendMail(ctx, summary); err != nil {
+			slog.Warn("summary email failed", "to", mailTo, "smtp", smtpAddr, "err", err)
+		}
+	}
+	if desktopNotify && summary.Failed >= desktopNotifyFailures {
+		if err := desktopNotification(ctx, summary); err != nil {
+			slog.Warn("desktop notification failed", "err", err)
+		}
+	}
+}
+
+// webhookHost is what's logged of the webhook url, the rest of it
+// is usually a secret token.
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(unparsable url)"
+	}
+	return u.Host
+}
+
+func postWebhook(ctx context.Context, webhook string, summary runSummary) error {
+	bs, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// it has the whole url in it
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package uebarchive
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// readOneTab reads OneTab's "export URLs" text: "url | title" lines,
+// tab groups are separated by blank lines.
+func readOneTab(name string) ([]importedBookmark, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []importedBookmark
+	added := time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		// the title may have " | " too, the url can't
+		link, title, _ := strings.Cut(line, " | ")
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		b := importedBookmark{bookmark: newBookmark(link, strings.TrimSpace(title))}
+		// added bookmarks are ordered by the date, keep them in the order of the export
+		b.dateAdded = added.Add(time.Duration(len(list)) * time.Microsecond)
+		list = append(list, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no urls in %s", name)
+	}
+	return list, nil
+}
+
+// looksLikeOneTab tells if the file starts as OneTab's export does, with an "url | title" line.
+func looksLikeOneTab(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			return strings.HasPrefix(line, "http") && strings.Contains(line, " | ")
+		}
+	}
+	return false
+}
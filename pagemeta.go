@@ -0,0 +1,151 @@
+package uebarchive
+
+import (
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// the <head> is usually somewhere at the beginning,
+// no need to read a whole multi-megabyte page.
+const pageMetaReadLimit = 1 << 20
+
+var (
+	titleRe     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaTagRe   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	linkTagRe   = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	tagAttrRe   = regexp.MustCompile(`(?s)([a-zA-Z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	spaceRunsRe = regexp.MustCompile(`\s+`)
+)
+
+// pageMeta is what we've managed to find in the downloaded page.
+type pageMeta struct {
+	title       string
+	description string
+	image       string
+	author      string
+	published   time.Time
+	// canonical is the url the page says it's the copy of, absolute
+	canonical string
+	// lang is the language code of the page, see detectLanguage
+	lang string
+}
+
+// parsePageMeta reads an html file downloaded from pageURL and extracts its metadata,
+// it's not a real html parser, but good enough for the <head>.
+func parsePageMeta(fileName, pageURL string) pageMeta {
+	var meta pageMeta
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return meta
+	}
+	defer f.Close()
+
+	bs, err := io.ReadAll(io.LimitReader(f, pageMetaReadLimit))
+	if err != nil {
+		return meta
+	}
+	page := string(bs)
+
+	if m := titleRe.FindStringSubmatch(page); m != nil {
+		meta.title = cleanText(m[1])
+	}
+
+	tags := metaTags(page)
+	if len(meta.title) == 0 {
+		meta.title = tags["og:title"]
+	}
+	meta.description = firstOf(tags, "description", "og:description", "twitter:description")
+	meta.image = firstOf(tags, "og:image", "og:image:url", "twitter:image")
+	meta.author = firstOf(tags, "author", "article:author", "dc.creator", "twitter:creator")
+	meta.published = parsePublished(firstOf(tags, "article:published_time", "og:published_time", "date", "dc.date", "pubdate"))
+	meta.canonical = canonicalURL(page, pageURL)
+	meta.lang = detectLanguage(pageLanguage(page, tags), pageText(page))
+
+	return meta
+}
+
+// canonicalURL is the <link rel="canonical"> of the page resolved against its url,
+// empty if there is none.
+func canonicalURL(page, pageURL string) string {
+	for _, tag := range linkTagRe.FindAllString(page, -1) {
+		attrs := tagAttrs(tag)
+		if !slices.Contains(strings.Fields(strings.ToLower(attrs["rel"])), "canonical") {
+			continue
+		}
+		base, err := url.Parse(pageURL)
+		if err != nil {
+			return ""
+		}
+		ref, err := base.Parse(cleanText(attrs["href"]))
+		if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+			return ""
+		}
+		return ref.String()
+	}
+	return ""
+}
+
+func firstOf(tags map[string]string, names ...string) string {
+	for _, name := range names {
+		if v := tags[name]; len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// parsePublished tries a few formats sites actually use,
+// returns zero time if none matches.
+func parsePublished(s string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04:05Z0700", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// metaTags collects <meta name|property|http-equiv="..." content="..."> pairs,
+// names are lower-cased, the first occurrence wins.
+func metaTags(page string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range metaTagRe.FindAllString(page, -1) {
+		attrs := tagAttrs(tag)
+		name := attrs["name"]
+		if len(name) == 0 {
+			name = attrs["property"]
+		}
+		if len(name) == 0 {
+			name = attrs["http-equiv"]
+		}
+		name = strings.ToLower(name)
+		if len(name) == 0 {
+			continue
+		}
+		if _, ok := tags[name]; !ok {
+			tags[name] = cleanText(attrs["content"])
+		}
+	}
+	return tags
+}
+
+func tagAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range tagAttrRe.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+// cleanText unescapes html entities and collapses whitespace.
+func cleanText(s string) string {
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(spaceRunsRe.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,302 @@
+package uebarchive
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+// browser is where the bookmarks are read from: firefox's profile, its sync server
+// a profile of a chromium browser, qutebrowser's files, a text browser's one, buku's database,
+// a linkding or Karakeep instance.
+// It may be several of them, comma-separated, see browserNames.
+var browser = defaultBrowser
+
+const defaultBrowser = "firefox"
+
+// allProfiles reads bookmarks of all profiles of firefox or a chromium -browser, not the -profile-name ones.
+var allProfiles bool
+
+// browsers are the -browser values, see readBookmarks.
+const browsers = "firefox, firefox-sync, chrome, chromium, brave, edge, vivaldi, qutebrowser, lynx, w3m, elinks, buku, linkding, karakeep"
+
+// browserNames are the -browser values, it's empty if there are only -url-file ones.
+func browserNames() []string {
+	var names []string
+	for name := range strings.SplitSeq(browser, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// readBookmarks reads the -folder bookmarks of the -browser ones, and the -url-file urls.
+// When there are several sources, the bookmarks are tagged with theirs, source:firefox and so on,
+// the same urls of different sources are merged by dedupeBookmarks later.
+func readBookmarks(ctx context.Context) ([]bookmark, error) {
+	names := browserNames()
+	if len(names)+len(urlFiles) == 0 {
+		return nil, errors.New("nothing to read bookmarks from, set -browser or -url-file")
+	}
+	several := len(names)+len(urlFiles) > 1
+
+	var list []bookmark
+	add := func(source string, bookmarks []bookmark) {
+		if several {
+			for i := range bookmarks {
+				bookmarks[i].tags = append(bookmarks[i].tags, "source:"+source)
+			}
+		}
+		list = append(list, bookmarks...)
+	}
+	for _, name := range names {
+		bookmarks, err := readBrowserBookmarks(ctx, name)
+		if err != nil {
+			if several {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return nil, err
+		}
+		add(name, bookmarks)
+	}
+	for _, name := range urlFiles {
+		bookmarks, err := readURLFile(name)
+		if err != nil {
+			return nil, err
+		}
+		add(filepath.Base(name), bookmarks)
+	}
+	return list, nil
+}
+
+// readBrowserBookmarks reads the -folder bookmarks of one of the -browser ones.
+func readBrowserBookmarks(ctx context.Context, name string) ([]bookmark, error) {
+	switch {
+	case name == "firefox":
+		return readPlacesBookmarks(ctx)
+	case name == "firefox-sync":
+		return readSyncBookmarks(ctx)
+	case sources.IsChromium(name):
+		return readChromiumBookmarks(name)
+	case name == "qutebrowser":
+		return readQutebrowserBookmarks()
+	case slices.Contains(sources.TextBrowsers, name):
+		return readTextBrowserBookmarks(name)
+	case name == "buku":
+		return readBukuBookmarks(ctx)
+	case name == "linkding":
+		return readLinkdingBookmarks(ctx)
+	case name == "karakeep":
+		return readKarakeepBookmarks(ctx)
+	default:
+		return nil, fmt.Errorf("unknown -browser %q, have: %s", name, browsers)
+	}
+}
+
+// readChromiumBookmarks reads the -folder bookmarks of the chromium browser's profiles,
+// they all keep them in the same Bookmarks file.
+func readChromiumBookmarks(name string) ([]bookmark, error) {
+	return readProfiles(name, func(p browserProfile) ([]bookmark, error) {
+		slog.Info("reading bookmarks", "file", p.file)
+		list, err := sources.ChromiumFolder(p.file, bookmarksFolder)
+		if err != nil {
+			return nil, fmt.Errorf("get bookmarks: %w", err)
+		}
+		return fromSource(list), nil
+	})
+}
+
+// readQutebrowserBookmarks reads all of qutebrowser's bookmarks and quickmarks,
+// it has no folders, so there is no -folder to pick.
+func readQutebrowserBookmarks() ([]bookmark, error) {
+	dir, err := sources.QutebrowserDir()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "dir", dir)
+
+	list, err := sources.QutebrowserBookmarks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
+
+// readTextBrowserBookmarks reads all bookmarks of lynx, w3m or elinks,
+// their sections aren't folders firefox would have, so there is no -folder either.
+func readTextBrowserBookmarks(name string) ([]bookmark, error) {
+	fileName, err := sources.TextBrowserFile(name)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "file", fileName)
+
+	list, err := sources.TextBrowserBookmarks(name, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
+
+// readBukuBookmarks reads buku's bookmarks tagged with the -folder, with their tags,
+// buku has no folders, its tags stand for them, as linkding's do.
+func readBukuBookmarks(ctx context.Context) ([]bookmark, error) {
+	dbPath, err := sources.BukuDB()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("reading bookmarks", "db", dbPath, "tag", bookmarksFolder)
+
+	list, err := sources.BukuBookmarks(ctx, dbPath, bookmarksFolder)
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	return fromSource(list), nil
+}
+
+// browserProfile is a profile of firefox or a chromium browser,
+// file is its places.sqlite or Bookmarks.
+type browserProfile struct {
+	name string
+	file string
+}
+
+// browserProfiles are the browser's -profile-name profiles, which may be comma-separated, or all of them
+// with -all-profiles. The default -profile-name is firefox's, it's Default for chromium browsers.
+func browserProfiles(browser string) ([]browserProfile, error) {
+	var list []browserProfile
+	switch {
+	case browser == "firefox" && allProfiles:
+		profiles, err := sources.FirefoxProfiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range profiles {
+			list = append(list, browserProfile{name: p.Name, file: path.Join(p.Dir, "places.sqlite")})
+		}
+	case browser == "firefox":
+		for name := range strings.SplitSeq(ffProfileName, ",") {
+			p, err := sources.FindFirefoxProfile(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, browserProfile{name: p.Name, file: path.Join(p.Dir, "places.sqlite")})
+		}
+	case allProfiles:
+		profiles, err := sources.ChromiumProfiles(browser)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range profiles {
+			dir, err := sources.ChromiumProfileDir(browser, p.Dir)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, browserProfile{name: p.Name, file: filepath.Join(dir, "Bookmarks")})
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("no %s profiles with bookmarks", browser)
+		}
+	default:
+		// the names chromium shows, the directories are Profile 1 and so on
+		names := make(map[string]string)
+		if profiles, err := sources.ChromiumProfiles(browser); err == nil {
+			for _, p := range profiles {
+				names[p.Dir] = p.Name
+			}
+		}
+		for name := range strings.SplitSeq(ffProfileName, ",") {
+			name = strings.TrimSpace(name)
+			if name == defaultFirefoxProfile {
+				name = "Default"
+			}
+			dir, err := sources.ChromiumProfileDir(browser, name)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, browserProfile{name: cmp.Or(names[name], name), file: filepath.Join(dir, "Bookmarks")})
+		}
+	}
+	return list, nil
+}
+
+// readProfiles reads bookmarks of every profile of the browser, see browserProfiles, merged. Each one is tagged
+// with its profile if there are several, the same urls are merged by dedupeBookmarks later.
+// With -all-profiles, the ones failing to read, e.g. without the -folder, are skipped.
+func readProfiles(browser string, read func(p browserProfile) ([]bookmark, error)) ([]bookmark, error) {
+	profiles, err := browserProfiles(browser)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []bookmark
+	found := 0
+	for _, p := range profiles {
+		bookmarks, err := read(p)
+		if err != nil && allProfiles && len(profiles) > 1 {
+			slog.Warn("failed to read the profile, skipping", "profile", p.name, "err", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found++
+		if len(profiles) > 1 {
+			for i := range bookmarks {
+				bookmarks[i].tags = append(bookmarks[i].tags, "profile:"+p.name)
+			}
+		}
+		list = append(list, bookmarks...)
+	}
+	if found == 0 {
+		return nil, fmt.Errorf("no profile has the %q folder", bookmarksFolder)
+	}
+	return list, nil
+}
+
+// readPlacesBookmarks reads the -folder bookmarks of the firefox profiles.
+func readPlacesBookmarks(ctx context.Context) ([]bookmark, error) {
+	return readProfiles("firefox", func(p browserProfile) ([]bookmark, error) {
+		slog.Info("reading bookmarks", "db", p.file)
+		db, cleanup, err := sources.OpenPlaces(p.file)
+		if err != nil {
+			return nil, fmt.Errorf("open database: %w", err)
+		}
+		defer cleanup()
+
+		list, err := getBookmarksToSync(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("get bookmarks: %w", err)
+		}
+		return list, nil
+	})
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
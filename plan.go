@@ -0,0 +1,85 @@
+package uebarchive
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+// skipReason tells why a bookmark should not be downloaded,
+// an empty string means it should.
+func skipReason(bmark bookmark) string {
+	u, err := url.Parse(bmark.url)
+	if err != nil {
+		return "malformed url: " + err.Error()
+	}
+	if strings.HasPrefix(bmark.url, emailScheme) {
+		return "an email, captured when it was read"
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		// firefox keeps place: queries and javascript: bookmarklets among regular bookmarks
+		return fmt.Sprintf("unsupported scheme %q", u.Scheme)
+	}
+	if reason := filterReason(bmark.url); len(reason) > 0 {
+		return reason
+	}
+	if reason := addedReason(bmark); len(reason) > 0 {
+		return reason
+	}
+	if opts, _ := fetchOptionsFor(bmark.url); isOnion(bmark.url) && len(opts.proxy) == 0 {
+		// wget would fail to resolve it anyway
+		return ".onion needs -tor-proxy"
+	}
+
+	return ""
+}
+
+// freshCapture returns the previous capture of the bookmark
+// if it's younger than -refresh-after, nil otherwise.
+func freshCapture(bmark bookmark) *archiveMeta {
+	if refreshAfter <= 0 {
+		return nil
+	}
+	if meta := loadCapture(bmark); meta != nil && time.Since(meta.archivedAt) < refreshAfter {
+		return meta
+	}
+	return nil
+}
+
+// skipped reports if the bookmark wasn't even tried, see skipReason.
+func (b bookmark) skipped() bool {
+	return b.archiveMeta == nil && strings.HasPrefix(b.failure, "skipped: ")
+}
+
+// refreshFailed is true for a bookmark which failed to download again,
+// its previous capture is kept, see fetchOnce.
+func (b bookmark) refreshFailed() bool {
+	return b.archiveMeta != nil && len(b.failure) > 0 && !strings.HasPrefix(b.failure, "skipped: ")
+}
+
+// printPlan shows what the archive run is going to do, for -dry-run.
+// done is what's already processed by the interrupted run, if resuming.
+func printPlan(list []bookmark, done map[int64]store.Entry) {
+	todo := 0
+	for _, bmark := range list {
+		if entry, ok := done[bmark.hash]; ok {
+			fmt.Printf("SKIP     %s: already processed (%s)\n", bmark.url, entry.Status)
+			continue
+		}
+		if meta := freshCapture(bmark); meta != nil {
+			fmt.Printf("KEEP     %s: captured at %s\n", bmark.url, meta.archivedAt.Format(time.DateTime))
+			continue
+		}
+		if reason := skipReason(bmark); len(reason) > 0 {
+			fmt.Printf("SKIP     %s: %s\n", bmark.url, reason)
+			continue
+		}
+		fmt.Printf("DOWNLOAD %s\n", bmark.url)
+		todo++
+	}
+
+	fmt.Printf("\n%d to download, %d to skip\n", todo, len(list)-todo)
+}
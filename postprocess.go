@@ -0,0 +1,239 @@
+package uebarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/fetch"
+)
+
+// postStep is run on every new capture once it's downloaded, fallbacks included.
+// It may add files to the capture and fill in its meta, which is written after
+// all the steps; a failed step is only a warning, the capture is kept anyway.
+type postStep interface {
+	// name is how the step is enabled in -post-steps
+	name() string
+	run(ctx context.Context, bmark *bookmark) error
+}
+
+// postSteps are all the steps, in the order they run.
+var postSteps = []postStep{
+	sanitizeStep{},
+	textStep{},
+	summaryStep{},
+	localizeStep{},
+	auditStep{},
+	thumbnailStep{},
+	compressStep{},
+}
+
+// enabledSteps are comma-separated names of the steps to run, the heavy
+// ones and those fetching from other hosts are left out by default.
+var enabledSteps = defaultSteps
+
+const defaultSteps = "text,audit"
+
+// checkPostSteps makes sure every -post-steps name is a known step.
+func checkPostSteps() error {
+	for _, name := range strings.Split(enabledSteps, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 || name == "meta" {
+			// meta used to be a step, it's always extracted now
+			continue
+		}
+		known := slices.ContainsFunc(postSteps, func(s postStep) bool { return s.name() == name })
+		if !known {
+			var names []string
+			for _, s := range postSteps {
+				names = append(names, s.name())
+			}
+			return fmt.Errorf("unknown -post-steps step %q, have: %s", name, strings.Join(names, ", "))
+		}
+	}
+	if stepEnabled("summary") {
+		if _, err := newSummarizer(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stepEnabled(name string) bool {
+	for _, enabled := range strings.Split(enabledSteps, ",") {
+		if strings.TrimSpace(enabled) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// postProcess extracts the page meta, which everything else relies on, and runs
+// the enabled steps on the bookmark's capture, if it has one, then counts its words
+// for the keywords, hashes the files again and rewrites the meta.json.
+func postProcess(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	if bmark.archiveMeta == nil {
+		return
+	}
+
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return
+	}
+	bmark.archiveMeta.page = parsePageMeta(path.Join(archiveRoot, index), bmark.url)
+	for _, step := range postSteps {
+		if !stepEnabled(step.name()) || ctx.Err() != nil {
+			continue
+		}
+		if err := step.run(ctx, bmark); err != nil {
+			logger.Warn("post-processing step failed", "url", bmark.url, "step", step.name(), "err", err)
+		}
+	}
+	bmark.archiveMeta.words = captureWords(*bmark)
+	if err := rehashCapture(bmark); err != nil {
+		logger.Warn("failed to write capture meta", "url", bmark.url, "err", err)
+	}
+}
+
+// rehashCapture hashes the capture's files again and rewrites its meta.json,
+// after its files have changed.
+func rehashCapture(bmark *bookmark) error {
+	meta := bmark.archiveMeta
+	meta.files = hashCapturedFiles(meta.saved)
+	meta.size = 0
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+	return writeCaptureMeta(*bmark)
+}
+
+// thumbnailStep takes a screenshot of the captured page with headless chrome,
+// it's the local copy which is rendered, so it's the capture as it is.
+type thumbnailStep struct{}
+
+func (thumbnailStep) name() string { return "thumbnail" }
+
+func (thumbnailStep) run(ctx context.Context, bmark *bookmark) error {
+	chrome, err := fetch.FindChrome()
+	if err != nil {
+		return err
+	}
+	page, ok := bmark.archiveMeta.index()
+	if !ok {
+		return errors.New("nothing captured")
+	}
+	index, err := filepath.Abs(path.Join(archiveRoot, page))
+	if err != nil {
+		return err
+	}
+	thumbnail := path.Join(bmark.captureDir(), "thumbnail.png")
+	screenshot, err := filepath.Abs(path.Join(archiveRoot, thumbnail))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	args := append([]string{
+		"--headless=new",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--window-size=1280,800",
+		"--virtual-time-budget=" + fmt.Sprint(fetch.ChromeRenderBudget.Milliseconds()),
+		"--screenshot=" + screenshot,
+	}, fetch.ChromeSandboxArgs(chromeNoSandbox)...)
+	cmd := exec.CommandContext(ctx, chrome, append(args, "file://"+index)...)
+	fetch.SetProcessGroup(cmd)
+	cmd.Cancel = func() error { return fetch.KillProcessGroup(cmd) }
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("chrome screenshot: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if _, err := os.Stat(screenshot); err != nil {
+		return fmt.Errorf("chrome screenshot: %w", err)
+	}
+
+	bmark.archiveMeta.thumbnail = thumbnail
+	if !slices.Contains(bmark.archiveMeta.saved, thumbnail) {
+		bmark.archiveMeta.saved = append(bmark.archiveMeta.saved, thumbnail)
+	}
+	return nil
+}
+
+// compressedSuffixes are the text files worth compressing, the rest are compressed already.
+var compressedSuffixes = []string{".html", ".htm", ".css", ".js", ".mjs", ".svg", ".json", ".xml", ".txt"}
+
+// compressStep writes a gzipped copy next to every text file of the capture,
+// serve sends those to clients which accept gzip. The originals stay as they
+// are, so the capture can still be opened from the disk.
+type compressStep struct{}
+
+func (compressStep) name() string { return "compress" }
+
+func (compressStep) run(_ context.Context, bmark *bookmark) error {
+	for _, fileName := range bmark.archiveMeta.saved {
+		ext := strings.ToLower(path.Ext(fileName))
+		if !slices.Contains(compressedSuffixes, ext) {
+			continue
+		}
+		if err := gzipFile(path.Join(archiveRoot, fileName)); err != nil {
+			return fmt.Errorf("compress %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// refreshGzipped compresses the file again if the compress step has made
+// a copy of it, serve would keep sending the old one otherwise.
+func refreshGzipped(fileName string) error {
+	if _, err := os.Stat(fileName + ".gz"); err != nil {
+		return nil
+	}
+	return gzipFile(fileName)
+}
+
+func gzipFile(fileName string) error {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return replaceFile(fileName+".gz", buf.Bytes())
+}
+
+// replaceFile writes a new file in place of the old one, rather than into it:
+// an export may have hard-linked the capture's files, they must stay as they are.
+func replaceFile(fileName string, data []byte) error {
+	tmp, err := os.CreateTemp(path.Dir(fileName), "."+path.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
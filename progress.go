@@ -0,0 +1,176 @@
+package uebarchive
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// console is where logs go, it keeps the progress line at the bottom
+// of the terminal by redrawing it after every log message.
+var console = &consoleWriter{out: os.Stderr}
+
+type consoleWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	status string
+}
+
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.status) == 0 {
+		return c.out.Write(p)
+	}
+
+	fmt.Fprint(c.out, "\r\033[K")
+	n, err := c.out.Write(p)
+	fmt.Fprint(c.out, c.status)
+	return n, err
+}
+
+func (c *consoleWriter) setStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status = status
+	fmt.Fprint(c.out, "\r\033[K", status)
+}
+
+// isTerminal reports if the console is an interactive terminal,
+// the progress line is just a noise anywhere else.
+func (c *consoleWriter) isTerminal() bool {
+	f, ok := c.out.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// progress tracks the archive run, it's safe to use with a nil receiver
+// which means the progress display is disabled.
+type progress struct {
+	mu      sync.Mutex
+	started time.Time
+	total   int
+	done    int
+	bytes   int64
+	current map[int]string
+
+	stop chan struct{}
+	// stopped is closed once the loop has returned
+	stopped chan struct{}
+}
+
+// newProgress starts redrawing the progress line,
+// returns nil if it's not supposed to be shown.
+func newProgress() *progress {
+	if noProgress || logFormat != "text" || !console.isTerminal() {
+		return nil
+	}
+
+	p := &progress{
+		started: time.Now(),
+		current: make(map[int]string),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *progress) loop() {
+	defer close(p.stopped)
+	tick := time.NewTicker(500 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-tick.C:
+			console.setStatus(p.String())
+		}
+	}
+}
+
+func (p *progress) setTotal(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.total = n
+	p.mu.Unlock()
+}
+
+func (p *progress) begin(worker int, url string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.current[worker] = url
+	p.mu.Unlock()
+}
+
+// end marks a bookmark as processed, worker < 0 is for bookmarks
+// that were never passed to a worker, e.g. skipped ones.
+func (p *progress) end(worker int, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.current, worker)
+	p.done++
+	p.bytes += size
+	p.mu.Unlock()
+}
+
+// finish stops the redrawing and clears the line, the loop is waited for,
+// otherwise it could draw the line again right after.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	console.setStatus("")
+}
+
+func (p *progress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	line := fmt.Sprintf("[%d/%d] %s", p.done, p.total, humanBytes(p.bytes))
+	if p.done > 0 && p.total > p.done {
+		elapsed := time.Since(p.started)
+		eta := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+		line += ", eta " + eta.Truncate(time.Second).String()
+	}
+
+	workers := slices.Sorted(maps.Keys(p.current))
+	urls := make([]string, 0, len(workers))
+	for _, w := range workers {
+		urls = append(urls, shorten(p.current[w], 40))
+	}
+	if len(urls) > 0 {
+		line += " | " + strings.Join(urls, " | ")
+	}
+
+	// don't wrap, otherwise \r can't take us back to the line start
+	return shorten(line, 200)
+}
+
+func shorten(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,181 @@
+package uebarchive
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	netproxy "golang.org/x/net/proxy"
+)
+
+// torProxy is used for .onion bookmarks instead of the -proxy.
+var torProxy string
+
+func isOnion(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimSuffix(u.Hostname(), "."), ".onion")
+}
+
+// wgetProxy returns an http proxy url wget can use for the given proxy,
+// socks proxies go through a local bridge, since wget can't speak socks.
+func wgetProxy(proxy string) (string, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return proxy, nil
+	case "socks5", "socks5h":
+		return socksBridgeFor(u)
+	default:
+		return "", fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// proxyTransport is an http transport for our own requests (robots.txt, etc.)
+func proxyTransport(proxy string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(proxy) == 0 {
+		return transport, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy url: %w", err)
+	}
+	if u.Scheme == "socks5" || u.Scheme == "socks5h" {
+		// resolve names on the proxy side, that's what .onion needs
+		dialer, err := socksDialer(u)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		return transport, nil
+	}
+
+	transport.Proxy = http.ProxyURL(u)
+	return transport, nil
+}
+
+var socksBridges = struct {
+	sync.Mutex
+	addrs map[string]string
+}{addrs: make(map[string]string)}
+
+// socksBridgeFor starts (once per socks url) a local http proxy
+// which forwards everything through the socks proxy.
+func socksBridgeFor(socks *url.URL) (string, error) {
+	socksBridges.Lock()
+	defer socksBridges.Unlock()
+
+	if addr, ok := socksBridges.addrs[socks.String()]; ok {
+		return addr, nil
+	}
+
+	dialer, err := socksDialer(socks)
+	if err != nil {
+		return "", err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	bridge := &socksBridge{
+		dialer: dialer,
+		transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 30 * time.Second,
+		},
+	}
+	go http.Serve(ln, bridge)
+
+	addr := "http://" + ln.Addr().String()
+	socksBridges.addrs[socks.String()] = addr
+	slog.Debug("started socks bridge", "socks", socks.Redacted(), "addr", addr)
+	return addr, nil
+}
+
+type socksBridge struct {
+	dialer    netproxy.ContextDialer
+	transport *http.Transport
+}
+
+func (b *socksBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		b.tunnel(w, r)
+		return
+	}
+
+	// plain http, the request has an absolute url
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	resp, err := b.transport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (b *socksBridge) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := b.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+	client.Close()
+}
+
+// socksDialer dials through the socks proxy, with the username and password
+// of the url if there are any, host names are resolved by the proxy.
+func socksDialer(u *url.URL) (netproxy.ContextDialer, error) {
+	dialer, err := netproxy.FromURL(u, netproxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("socks proxy: %w", err)
+	}
+	ctxDialer, ok := dialer.(netproxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("socks proxy: %T can't dial with a context", dialer)
+	}
+	return ctxDialer, nil
+}
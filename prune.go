@@ -0,0 +1,52 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runPrune removes capture directories and wget logs of bookmarks
+// that were not part of the last run, e.g. deleted from the folder.
+// Captures of bookmarks merged into another entry are kept, see mergeSamePage.
+func runPrune(_ context.Context, _ []string) error {
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	known := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		known[entry.Hash] = true
+		for _, hash := range entry.Merged {
+			known[hash] = true
+		}
+	}
+
+	dirs, _ := filepath.Glob(path.Join(archiveRoot, "captures", "*"))
+	logs, _ := filepath.Glob(path.Join(archiveRoot, "wget-*.log"))
+
+	removed := 0
+	for _, name := range append(dirs, logs...) {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "wget-"), ".log")
+		hash, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || known[hash] {
+			continue
+		}
+
+		if err := os.RemoveAll(name); err != nil {
+			slog.Warn("prune failed", "path", name, "err", err)
+			continue
+		}
+		fmt.Println("removed", name)
+		removed++
+	}
+
+	slog.Info("pruned", "removed", removed)
+	return nil
+}
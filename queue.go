@@ -0,0 +1,106 @@
+package uebarchive
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+// the queue table keeps the list of bookmarks of the current run
+// along with the results of the ones already processed,
+// so an interrupted run could be resumed with -resume.
+const queueSchema = `
+create table if not exists queue (
+	hash integer primary key,
+	url text not null,
+	result text
+);
+`
+
+// resetQueue starts a new run with every bookmark pending.
+func resetQueue(db *sql.DB, list []bookmark) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin queue transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`delete from queue`); err != nil {
+		return fmt.Errorf("clear the queue: %w", err)
+	}
+	for _, bmark := range list {
+		if _, err := tx.Exec(`insert or replace into queue (hash, url) values (?, ?)`, bmark.hash, bmark.url); err != nil {
+			return fmt.Errorf("fill the queue: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit the queue: %w", err)
+	}
+	return nil
+}
+
+// appendQueue adds the bookmarks to the queue as pending, for runs of a few
+// bookmarks, the results of an interrupted run are left for its -resume.
+func appendQueue(db *sql.DB, list []bookmark) error {
+	for _, bmark := range list {
+		if _, err := db.Exec(`insert or ignore into queue (hash, url) values (?, ?)`, bmark.hash, bmark.url); err != nil {
+			return fmt.Errorf("fill the queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// markProcessed stores the bookmark result, so it won't be downloaded again on -resume.
+func markProcessed(db *sql.DB, bmark bookmark) {
+	bs, err := json.Marshal(newManifestEntry(bmark))
+	if err != nil {
+		slog.Warn("failed to marshal the queue result", "url", bmark.url, "err", err)
+		return
+	}
+
+	_, err = db.Exec(`insert into queue (hash, url, result) values (?, ?, ?)
+		on conflict (hash) do update set result=excluded.result`, bmark.hash, bmark.url, string(bs))
+	if err != nil {
+		// not a big deal, we'll just download it again on resume
+		slog.Warn("failed to update the queue", "url", bmark.url, "err", err)
+	}
+}
+
+// clearQueue empties the queue once the archive run is over and its results are in the index.json,
+// there is nothing to resume, and a -resume of the next run mustn't take them for its own.
+func clearQueue(db *sql.DB) {
+	if _, err := db.Exec(`delete from queue`); err != nil {
+		slog.Warn("failed to clear the queue", "err", err)
+	}
+}
+
+// processedBookmarks returns results of the interrupted run by url hash.
+func processedBookmarks(db *sql.DB) (map[int64]store.Entry, error) {
+	rows, err := db.Query(`select hash, result from queue where result is not null`)
+	if err != nil {
+		return nil, fmt.Errorf("query the queue: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]store.Entry)
+	for rows.Next() {
+		var hash int64
+		var result string
+		if err := rows.Scan(&hash, &result); err != nil {
+			return nil, fmt.Errorf("query queue row: %w", err)
+		}
+
+		var entry store.Entry
+		if err := json.Unmarshal([]byte(result), &entry); err != nil {
+			slog.Warn("broken queue entry, will download again", "hash", hash, "err", err)
+			continue
+		}
+		done[hash] = entry
+	}
+
+	return done, rows.Err()
+}
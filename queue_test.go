@@ -0,0 +1,62 @@
+package uebarchive
+
+import (
+	"testing"
+)
+
+func tempArchiveRoot(t *testing.T) {
+	t.Helper()
+	root := archiveRoot
+	archiveRoot = t.TempDir()
+	t.Cleanup(func() { archiveRoot = root })
+}
+
+func TestAppendQueueKeepsResume(t *testing.T) {
+	tempArchiveRoot(t)
+	state, err := openStateDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	// an archive run interrupted after the first bookmark
+	first, second := newBookmark("https://example.com/1", "one"), newBookmark("https://example.com/2", "two")
+	if err := resetQueue(state, []bookmark{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	markProcessed(state, first)
+
+	added := newBookmark("https://example.com/added", "")
+	if err := appendQueue(state, []bookmark{added, first}); err != nil {
+		t.Fatal(err)
+	}
+	done, err := processedBookmarks(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := done[first.hash]; !ok || len(done) != 1 {
+		t.Errorf("got processed %v, want only the first bookmark of the interrupted run", done)
+	}
+}
+
+func TestAddBookmarkKeepsTitle(t *testing.T) {
+	tempArchiveRoot(t)
+	state, err := openStateDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for _, title := range []string{"", "the title", "", "a better title"} {
+		if err := addBookmark(state, newBookmark("https://example.com/", title)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := withAddedBookmarks(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].title != "a better title" {
+		t.Errorf("got %+v, want one bookmark with the last title given", list)
+	}
+}
@@ -0,0 +1,121 @@
+package uebarchive
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// articleBlock is a paragraph, a heading, a list item or the like of the article text.
+type articleBlock struct {
+	// p, h1..h6, li, blockquote or pre
+	tag  string
+	text string
+}
+
+// article is the readable text of a capture, see extractArticle.
+type article struct {
+	title     string
+	url       string
+	author    string
+	published time.Time
+	blocks    []articleBlock
+}
+
+// a page with less text than that in the blocks isn't made of paragraphs,
+// its whole text is the better guess then.
+const minArticleText = 200
+
+var (
+	// parts of the page which are never the article, nested ones aren't told apart
+	boilerplateRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?is)<nav\b[^>]*>.*?</nav\s*>`),
+		regexp.MustCompile(`(?is)<header\b[^>]*>.*?</header\s*>`),
+		regexp.MustCompile(`(?is)<footer\b[^>]*>.*?</footer\s*>`),
+		regexp.MustCompile(`(?is)<aside\b[^>]*>.*?</aside\s*>`),
+		regexp.MustCompile(`(?is)<form\b[^>]*>.*?</form\s*>`),
+		regexp.MustCompile(`(?is)<svg\b[^>]*>.*?</svg\s*>`),
+		regexp.MustCompile(`(?is)<template\b[^>]*>.*?</template\s*>`),
+	}
+	// the article is in the first of them the page has
+	articleRootRes = []*regexp.Regexp{
+		regexp.MustCompile(`(?is)<article\b[^>]*>(.*)</article\s*>`),
+		regexp.MustCompile(`(?is)<main\b[^>]*>(.*)</main\s*>`),
+		regexp.MustCompile(`(?is)<body\b[^>]*>(.*)</body\s*>`),
+	}
+	// inline tags, gone without a space in their place, unlike the rest
+	inlineTagRe    = regexp.MustCompile(`(?i)</?(?:a|abbr|b|cite|code|em|i|kbd|mark|q|s|small|span|strong|sub|sup|time|u)\b[^>]*>`)
+	articleBlockRe = regexp.MustCompile(`(?is)<(h[1-6]|p|li|blockquote|pre)\b[^>]*>(.*?)</(?:h[1-6]|p|li|blockquote|pre)\s*>`)
+)
+
+// extractArticle is the readable text of the page, without the menus, sidebars,
+// scripts and the like, as blocks of plain text: the paragraphs of its <article>,
+// <main> or the whole body, or its whole text as one paragraph if it has no paragraphs.
+func extractArticle(page string) []articleBlock {
+	page = invisibleRe.ReplaceAllString(page, " ")
+	for _, re := range boilerplateRes {
+		page = re.ReplaceAllString(page, " ")
+	}
+	for _, re := range articleRootRes {
+		if m := re.FindStringSubmatch(page); m != nil && len(pageText(m[1])) >= minArticleText {
+			page = m[1]
+			break
+		}
+	}
+
+	var blocks []articleBlock
+	length := 0
+	for _, m := range articleBlockRe.FindAllStringSubmatch(page, -1) {
+		tag := strings.ToLower(m[1])
+		var text string
+		if tag == "pre" {
+			// the only one whitespace matters in
+			text = strings.Trim(html.UnescapeString(anyTagRe.ReplaceAllString(m[2], "")), "\r\n")
+		} else {
+			text = cleanText(anyTagRe.ReplaceAllString(inlineTagRe.ReplaceAllString(m[2], ""), " "))
+		}
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		blocks = append(blocks, articleBlock{tag: tag, text: text})
+		length += len(text)
+	}
+	if length < minArticleText {
+		if text := pageText(page); len(text) > length {
+			return []articleBlock{{tag: "p", text: text}}
+		}
+	}
+	return blocks
+}
+
+// readArticle extracts the article from the bookmark's capture,
+// ok is false if it's not an html page or there is no text.
+func readArticle(bmark bookmark) (article, bool, error) {
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return article{}, false, nil
+	}
+	if ext := strings.ToLower(path.Ext(index)); ext != ".html" && ext != ".htm" {
+		return article{}, false, nil
+	}
+	bs, err := os.ReadFile(path.Join(archiveRoot, index))
+	if err != nil {
+		return article{}, false, fmt.Errorf("read capture: %w", err)
+	}
+	blocks := extractArticle(string(bs))
+	if len(blocks) == 0 {
+		return article{}, false, nil
+	}
+	return article{
+		title:     bmark.displayTitle(),
+		url:       cmp.Or(bmark.archiveMeta.page.canonical, bmark.url),
+		author:    bmark.archiveMeta.page.author,
+		published: bmark.archiveMeta.page.published,
+		blocks:    blocks,
+	}, true, nil
+}
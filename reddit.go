@@ -0,0 +1,57 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	redditUser         string
+	redditPassword     string
+	redditClientID     string
+	redditClientSecret string
+)
+
+// addRedditSaved adds posts and comments the -reddit-user has saved, see addedSources:
+// the thread, and the link of the post if it's a link post, tagged with the subreddit.
+func addRedditSaved(ctx context.Context, state *sql.DB) error {
+	transport, err := proxyTransport(defaultFetch.proxy)
+	if err != nil {
+		return err
+	}
+	reddit := sources.Reddit{
+		Client:       &http.Client{Timeout: time.Minute, Transport: transport},
+		ClientID:     redditClientID,
+		ClientSecret: redditClientSecret,
+		User:         redditUser,
+		Password:     redditPassword,
+	}
+	saved, err := reddit.Saved(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range saved {
+		links := []bookmark{newBookmark(s.Thread, s.Title)}
+		if len(s.URL) > 0 {
+			links = append(links, newBookmark(s.URL, s.Title))
+		}
+		for _, b := range links {
+			b.dateAdded = s.Created
+			if len(s.Subreddit) > 0 {
+				// anyone may name a subreddit "mirror", see applyTags
+				b.tags = []string{"reddit:" + s.Subreddit}
+			}
+			if err := addBookmark(state, b); err != nil {
+				return err
+			}
+		}
+	}
+	slog.Info("reddit saved posts read", "user", redditUser, "saved", len(saved))
+	return nil
+}
@@ -0,0 +1,84 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// makeArchivePages writes everything the archive consists of, except the captures itself.
+func makeArchivePages(ctx context.Context, list []bookmark, order func(a, b bookmark) int, stats runStats, state *sql.DB) error {
+	list = linkCanonical(mergeRedirected(list))
+	sortBookmarks(list, order)
+	autoTag(list)
+	for _, bmark := range list {
+		if bmark.archiveMeta != nil {
+			bmark.archiveMeta.diskSize = bmark.diskUsage()
+		}
+	}
+
+	notes, err := linkRotNotes(state)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		list[i].linkRot = notes[list[i].hash]
+	}
+
+	history, err := listRuns(state, 100)
+	if err != nil {
+		return err
+	}
+
+	for _, write := range []func([]bookmark) error{
+		makeIndexPage,
+		makeManifest,
+		makeFeed,
+		makeFailureReport,
+		makeTitleLinks,
+	} {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := write(list); err != nil {
+			return err
+		}
+	}
+	return makeStatsPage(stats, history)
+}
+
+func runReindex(ctx context.Context, _ []string) error {
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+	if _, err := groupKey(groupBy); err != nil {
+		return err
+	}
+
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entryBookmark(entry))
+	}
+
+	// that's not a run, so it doesn't go to the history
+	stats := collectStats(list, time.Now())
+	if err := makeArchivePages(ctx, list, order, stats, state); err != nil {
+		return err
+	}
+	slog.Info("reindexed", "urls", len(list))
+	return nil
+}
@@ -0,0 +1,166 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runRepair downloads the requisites the audit has found missing from the captures,
+// the pages themselves are left as they are. Only the given urls are repaired, if any.
+func runRepair(ctx context.Context, args []string) error {
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readManifest()
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	incomplete := false
+	list := make([]bookmark, 0, len(entries))
+	for _, entry := range entries {
+		bmark := entryBookmark(entry)
+		if bmark.archiveMeta == nil || len(bmark.archiveMeta.missing) == 0 || len(args) > 0 && !slices.Contains(args, bmark.url) {
+			list = append(list, bmark)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := repairRequisites(ctx, &bmark); err != nil {
+			fmt.Printf("FAILED     %s: %v\n", bmark.url, err)
+			incomplete = true
+		} else if missing := len(bmark.archiveMeta.missing); missing > 0 {
+			fmt.Printf("INCOMPLETE %s: %d of %d requisites still missing\n", bmark.url, missing, bmark.archiveMeta.requisites)
+			incomplete = true
+		} else {
+			fmt.Printf("REPAIRED   %s\n", bmark.url)
+		}
+		list = append(list, bmark)
+	}
+
+	// that's not a run, so it doesn't go to the history
+	if err := makeArchivePages(ctx, list, order, collectStats(list, time.Now()), state); err != nil {
+		return err
+	}
+	if incomplete {
+		return exitCode(1)
+	}
+	return nil
+}
+
+// repairRequisites downloads the bookmark's missing requisites into its capture,
+// and points the pages and stylesheets which refer to them to the local copies.
+func repairRequisites(ctx context.Context, bmark *bookmark) error {
+	// meta.json has more of it than the manifest
+	if meta := loadCapture(*bmark); meta != nil {
+		meta.wgetDownloaded = bmark.archiveMeta.wgetDownloaded
+		bmark.archiveMeta = meta
+	}
+	opts, err := fetchOptionsFor(bmark.url)
+	if err == nil {
+		err = opts.applyTags(bmark.tags)
+	}
+	if err != nil {
+		return err
+	}
+	bmark.fetch = opts
+
+	l, err := newLocalizer(bmark)
+	if err != nil {
+		return err
+	}
+	// the missing url, as the pages have it, and its local copy
+	fetched := make(map[string]string)
+	for _, missing := range bmark.archiveMeta.missing {
+		target, err := requisiteURL(*bmark, missing)
+		if err != nil {
+			slog.Warn("can't repair requisite", "url", bmark.url, "requisite", missing, "err", err)
+			continue
+		}
+		if local := l.fetch(ctx, target, 0); len(local) > 0 {
+			fetched[missing] = local
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(fetched) == 0 && len(l.failed) > 0 {
+		return fmt.Errorf("none of %d requisites downloaded, %s: %w", len(bmark.archiveMeta.missing), l.failed[0].url, l.failed[0].err)
+	}
+
+	for _, fileName := range bmark.archiveMeta.saved {
+		ext := strings.ToLower(path.Ext(fileName))
+		if ext != ".html" && ext != ".htm" && ext != ".css" {
+			continue
+		}
+		full := path.Join(archiveRoot, fileName)
+		bs, err := os.ReadFile(full)
+		if err != nil {
+			return err
+		}
+		content := string(bs)
+		for missing, local := range fetched {
+			if !strings.Contains(missing, "://") {
+				// it's the local file itself
+				continue
+			}
+			href := relativeHref(fileName, local)
+			content = strings.ReplaceAll(content, html.EscapeString(missing), href)
+			content = strings.ReplaceAll(content, missing, href)
+		}
+		if content == string(bs) {
+			continue
+		}
+		if err := replaceFile(full, []byte(content)); err != nil {
+			return err
+		}
+		if err := refreshGzipped(full); err != nil {
+			return err
+		}
+	}
+
+	bmark.archiveMeta.localized += len(l.saved)
+	bmark.archiveMeta.saved = append(bmark.archiveMeta.saved, l.saved...)
+	if err := (auditStep{}).run(ctx, bmark); err != nil {
+		return err
+	}
+	return rehashCapture(bmark)
+}
+
+// requisiteURL is where the missing requisite is from: it's a url already, or
+// a file of the capture, which wget saves as <host>/<path>.
+func requisiteURL(bmark bookmark, missing string) (*url.URL, error) {
+	if strings.Contains(missing, "://") {
+		return url.Parse(missing)
+	}
+
+	rel, ok := strings.CutPrefix(missing, bmark.captureDir()+"/")
+	host, p, found := strings.Cut(rel, "/")
+	if !ok || !found {
+		return nil, errors.New("not a file of the capture")
+	}
+	page, err := url.Parse(bmark.url)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: page.Scheme, Host: host, Path: "/" + p}, nil
+}
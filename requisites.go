@@ -0,0 +1,62 @@
+package uebarchive
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// tags that make a browser fetch something to render the page.
+var requisiteTagRe = regexp.MustCompile(`(?is)<(img|script|link|source|iframe|embed|audio|video|input)\s[^>]*>`)
+
+// pageRequisites returns absolute urls of everything the page refers to
+// to be rendered: images, scripts, stylesheets, frames, etc.
+// Relative references are resolved against base.
+func pageRequisites(base *url.URL, page string) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, ref := range requisiteRefs(page) {
+		u, err := base.Parse(ref)
+		if err != nil {
+			continue
+		}
+		u.Fragment = ""
+		if s := u.String(); !seen[s] {
+			seen[s] = true
+			refs = append(refs, s)
+		}
+	}
+	return refs
+}
+
+// requisiteRefs returns requisite references as they are written in the page.
+func requisiteRefs(page string) []string {
+	var refs []string
+	add := func(ref string) {
+		ref = cleanText(ref)
+		if len(ref) == 0 || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			return
+		}
+		refs = append(refs, ref)
+	}
+
+	for _, m := range requisiteTagRe.FindAllStringSubmatch(page, -1) {
+		tag := strings.ToLower(m[1])
+		attrs := tagAttrs(m[0])
+		switch tag {
+		case "link":
+			rel := strings.ToLower(attrs["rel"])
+			if strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") {
+				add(attrs["href"])
+			}
+		default:
+			add(attrs["src"])
+			for _, candidate := range strings.Split(attrs["srcset"], ",") {
+				ref, _, _ := strings.Cut(strings.TrimSpace(candidate), " ")
+				add(ref)
+			}
+		}
+	}
+
+	return refs
+}
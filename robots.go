@@ -0,0 +1,211 @@
+package uebarchive
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoreRobots is the default, it's a personal archive after all: the bookmarked page
+// is what the user has asked for. With -ignore-robots=false wget respects robots.txt
+// for the requisites and the mirror's recursion, we record what it has left out.
+var ignoreRobots = defaultIgnoreRobots
+
+const defaultIgnoreRobots = true
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+type robotsRules []robotsRule
+
+// allowed follows the google's interpretation: the longest matching
+// pattern wins, Allow wins a tie.
+func (rules robotsRules) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if len(target) == 0 {
+		target = "/"
+	}
+	if len(u.RawQuery) > 0 {
+		target += "?" + u.RawQuery
+	}
+
+	allow, best := true, -1
+	for _, rule := range rules {
+		if !rule.re.MatchString(target) {
+			continue
+		}
+		if len(rule.pattern) > best || (len(rule.pattern) == best && rule.allow) {
+			allow, best = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// parseRobots extracts rules for the agent (or for "*" if there is no group for it).
+func parseRobots(r io.Reader, agent string) robotsRules {
+	agent = strings.ToLower(agent)
+
+	var specific, generic robotsRules
+	var groupAgents []string
+	inRules := false
+	foundSpecific := false
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line, _, _ := strings.Cut(scan.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				// a user-agent line after rules starts a new group
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if len(value) == 0 {
+				// empty Disallow means allow everything, nothing to add
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value, re: robotsPattern(value)}
+			for _, ua := range groupAgents {
+				switch {
+				case ua == "*":
+					generic = append(generic, rule)
+				case strings.Contains(agent, ua):
+					specific = append(specific, rule)
+					foundSpecific = true
+				}
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return generic
+}
+
+// robotsPattern compiles a path pattern with * and $ wildcards.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	re := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+	if anchored {
+		re += "$"
+	}
+	return regexp.MustCompile(re)
+}
+
+// robotsCache fetches robots.txt once per host and run.
+var robotsCache = struct {
+	sync.Mutex
+	origins map[string]*robotsEntry
+}{origins: make(map[string]*robotsEntry)}
+
+// robotsEntry is fetched once, workers of the same origin wait for it,
+// the others don't.
+type robotsEntry struct {
+	once  sync.Once
+	rules robotsRules
+}
+
+// resetRobotsCache forgets robots.txt of every host, it's for a new run.
+func resetRobotsCache() {
+	robotsCache.Lock()
+	robotsCache.origins = make(map[string]*robotsEntry)
+	robotsCache.Unlock()
+}
+
+func robotsFor(ctx context.Context, u *url.URL, userAgent, proxy string) robotsRules {
+	origin := u.Scheme + "://" + u.Host
+
+	robotsCache.Lock()
+	entry, ok := robotsCache.origins[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		robotsCache.origins[origin] = entry
+	}
+	robotsCache.Unlock()
+
+	entry.once.Do(func() {
+		var err error
+		entry.rules, err = fetchRobots(ctx, origin, userAgent, proxy)
+		if err != nil {
+			slog.Debug("robots.txt unavailable", "origin", origin, "err", err)
+		}
+	})
+	return entry.rules
+}
+
+// fetchRobots downloads and parses robots.txt of the origin,
+// anything but 200 means there are no rules.
+func fetchRobots(ctx context.Context, origin, userAgent, proxy string) (robotsRules, error) {
+	transport, err := proxyTransport(proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, 512<<10), userAgent), nil
+}
+
+// robotsSkipped lists same-host requisites of the saved page that weren't
+// downloaded because robots.txt forbids them. After --convert-links
+// everything that wasn't downloaded stays an absolute url in the page.
+func robotsSkipped(ctx context.Context, bmark bookmark, page string) []string {
+	base, err := url.Parse(bmark.url)
+	if err != nil {
+		return nil
+	}
+
+	var skipped []string
+	for _, ref := range requisiteRefs(page) {
+		if !strings.HasPrefix(ref, "http://") && !strings.HasPrefix(ref, "https://") {
+			// relative, so it's a local file now
+			continue
+		}
+		u, err := url.Parse(ref)
+		if err != nil || u.Host != base.Host {
+			continue
+		}
+		if !robotsFor(ctx, u, bmark.fetch.userAgent, bmark.fetch.proxy).allowed(u) && !slices.Contains(skipped, ref) {
+			skipped = append(skipped, ref)
+		}
+	}
+	return skipped
+}
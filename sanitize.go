@@ -0,0 +1,171 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// trackerHosts are hosts of analytics, ads and social widgets, subdomains included.
+var trackerHosts = []string{
+	"google-analytics.com",
+	"googletagmanager.com",
+	"googlesyndication.com",
+	"googleadservices.com",
+	"doubleclick.net",
+	"facebook.com",
+	"facebook.net",
+	"platform.twitter.com",
+	"analytics.twitter.com",
+	"ads-twitter.com",
+	"platform.linkedin.com",
+	"snap.licdn.com",
+	"mc.yandex.ru",
+	"counter.yadro.ru",
+	"top-fwz1.mail.ru",
+	"hotjar.com",
+	"segment.com",
+	"segment.io",
+	"mixpanel.com",
+	"amplitude.com",
+	"clarity.ms",
+	"bat.bing.com",
+	"scorecardresearch.com",
+	"quantserve.com",
+	"chartbeat.com",
+	"nr-data.net",
+	"cloudflareinsights.com",
+	"stats.wp.com",
+	"pixel.wp.com",
+	"disqus.com",
+	"addthis.com",
+	"sharethis.com",
+	"outbrain.com",
+	"taboola.com",
+	"criteo.com",
+	"adnxs.com",
+	"amazon-adsystem.com",
+}
+
+var (
+	scriptElemRe = regexp.MustCompile(`(?is)<script\b[^>]*>.*?</script\s*>`)
+	iframeElemRe = regexp.MustCompile(`(?is)<iframe\b[^>]*>.*?</iframe\s*>|<iframe\b[^>]*/>`)
+	imgTagRe     = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+	linkElemRe   = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	anchorTagRe  = regexp.MustCompile(`(?is)<a\b[^>]*>`)
+	pingAttrRe   = regexp.MustCompile(`(?is)\sping\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+	openTagRe    = regexp.MustCompile(`(?s)^<[^>]*>`)
+	// the usual analytics snippets, pasted inline
+	trackerSnippetRe = regexp.MustCompile(`googletagmanager|google-analytics|\bgtag\(|\bfbq\(|_paq\.push|_gaq\.push|\bym\(\d|hotjar|mixpanel\.init|amplitude\.getInstance|analytics\.load\(|clarity\.ms`)
+)
+
+// isTrackerURL tells if the url is of a tracker host, or a host the -filter-list blocks,
+// other than the page's own one.
+// wget saves requisites of other hosts under their host name, so a local path
+// is checked for such a directory too.
+func isTrackerURL(rawURL, own string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	hosts := []string{u.Hostname()}
+	if len(u.Host) == 0 {
+		hosts = strings.Split(u.Path, "/")
+	}
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if host == own {
+			continue
+		}
+		if isFilteredHost(host) {
+			return true
+		}
+		for _, tracker := range trackerHosts {
+			if host == tracker || strings.HasSuffix(host, "."+tracker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sanitizePage removes analytics scripts, tracking pixels and social widgets from the page
+// of the own host, returns the page and the number of elements removed.
+func sanitizePage(page, own string) (string, int) {
+	removed := 0
+	drop := func(re *regexp.Regexp, tracking func(elem string, attrs map[string]string) bool) {
+		page = re.ReplaceAllStringFunc(page, func(elem string) string {
+			if tracking(elem, tagAttrs(openTagRe.FindString(elem))) {
+				removed++
+				return ""
+			}
+			return elem
+		})
+	}
+
+	drop(scriptElemRe, func(elem string, attrs map[string]string) bool {
+		if src, ok := attrs["src"]; ok {
+			return isTrackerURL(src, own)
+		}
+		// json-ld is page metadata, not a script
+		return attrs["type"] != "application/ld+json" && trackerSnippetRe.MatchString(elem)
+	})
+	drop(iframeElemRe, func(_ string, attrs map[string]string) bool {
+		return isTrackerURL(attrs["src"], own)
+	})
+	drop(imgTagRe, func(_ string, attrs map[string]string) bool {
+		pixel := attrs["width"] == "1" && attrs["height"] == "1" || attrs["width"] == "0" && attrs["height"] == "0"
+		return isTrackerURL(attrs["src"], own) || pixel
+	})
+	drop(linkElemRe, func(_ string, attrs map[string]string) bool {
+		rel := strings.ToLower(attrs["rel"])
+		return slices.Contains([]string{"preconnect", "dns-prefetch", "prefetch", "preload"}, rel) && isTrackerURL(attrs["href"], own)
+	})
+	// <a ping> reports clicks
+	page = anchorTagRe.ReplaceAllStringFunc(page, func(tag string) string {
+		if !pingAttrRe.MatchString(tag) {
+			return tag
+		}
+		removed++
+		return pingAttrRe.ReplaceAllString(tag, "")
+	})
+	return page, removed
+}
+
+// sanitizeStep rewrites html files of the capture with sanitizePage,
+// so the archived page doesn't phone home when opened.
+type sanitizeStep struct{}
+
+func (sanitizeStep) name() string { return "sanitize" }
+
+func (sanitizeStep) run(_ context.Context, bmark *bookmark) error {
+	own := ""
+	if u, err := url.Parse(bmark.url); err == nil {
+		own = strings.ToLower(u.Hostname())
+	}
+	for _, fileName := range bmark.archiveMeta.saved {
+		ext := strings.ToLower(path.Ext(fileName))
+		if ext != ".html" && ext != ".htm" {
+			continue
+		}
+		full := path.Join(archiveRoot, fileName)
+		bs, err := os.ReadFile(full)
+		if err != nil {
+			return fmt.Errorf("sanitize %s: %w", fileName, err)
+		}
+		page, removed := sanitizePage(string(bs), own)
+		if removed == 0 {
+			continue
+		}
+		if err := replaceFile(full, []byte(page)); err != nil {
+			return fmt.Errorf("sanitize %s: %w", fileName, err)
+		}
+		bmark.archiveMeta.sanitized += removed
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package uebarchive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	savePageNow bool
+	// waybackKeys are "access:secret" s3 keys from https://archive.org/account/s3.php,
+	// without them the anonymous save is used, which is much more rate limited.
+	waybackKeys string
+)
+
+// the save page now is slow and rate limited,
+// so one request at a time across all workers.
+var savePageNowLimiter = newHostLimiter(5*time.Second, 1)
+
+// submitToWayback asks web.archive.org to snapshot the page as well,
+// and records the snapshot url, a failure doesn't fail the bookmark.
+func submitToWayback(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	const host = "web.archive.org"
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	savePageNowLimiter.acquire(host)
+	defer savePageNowLimiter.release(host)
+	if err := savePageNowLimiter.wait(ctx, host); err != nil {
+		return
+	}
+
+	transport, err := proxyTransport(bmark.fetch.proxy)
+	if err != nil {
+		logger.Warn("save page now failed", "url", bmark.url, "err", err)
+		return
+	}
+	client := &http.Client{Timeout: 2 * time.Minute, Transport: transport}
+
+	var snapshot string
+	if len(waybackKeys) > 0 {
+		snapshot, err = savePageNowAuthenticated(ctx, client, bmark.url)
+	} else {
+		snapshot, err = savePageNowAnonymous(ctx, client, bmark.url)
+	}
+	if err != nil {
+		logger.Warn("save page now failed", "url", bmark.url, "err", err)
+		return
+	}
+
+	logger.Info("saved to the wayback machine", "url", bmark.url, "snapshot", snapshot)
+	bmark.archiveMeta.wayback = snapshot
+	if err := writeCaptureMeta(*bmark); err != nil {
+		logger.Warn("failed to write capture meta", "url", bmark.url, "err", err)
+	}
+}
+
+// savePageNowAnonymous saves with a plain GET, which redirects to the snapshot once it's taken.
+func savePageNowAnonymous(ctx context.Context, client *http.Client, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://web.archive.org/save/"+pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status=%d", resp.StatusCode)
+	}
+
+	if loc := resp.Header.Get("Content-Location"); strings.HasPrefix(loc, "/web/") {
+		return "https://web.archive.org" + loc, nil
+	}
+	if final := resp.Request.URL; strings.HasPrefix(final.Path, "/web/") {
+		return final.String(), nil
+	}
+	return "", errors.New("no snapshot url in the response")
+}
+
+// savePageNowAuthenticated uses the save page now 2 api: it starts a job,
+// which is polled until the snapshot is taken.
+func savePageNowAuthenticated(ctx context.Context, client *http.Client, pageURL string) (string, error) {
+	call := func(method, endpoint string, form url.Values, out any) error {
+		req, err := http.NewRequestWithContext(ctx, method, "https://web.archive.org"+endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "LOW "+waybackKeys)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: status=%d", endpoint, resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	var job struct {
+		JobID   string `json:"job_id"`
+		Message string `json:"message"`
+	}
+	if err := call(http.MethodPost, "/save", url.Values{"url": {pageURL}}, &job); err != nil {
+		return "", err
+	}
+	if len(job.JobID) == 0 {
+		return "", fmt.Errorf("no job started: %s", job.Message)
+	}
+
+	for {
+		if err := sleep(ctx, 5*time.Second); err != nil {
+			return "", err
+		}
+
+		var status struct {
+			Status      string `json:"status"`
+			Timestamp   string `json:"timestamp"`
+			OriginalURL string `json:"original_url"`
+			Message     string `json:"message"`
+		}
+		if err := call(http.MethodGet, "/save/status/"+job.JobID, nil, &status); err != nil {
+			return "", err
+		}
+		switch status.Status {
+		case "success":
+			return fmt.Sprintf("https://web.archive.org/web/%s/%s", status.Timestamp, status.OriginalURL), nil
+		case "error":
+			return "", errors.New(status.Message)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package uebarchive
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/index"
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var (
+	serveAddr string
+	// queueToken must be sent as the bearer token to queue pages on the daemon
+	queueToken string
+)
+
+func runServe(ctx context.Context, _ []string) error {
+	return serve(ctx, serveAddr, archiveMux(nil))
+}
+
+// archiveMux serves the archive root, along with a few generated endpoints.
+// Pages can be queued only on the daemon (queue is nil otherwise) with the -queue-token,
+// anyone able to queue a page makes us fetch whatever url they want.
+func archiveMux(queue chan<- queueRequest) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sitemap.xml", serveSitemap)
+	mux.HandleFunc("GET /metrics", serveMetrics)
+	mux.HandleFunc("GET /replay", serveReplay)
+	if queue != nil && len(queueToken) > 0 {
+		mux.Handle("POST /queue", withToken(queueToken, queueHandler(queue)))
+		mux.Handle("POST /api/archive", withToken(queueToken, apiArchive(queue)))
+	}
+	mux.HandleFunc("GET /api/bookmarks", apiBookmarks)
+	mux.HandleFunc("GET /api/bookmarks/{id}", apiBookmark)
+	mux.Handle("GET /", publicOnly(gzipped(http.FileServer(http.Dir(archiveRoot)))))
+	return mux
+}
+
+// withToken lets through only requests with the "Authorization: Bearer <token>" header.
+func withToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "bad or missing token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publicPages are the generated pages at the archive root,
+// everything else there (the state db, logs, warcs) is not for the reader.
+var publicPages = map[string]bool{
+	"index.html":    true,
+	"index.json":    true,
+	"feed.xml":      true,
+	"stats.html":    true,
+	"failures.html": true,
+	"failures.json": true,
+	"links.html":    true,
+}
+
+// publicOnly serves the index pages, the captures and the by-title links, 404 for the rest.
+func publicOnly(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		top, _, nested := strings.Cut(name, "/")
+		switch {
+		case len(name) == 0:
+		case nested && (top == "captures" || top == titleLinksDir):
+		case !nested && publicPages[name]:
+		case !nested && isIndexPage(name):
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// isIndexPage says if it's one of the index-N.html pages, see index.PageName.
+func isIndexPage(name string) bool {
+	n, ok := strings.CutPrefix(name, "index-")
+	if !ok {
+		return false
+	}
+	n, ok = strings.CutSuffix(n, ".html")
+	_, err := strconv.Atoi(n)
+	return ok && err == nil
+}
+
+// serve runs the http server, blocks until the context is done.
+func serve(ctx context.Context, addr string, mux *http.ServeMux) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("serve archive: %w", err)
+	}
+
+	srv := &http.Server{Handler: mux}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	slog.Info("serving archive", "root", archiveRoot, "addr", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve archive: %w", err)
+	}
+	return nil
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// serveSitemap lists every archived entry point, so a crawler could index the archive.
+// It's built from the index.json, so it's always in sync with the last run.
+func serveSitemap(w http.ResponseWriter, r *http.Request) {
+	entries, err := readManifest()
+	if err != nil {
+		slog.Warn("sitemap: read manifest", "err", err)
+		http.Error(w, "no manifest, run the archiver first", http.StatusServiceUnavailable)
+		return
+	}
+
+	base := feedBaseURL
+	if len(base) == 0 {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	urlset := sitemapURLSet{
+		URLs: []sitemapURL{{Loc: base + "/index.html"}},
+	}
+	for _, entry := range entries {
+		if len(entry.Path) == 0 {
+			continue
+		}
+
+		u := sitemapURL{Loc: base + "/" + index.FileHref(entry.Path)}
+		if !entry.ArchivedAt.IsZero() {
+			u.LastMod = entry.ArchivedAt.UTC().Format(time.RFC3339)
+		}
+		urlset.URLs = append(urlset.URLs, u)
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(urlset); err != nil {
+		slog.Warn("sitemap: write response", "err", err)
+	}
+}
+
+// readManifest loads the index.json written by the last run.
+func readManifest() ([]store.Entry, error) {
+	return store.ReadManifest(archiveRoot)
+}
+
+// gzipped serves the .gz copy of a file instead of the file, if the compress
+// post-processing step has made one and the client accepts gzip.
+func gzipped(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := path.Join(archiveRoot, path.Clean("/"+r.URL.Path))
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || len(ctype) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		f, err := os.Open(name + ".gz")
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
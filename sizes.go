@@ -0,0 +1,61 @@
+package uebarchive
+
+import (
+	"cmp"
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// largest captures listed on the stats page
+const largestCapturesShown = 20
+
+// captureDiskUsage is what the capture directory takes on the disk, everything in it:
+// the gzipped copies, the meta.json and the rest which is not a captured file.
+func captureDiskUsage(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(filepath.Join(archiveRoot, dir), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += fileDiskUsage(info)
+		}
+		return nil
+	})
+	return total
+}
+
+// diskUsage is what the bookmark's capture takes on the disk, counted now
+// for the captures made before it was recorded, or the size of its files
+// if it's not in a capture directory of its own.
+func (b bookmark) diskUsage() int64 {
+	if b.archiveMeta == nil {
+		return 0
+	}
+	if b.archiveMeta.diskSize > 0 {
+		return b.archiveMeta.diskSize
+	}
+	return cmp.Or(captureDiskUsage(b.captureDir()), b.archiveMeta.size)
+}
+
+// largestCaptures are the bookmarks taking the most of the disk, the largest first.
+func largestCaptures(list []bookmark, n int) []bookmark {
+	type usage struct {
+		bmark bookmark
+		size  int64
+	}
+	var captured []usage
+	for _, bmark := range list {
+		if bmark.archiveMeta != nil {
+			captured = append(captured, usage{bmark, bmark.diskUsage()})
+		}
+	}
+	slices.SortStableFunc(captured, func(a, b usage) int { return cmp.Compare(b.size, a.size) })
+
+	largest := make([]bookmark, 0, n)
+	for _, u := range captured[:min(n, len(captured))] {
+		largest = append(largest, u.bmark)
+	}
+	return largest
+}
@@ -0,0 +1,110 @@
+package uebarchive
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// sortBookmarks orders the list in-place with a given compare function,
+// ties keep the original database order.
+func sortBookmarks(list []bookmark, compare func(a, b bookmark) int) {
+	if compare == nil {
+		return
+	}
+	slices.SortStableFunc(list, compare)
+}
+
+// bookmarkOrder builds a compare function from -sort and -order flags,
+// returns nil if no sorting was requested. Bookmarks that have no archive
+// (for archive-date and size) are treated as zero values.
+func bookmarkOrder(by, order string) (func(a, b bookmark) int, error) {
+	if len(by) == 0 {
+		return nil, nil
+	}
+
+	var compare func(a, b bookmark) int
+	switch by {
+	case "title":
+		compare = func(a, b bookmark) int {
+			return cmp.Compare(strings.ToLower(a.displayTitle()), strings.ToLower(b.displayTitle()))
+		}
+	case "date-added":
+		compare = func(a, b bookmark) int {
+			return a.dateAdded.Compare(b.dateAdded)
+		}
+	case "archive-date":
+		compare = func(a, b bookmark) int {
+			var at, bt int64
+			if a.archiveMeta != nil {
+				at = a.archiveMeta.archivedAt.UnixNano()
+			}
+			if b.archiveMeta != nil {
+				bt = b.archiveMeta.archivedAt.UnixNano()
+			}
+			return cmp.Compare(at, bt)
+		}
+	case "size":
+		compare = func(a, b bookmark) int {
+			var as, bs int64
+			if a.archiveMeta != nil {
+				as = a.archiveMeta.size
+			}
+			if b.archiveMeta != nil {
+				bs = b.archiveMeta.size
+			}
+			return cmp.Compare(as, bs)
+		}
+	case "domain":
+		compare = func(a, b bookmark) int {
+			return cmp.Compare(a.domain(), b.domain())
+		}
+	case "position":
+		// the ones not from the folder, e.g. added with the add command, go last
+		compare = func(a, b bookmark) int {
+			ap, bp := a.position, b.position
+			if ap == 0 {
+				ap = math.MaxInt
+			}
+			if bp == 0 {
+				bp = math.MaxInt
+			}
+			return cmp.Compare(ap, bp)
+		}
+	default:
+		return nil, fmt.Errorf("unknown -sort key %q", by)
+	}
+
+	switch order {
+	case "asc":
+	case "desc":
+		asc := compare
+		compare = func(a, b bookmark) int { return asc(b, a) }
+	default:
+		return nil, fmt.Errorf("unknown -order %q", order)
+	}
+
+	return compare, nil
+}
+
+// host returns bookmark's host name, without a port.
+func (b bookmark) host() string {
+	u, err := url.Parse(b.url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// domain returns bookmark's host without the "www." prefix,
+// or the raw url if it can't be parsed.
+func (b bookmark) domain() string {
+	u, err := url.Parse(b.url)
+	if err != nil || len(u.Hostname()) == 0 {
+		return b.url
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,79 @@
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// BukuDB is the path of buku's database, see BukuCmd.get_default_dbdir in buku.
+func BukuDB() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if len(dir) == 0 {
+		switch runtime.GOOS {
+		case "windows":
+			dir = os.Getenv("APPDATA")
+		default:
+			homedir, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("get user home dir: %w", err)
+			}
+			dir = filepath.Join(homedir, ".local", "share")
+		}
+	}
+	return filepath.Join(dir, "buku", "bookmarks.db"), nil
+}
+
+// BukuBookmarks reads the bookmarks of buku's database tagged with the tag, in the order
+// they were added. Buku has no folders and dates, the description is the note.
+func BukuBookmarks(ctx context.Context, dbPath, tag string) ([]Bookmark, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	// buku doesn't hold the database open, there is no need for a snapshot
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", dbPath))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `
+		select URL, coalesce(metadata, ''), coalesce(tags, ''), coalesce(desc, '')
+		from bookmarks
+		order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		var tags string
+		if err := rows.Scan(&b.URL, &b.Title, &tags, &b.Description); err != nil {
+			return nil, fmt.Errorf("query bookmarks: %w", err)
+		}
+		// tags are kept as ",one,two,"
+		tagged := false
+		for _, t := range strings.Split(tags, ",") {
+			if t = strings.TrimSpace(t); len(t) > 0 {
+				b.Tags = append(b.Tags, t)
+				tagged = tagged || strings.EqualFold(t, tag)
+			}
+		}
+		if !tagged {
+			continue
+		}
+		b.Hash = URLHash(b.URL)
+		b.Position = len(list)
+		list = append(list, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query bookmarks: %w", err)
+	}
+	return list, nil
+}
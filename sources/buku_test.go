@@ -0,0 +1,40 @@
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBukuBookmarks(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "bookmarks.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// buku's own schema
+	_, err = db.Exec(`
+		create table bookmarks (id integer primary key, URL text not null unique, metadata text default '', tags text default ',', desc text default '', flags integer default 0);
+		insert into bookmarks (URL, metadata, tags, desc) values
+			('https://go.dev/', 'Go', ',archive,lang,', 'the language'),
+			('https://example.com/', 'Example', ',misc,', ''),
+			('https://pkg.go.dev/', null, ',Archive,', null);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := BukuBookmarks(context.Background(), dbPath, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{Title: "Go", URL: "https://go.dev/", Hash: URLHash("https://go.dev/"), Tags: []string{"archive", "lang"}, Description: "the language", Position: 0},
+		{URL: "https://pkg.go.dev/", Hash: URLHash("https://pkg.go.dev/"), Tags: []string{"Archive"}, Position: 1},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("got  %+v\nwant %+v", list, want)
+	}
+}
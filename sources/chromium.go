@@ -0,0 +1,206 @@
+package sources
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// chromiumDirs are the user data directories of chromium browsers,
+// relative to the config directory of the system, see ChromiumProfileDir.
+var chromiumDirs = map[string]map[string]string{
+	"chrome": {
+		"linux":   "google-chrome",
+		"darwin":  "Google/Chrome",
+		"windows": `Google\Chrome\User Data`,
+	},
+	"chromium": {
+		"linux":   "chromium",
+		"darwin":  "Chromium",
+		"windows": `Chromium\User Data`,
+	},
+	"brave": {
+		"linux":   "BraveSoftware/Brave-Browser",
+		"darwin":  "BraveSoftware/Brave-Browser",
+		"windows": `BraveSoftware\Brave-Browser\User Data`,
+	},
+	"edge": {
+		"linux":   "microsoft-edge",
+		"darwin":  "Microsoft Edge",
+		"windows": `Microsoft\Edge\User Data`,
+	},
+	"vivaldi": {
+		"linux":   "vivaldi",
+		"darwin":  "Vivaldi",
+		"windows": `Vivaldi\User Data`,
+	},
+}
+
+// IsChromium tells if the browser is one of the chromium ones ChromiumProfileDir knows.
+func IsChromium(browser string) bool {
+	_, ok := chromiumDirs[browser]
+	return ok
+}
+
+// ChromiumProfileDir is the directory of the browser's profile, the name is
+// of the directory in the user data one, e.g. Default or "Profile 1".
+func ChromiumProfileDir(browser, profile string) (string, error) {
+	dataDir, err := chromiumDataDir(browser)
+	if err != nil {
+		return "", err
+	}
+	profileDir := filepath.Join(dataDir, profile)
+	if _, err := os.Stat(profileDir); err != nil {
+		return "", fmt.Errorf("no %s profile: %w", browser, err)
+	}
+	return profileDir, nil
+}
+
+// ChromiumProfile is a profile of a chromium browser, Dir is ChromiumProfileDir's name of it,
+// Name is the one the browser shows.
+type ChromiumProfile struct {
+	Dir  string
+	Name string
+}
+
+// ChromiumProfiles lists the browser's profiles which have bookmarks, as its Local State knows them.
+func ChromiumProfiles(browser string) ([]ChromiumProfile, error) {
+	dataDir, err := chromiumDataDir(browser)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := os.ReadFile(filepath.Join(dataDir, "Local State"))
+	if err != nil {
+		return nil, fmt.Errorf("no %s profiles: %w", browser, err)
+	}
+	var state struct {
+		Profile struct {
+			InfoCache map[string]struct {
+				Name string `json:"name"`
+			} `json:"info_cache"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(bs, &state); err != nil {
+		return nil, fmt.Errorf("parse Local State: %w", err)
+	}
+
+	var list []ChromiumProfile
+	for dir, info := range state.Profile.InfoCache {
+		if _, err := os.Stat(filepath.Join(dataDir, dir, "Bookmarks")); err == nil {
+			list = append(list, ChromiumProfile{Dir: dir, Name: cmp.Or(info.Name, dir)})
+		}
+	}
+	slices.SortFunc(list, func(a, b ChromiumProfile) int { return cmp.Compare(a.Dir, b.Dir) })
+	return list, nil
+}
+
+// chromiumDataDir is the user data directory of the browser, with its profiles in it.
+func chromiumDataDir(browser string) (string, error) {
+	dirs, ok := chromiumDirs[browser]
+	if !ok {
+		return "", fmt.Errorf("unknown chromium browser %q", browser)
+	}
+	dir, ok := dirs[runtime.GOOS]
+	if !ok {
+		// the BSDs package chromium with the linux layout
+		dir = dirs["linux"]
+	}
+
+	// chromium keeps its data in the local appdata on windows, not in the roaming one
+	base := os.Getenv("LOCALAPPDATA")
+	if runtime.GOOS != "windows" || len(base) == 0 {
+		var err error
+		if base, err = os.UserConfigDir(); err != nil {
+			return "", fmt.Errorf("get user config dir: %w", err)
+		}
+	}
+	return filepath.Join(base, dir), nil
+}
+
+// chromiumNode is a bookmark or a folder of chromium's Bookmarks file.
+type chromiumNode struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	URL      string         `json:"url"`
+	Added    string         `json:"date_added"`
+	Modified string         `json:"date_modified"`
+	Children []chromiumNode `json:"children"`
+}
+
+// ChromiumFolder reads bookmarks from the folder of chromium's Bookmarks file,
+// in the order they are arranged in the folder. Chromium has no tags and notes.
+func ChromiumFolder(bookmarksFile, folder string) ([]Bookmark, error) {
+	bs, err := os.ReadFile(bookmarksFile)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.Unmarshal(bs, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", bookmarksFile, err)
+	}
+
+	var found *chromiumNode
+	var find func(node *chromiumNode)
+	find = func(node *chromiumNode) {
+		for i := range node.Children {
+			if found != nil {
+				return
+			}
+			child := &node.Children[i]
+			if child.Type == "folder" && child.Name == folder {
+				found = child
+				return
+			}
+			find(child)
+		}
+	}
+	// the bar goes first, like in the browser's bookmark manager
+	for _, name := range []string{"bookmark_bar", "other", "synced"} {
+		var root chromiumNode
+		if raw, ok := file.Roots[name]; !ok || json.Unmarshal(raw, &root) != nil {
+			continue
+		}
+		if find(&root); found != nil {
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no folder %q in %s", folder, bookmarksFile)
+	}
+
+	var list []Bookmark
+	for position, node := range found.Children {
+		if node.Type != "url" {
+			continue
+		}
+		list = append(list, Bookmark{
+			Title:        node.Name,
+			URL:          node.URL,
+			Hash:         URLHash(node.URL),
+			Position:     position,
+			DateAdded:    chromiumTime(node.Added),
+			LastModified: chromiumTime(node.Modified),
+		})
+	}
+	return list, nil
+}
+
+// chromiumTime parses chromium's timestamps: microseconds since 1601,
+// as a string. Zero time if it's not set.
+func chromiumTime(s string) time.Time {
+	usec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || usec <= 0 {
+		return time.Time{}
+	}
+	// seconds between 1601-01-01 and 1970-01-01
+	const epochDelta = 11644473600
+	return time.UnixMicro(usec - epochDelta*1_000_000)
+}
@@ -0,0 +1,42 @@
+package sources
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChromiumFolder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "Bookmarks")
+	writeFile(t, name, `{"roots": {
+		"bookmark_bar": {"type": "folder", "name": "Bookmarks bar", "children": [
+			{"type": "url", "name": "Outside", "url": "https://example.com/"}
+		]},
+		"other": {"type": "folder", "name": "Other bookmarks", "children": [
+			{"type": "folder", "name": "reading", "children": [
+				{"type": "folder", "name": "archive", "children": [
+					{"type": "url", "name": "Go", "url": "https://go.dev/", "date_added": "13350000000000000"},
+					{"type": "folder", "name": "nested", "children": []},
+					{"type": "url", "name": "Docs", "url": "https://pkg.go.dev/", "date_added": "0"}
+				]}
+			]}
+		]}
+	}}`)
+
+	list, err := ChromiumFolder(name, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{Title: "Go", URL: "https://go.dev/", Hash: URLHash("https://go.dev/"), Position: 0, DateAdded: time.UnixMicro(13350000000000000 - 11644473600_000000)},
+		{Title: "Docs", URL: "https://pkg.go.dev/", Hash: URLHash("https://pkg.go.dev/"), Position: 2},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("got  %+v\nwant %+v", list, want)
+	}
+
+	if _, err := ChromiumFolder(name, "missing"); err == nil {
+		t.Error("want an error for a missing folder, got none")
+	}
+}
@@ -0,0 +1,132 @@
+package sources
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// metaCharsetRe is the charset of <meta charset> and of <meta http-equiv="Content-Type">
+var metaCharsetRe = regexp.MustCompile(`(?i)(<meta\b[^>]*\bcharset\s*=\s*["']?)([\w.:-]+)`)
+
+// Email is a message parsed for archiving: the html body, or the text one
+// if there is no html, of a multipart message the first of them.
+type Email struct {
+	MessageID string
+	Subject   string
+	From      string
+	Date      time.Time
+	HTML      []byte
+	Text      []byte
+}
+
+// ParseEmail parses the message, the bodies are decoded from base64 and quoted-printable,
+// and from their charset to utf-8, unless it's unknown, then they are left as they are.
+func ParseEmail(raw []byte) (Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Email{}, err
+	}
+	dec := new(mime.WordDecoder)
+	header := func(name string) string {
+		value := msg.Header.Get(name)
+		if decoded, err := dec.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+
+	e := Email{
+		MessageID: strings.Trim(msg.Header.Get("Message-Id"), "<> "),
+		Subject:   header("Subject"),
+		From:      header("From"),
+	}
+	if from, err := mail.ParseAddress(e.From); err == nil {
+		e.From = from.Name
+		if len(e.From) == 0 {
+			e.From = from.Address
+		}
+	}
+	e.Date, _ = msg.Header.Date()
+	err = e.readPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	return e, err
+}
+
+// readPart takes the html and text bodies out of the part, going into multiparts.
+func (e *Email) readPart(contentType, encoding string, body io.Reader) error {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// no or broken content type is plain text
+		mt = "text/plain"
+	}
+
+	if strings.HasPrefix(mt, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			if err := e.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); err != nil {
+				return err
+			}
+		}
+	}
+
+	if (mt != "text/html" || len(e.HTML) > 0) && (mt != "text/plain" || len(e.Text) > 0) {
+		return nil
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	content = toUTF8(content, params["charset"], mt == "text/html")
+	if mt == "text/html" {
+		e.HTML = content
+	} else {
+		e.Text = content
+	}
+	return nil
+}
+
+// toUTF8 decodes the body of the charset, the html's own charset declarations
+// are changed to utf-8 then, a browser would take the bytes for that charset.
+func toUTF8(content []byte, charset string, isHTML bool) []byte {
+	enc, err := htmlindex.Get(strings.TrimSpace(charset))
+	if err != nil {
+		// no charset is us-ascii, which utf-8 covers, and an unknown one is left as is
+		return content
+	}
+	if name, _ := htmlindex.Name(enc); name != "utf-8" {
+		decoded, err := enc.NewDecoder().Bytes(content)
+		if err != nil {
+			return content
+		}
+		content = decoded
+	}
+	if isHTML {
+		content = metaCharsetRe.ReplaceAll(content, []byte("${1}utf-8"))
+	}
+	return content
+}
@@ -0,0 +1,363 @@
+// Package sources reads bookmarks from where the browsers keep them: their profiles, files and sync servers.
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/ini.v1"
+)
+
+// Bookmark is a bookmark as the browser has it.
+type Bookmark struct {
+	Title string
+	URL   string
+	// Hash is firefox's url_hash of the url, see URLHash
+	Hash      int64
+	DateAdded time.Time
+	Tags      []string
+	// Position is the bookmark's place in its folder, from 0
+	Position int
+	// LastModified is when the bookmark was last edited, the title or the url
+	LastModified time.Time
+	// Description is the user's note on the bookmark, see bookmarkDescriptions
+	Description string
+	// ID is the bookmark's id in the sources written back to, e.g. linkding
+	ID string
+}
+
+// FirefoxProfile is a profile of firefox's profiles.ini, Section is what it's known by
+// there, e.g. Profile0, Name is the one firefox shows.
+type FirefoxProfile struct {
+	Section string
+	Name    string
+	Dir     string
+}
+
+// FindFirefoxProfile finds the profile of the named ini section in firefox's profiles.ini.
+func FindFirefoxProfile(section string) (FirefoxProfile, error) {
+	ffDir, profiles, err := loadFirefoxProfiles()
+	if err != nil {
+		return FirefoxProfile{}, err
+	}
+
+	profile, err := profiles.GetSection(section)
+	if err != nil {
+		return FirefoxProfile{}, fmt.Errorf("get profile from ini: %w", err)
+	}
+	profileName, err := profile.GetKey("Name")
+	if err != nil {
+		return FirefoxProfile{}, fmt.Errorf("get .Name section from profile: %w", err)
+	}
+	profilePath, err := profile.GetKey("Path")
+	if err != nil {
+		return FirefoxProfile{}, fmt.Errorf("get .Path section from a profile: %w", err)
+	}
+
+	slog.Debug("found firefox profile", "name", profileName.String(), "path", profilePath.String())
+	return FirefoxProfile{Section: section, Name: profileName.String(), Dir: path.Join(ffDir, profilePath.String())}, nil
+}
+
+// FirefoxProfiles lists all profiles of firefox's profiles.ini.
+func FirefoxProfiles() ([]FirefoxProfile, error) {
+	ffDir, profiles, err := loadFirefoxProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []FirefoxProfile
+	for _, profile := range profiles.Sections() {
+		// the rest are the General and Install ones
+		if !profile.HasKey("Path") {
+			continue
+		}
+		list = append(list, FirefoxProfile{
+			Section: profile.Name(),
+			Name:    profile.Key("Name").String(),
+			Dir:     path.Join(ffDir, profile.Key("Path").String()),
+		})
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no profiles in profiles.ini")
+	}
+	return list, nil
+}
+
+func loadFirefoxProfiles() (string, *ini.File, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil, fmt.Errorf("get user home dir: %w", err)
+	}
+
+	ffDir := path.Join(homedir, ".mozilla/firefox")
+	ffProfilePath := path.Join(ffDir, "profiles.ini")
+
+	slog.Debug("reading firefox profiles", "path", ffProfilePath)
+	profiles, err := ini.Load(ffProfilePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("read profiles.ini from %s: %w", ffProfilePath, err)
+	}
+	return ffDir, profiles, nil
+}
+
+// OpenPlaces opens a snapshot of the places database, made with VACUUM INTO,
+// so it's consistent, with the recent changes of the -wal file in it.
+// Firefox keeps the database locked while it runs, then the files are copied,
+// until a copy passes the integrity check, a write may tear it.
+// The returned func closes the database and removes the snapshot.
+func OpenPlaces(dbPath string) (*sql.DB, func(), error) {
+	dir, err := os.MkdirTemp("", "ueb-archive-places-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	snapshot := filepath.Join(dir, "places.sqlite")
+	if err := vacuumInto(dbPath, snapshot); err != nil {
+		slog.Debug("can't snapshot places database, copying it", "err", err)
+		if err := copyPlaces(dbPath, snapshot); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+
+	connstr := fmt.Sprintf("file:%s", snapshot)
+	slog.Debug("opening places database", "connstr", connstr)
+	db, err := sql.Open("sqlite3", connstr)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return db, func() { db.Close(); cleanup() }, nil
+}
+
+// vacuumInto writes a consistent copy of the database, it fails right away
+// if the database is locked, firefox doesn't let it go while it runs.
+func vacuumInto(dbPath, snapshot string) error {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=100", dbPath))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`vacuum into ?`, snapshot)
+	return err
+}
+
+// copyPlaces copies the database with its -wal file, a few times if firefox
+// writes to them meanwhile and the copy doesn't pass the check.
+func copyPlaces(dbPath, snapshot string) error {
+	var err error
+	for range 3 {
+		os.Remove(snapshot + "-wal")
+		if err = copyFile(dbPath, snapshot); err != nil {
+			return err
+		}
+		if err = copyFile(dbPath+"-wal", snapshot+"-wal"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err = checkDB(snapshot); err == nil {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("copy of the places database is broken: %w", err)
+}
+
+func checkDB(dbPath string) error {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", dbPath))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow(`pragma quick_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return errors.New(result)
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// PlacesModTime is the last time firefox has written
+// to the places database, including its -wal file.
+func PlacesModTime(dbPath string) time.Time {
+	var latest time.Time
+	for _, name := range []string{dbPath, dbPath + "-wal"} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// FirefoxFolder reads bookmarks from the folder of a places database, see OpenPlaces,
+// in the order they are arranged in the folder.
+func FirefoxFolder(ctx context.Context, db *sql.DB, folder string) ([]Bookmark, error) {
+	// exchange folder name to its id, type=2 is folder
+	row := db.QueryRowContext(ctx, `select id from moz_bookmarks where title=? and type=2`, folder)
+	var folderID int64
+	if err := row.Scan(&folderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no folder %q in firefox bookmarks", folder)
+		}
+		return nil, fmt.Errorf("query moz_bookmarks table: %w", err)
+	}
+	slog.Debug("get bookmarks: found folder", "folder", folder, "id", folderID)
+
+	tags, err := placeTags(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	descriptions, err := bookmarkDescriptions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// type=1 is bookmark, its fk points to the place, i.e. the url, in moz_places;
+	// places of pages which have never been visited have no title
+	rows, err := db.QueryContext(ctx, `select b.id, p.id, coalesce(p.title, b.title, ''), coalesce(p.url_hash, 0), p.url,
+			coalesce(b.position, 0), coalesce(b.dateAdded, 0), coalesce(b.lastModified, 0)
+		from moz_bookmarks b
+		join moz_places p on p.id = b.fk
+		where b.parent = ? and b.type = 1
+		order by b.position, b.id`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("query bookmarks from a folder: %w", err)
+	}
+	defer rows.Close()
+
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var id, placeID, dateAdded, lastModified int64
+		var tmp Bookmark
+		if err := rows.Scan(&id, &placeID, &tmp.Title, &tmp.Hash, &tmp.URL, &tmp.Position, &dateAdded, &lastModified); err != nil {
+			return nil, fmt.Errorf("query bookmarks from a folder: %w", err)
+		}
+		if tmp.Hash == 0 {
+			tmp.Hash = URLHash(tmp.URL)
+		}
+		// firefox stores PRTime, which is microseconds since epoch
+		if dateAdded > 0 {
+			tmp.DateAdded = time.UnixMicro(dateAdded)
+		}
+		if lastModified > 0 {
+			tmp.LastModified = time.UnixMicro(lastModified)
+		}
+		tmp.Tags = tags[placeID]
+		tmp.Description = descriptions[id]
+		bookmarks = append(bookmarks, tmp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query bookmarks from a folder: %w", err)
+	}
+
+	slog.Debug("get bookmarks: found bookmarks", "count", len(bookmarks))
+	return bookmarks, nil
+}
+
+// bookmarkDescriptions returns descriptions of bookmarks by their id. Firefox has
+// dropped the field from the ui and the annotations table with it, but profiles
+// from the old days may still have them, and nothing is returned for the rest.
+func bookmarkDescriptions(ctx context.Context, db *sql.DB) (map[int64]string, error) {
+	descriptions := make(map[int64]string)
+	var tables int
+	row := db.QueryRowContext(ctx, `select count(*) from sqlite_master
+		where type = 'table' and name in ('moz_items_annos', 'moz_anno_attributes')`)
+	if err := row.Scan(&tables); err != nil {
+		return nil, fmt.Errorf("query annotation tables: %w", err)
+	}
+	if tables < 2 {
+		return descriptions, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `select a.item_id, a.content from moz_items_annos a
+		join moz_anno_attributes n on n.id = a.anno_attribute_id
+		where n.name = 'bookmarkProperties/description' and a.content is not null`)
+	if err != nil {
+		return nil, fmt.Errorf("query descriptions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var description string
+		if err := rows.Scan(&id, &description); err != nil {
+			return nil, fmt.Errorf("query description row: %w", err)
+		}
+		descriptions[id] = strings.TrimSpace(description)
+	}
+	return descriptions, rows.Err()
+}
+
+// placeTags returns tags of every tagged place by its id. A tag is a folder
+// in the tags root, with a bookmark of every place tagged with it.
+func placeTags(ctx context.Context, db *sql.DB) (map[int64][]string, error) {
+	rows, err := db.QueryContext(ctx, `select b.fk, t.title from moz_bookmarks b
+		join moz_bookmarks t on t.id = b.parent
+		join moz_bookmarks r on r.id = t.parent
+		where r.guid = 'tags________' and b.type = 1`)
+	if err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var placeID int64
+		var tag string
+		if err := rows.Scan(&placeID, &tag); err != nil {
+			return nil, fmt.Errorf("query tag row: %w", err)
+		}
+		tags[placeID] = append(tags[placeID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// URLHash is the url_hash firefox would give the url, so the same page
+// bookmarked later in firefox is recognized as the same one.
+// See HashURL in toolkit/components/places/Helpers.cpp.
+func URLHash(url string) int64 {
+	const maxLenToHash = 1500
+	hashString := func(s string) uint32 {
+		var h uint32
+		for i := 0; i < len(s); i++ {
+			// mozilla::AddToHash
+			h = 0x9E3779B9 * (bits.RotateLeft32(h, 5) ^ uint32(s[i]))
+		}
+		return h
+	}
+
+	scheme, _, _ := strings.Cut(url, ":")
+	prefix := uint64(hashString(scheme) & 0x0000FFFF)
+	return int64(prefix<<32 + uint64(hashString(url[:min(len(url), maxLenToHash)])))
+}
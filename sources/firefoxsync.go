@@ -0,0 +1,651 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FirefoxAccountsURL is the api of mozilla's accounts server
+	FirefoxAccountsURL = "https://api.accounts.firefox.com/v1"
+	// SyncTokenServerURL gives the storage server of an account and the credentials for it
+	SyncTokenServerURL = "https://token.services.mozilla.com/1.0/sync/1.5"
+
+	// firefox desktop's client id, the fxa-credentials grant is for mozilla's own clients
+	firefoxClientID = "5882386c6d801776"
+	oldSyncScope    = "https://identity.mozilla.com/apps/oldsync"
+)
+
+// SyncAccount is a signed in firefox account, what it takes
+// to read the sync data without the password. KB decrypts the data,
+// keep it as safe as the password itself.
+type SyncAccount struct {
+	Email string `json:"email"`
+	UID   string `json:"uid"`
+	// SessionToken signs requests to the accounts server, hex
+	SessionToken string `json:"session_token"`
+	// KB is the account's sync key, hex
+	KB string `json:"kb"`
+
+	AccountsURL    string `json:"accounts_url"`
+	TokenServerURL string `json:"token_server_url"`
+
+	// the storage credentials last for an hour or so, there is no need to
+	// ask for new ones on every read
+	storage *syncStorage
+}
+
+// SyncSignIn is a sign in to a firefox account in progress.
+// An unverified one must be confirmed with a code before the keys are given.
+type SyncSignIn struct {
+	Verified bool
+	// Method is how the sign in is confirmed: email-otp for a code sent by email,
+	// totp-2fa for a code of the authenticator app
+	Method string
+
+	client        *http.Client
+	account       SyncAccount
+	keyFetchToken []byte
+	unwrapBKey    []byte
+}
+
+// SignInSync signs in to a firefox account with the password, see
+// https://github.com/mozilla/ecosystem-platform/blob/master/docs/reference/onepw-protocol.md
+// The password is stretched the same way firefox does, it's never sent as is.
+func SignInSync(ctx context.Context, client *http.Client, accountsURL, tokenServerURL, email, password string) (*SyncSignIn, error) {
+	accountsURL = strings.TrimSuffix(accountsURL, "/")
+	for {
+		authPW, unwrapBKey, err := stretchPassword(email, password)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp struct {
+			UID                string `json:"uid"`
+			SessionToken       string `json:"sessionToken"`
+			KeyFetchToken      string `json:"keyFetchToken"`
+			Verified           bool   `json:"verified"`
+			VerificationMethod string `json:"verificationMethod"`
+		}
+		err = fxaRequest(ctx, client, accountsURL, http.MethodPost, "/account/login?keys=true", nil, map[string]any{
+			"email":              email,
+			"authPW":             hex.EncodeToString(authPW),
+			"reason":             "signin",
+			"service":            "sync",
+			"verificationMethod": "email-otp",
+		}, &resp)
+		var fxaErr *fxaError
+		if errors.As(err, &fxaErr) && fxaErr.Errno == fxaIncorrectEmailCase && len(fxaErr.Email) > 0 && fxaErr.Email != email {
+			// the password is salted with the email as it was signed up with
+			email = fxaErr.Email
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sign in: %w", err)
+		}
+
+		keyFetchToken, err := hex.DecodeString(resp.KeyFetchToken)
+		if err != nil {
+			return nil, fmt.Errorf("sign in: key fetch token: %w", err)
+		}
+		return &SyncSignIn{
+			Verified: resp.Verified,
+			Method:   resp.VerificationMethod,
+			client:   client,
+			account: SyncAccount{
+				Email:          email,
+				UID:            resp.UID,
+				SessionToken:   resp.SessionToken,
+				AccountsURL:    accountsURL,
+				TokenServerURL: tokenServerURL,
+			},
+			keyFetchToken: keyFetchToken,
+			unwrapBKey:    unwrapBKey,
+		}, nil
+	}
+}
+
+// stretchPassword derives authPW, which is sent instead of the password,
+// and unwrapBKey, which kB is unwrapped with, the email is the salt.
+func stretchPassword(email, password string) (authPW, unwrapBKey []byte, err error) {
+	stretched, err := pbkdf2.Key(sha256.New, password, []byte(piclKey("quickStretch:"+email)), 1000, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	if authPW, err = hkdf.Key(sha256.New, stretched, nil, piclKey("authPW"), 32); err != nil {
+		return nil, nil, err
+	}
+	if unwrapBKey, err = hkdf.Key(sha256.New, stretched, nil, piclKey("unwrapBkey"), 32); err != nil {
+		return nil, nil, err
+	}
+	return authPW, unwrapBKey, nil
+}
+
+// Confirm verifies the sign in with the code, sent by email or of the authenticator app.
+func (s *SyncSignIn) Confirm(ctx context.Context, code string) error {
+	creds, err := s.account.sessionCredentials()
+	if err != nil {
+		return err
+	}
+
+	endpoint := "/session/verify_code"
+	if s.Method == "totp-2fa" {
+		endpoint = "/session/verify/totp"
+	}
+	var resp struct {
+		Success *bool `json:"success"`
+	}
+	if err := fxaRequest(ctx, s.client, s.account.AccountsURL, http.MethodPost, endpoint, &creds, map[string]string{"code": code}, &resp); err != nil {
+		return fmt.Errorf("confirm sign in: %w", err)
+	}
+	if resp.Success != nil && !*resp.Success {
+		return errors.New("confirm sign in: wrong code")
+	}
+	s.Verified = true
+	return nil
+}
+
+// Account fetches the sync key of the verified sign in.
+func (s *SyncSignIn) Account(ctx context.Context) (*SyncAccount, error) {
+	derived, err := hkdf.Key(sha256.New, s.keyFetchToken, nil, piclKey("keyFetchToken"), 96)
+	if err != nil {
+		return nil, err
+	}
+	creds := hawkCredentials{id: hex.EncodeToString(derived[:32]), key: derived[32:64]}
+
+	var resp struct {
+		Bundle string `json:"bundle"`
+	}
+	if err := fxaRequest(ctx, s.client, s.account.AccountsURL, http.MethodGet, "/account/keys", &creds, nil, &resp); err != nil {
+		return nil, fmt.Errorf("fetch keys: %w", err)
+	}
+	bundle, err := hex.DecodeString(resp.Bundle)
+	if err != nil || len(bundle) != 96 {
+		return nil, errors.New("fetch keys: malformed bundle")
+	}
+
+	keys, err := hkdf.Key(sha256.New, derived[64:], nil, piclKey("account/keys"), 96)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, keys[:32])
+	mac.Write(bundle[:64])
+	if !hmac.Equal(mac.Sum(nil), bundle[64:]) {
+		return nil, errors.New("fetch keys: bundle hmac mismatch")
+	}
+
+	// the bundle is kA and wrap(kB), xored with the key; kB is unwrapped by the password
+	kB := make([]byte, 32)
+	for i := range kB {
+		kB[i] = bundle[32+i] ^ keys[32+32+i] ^ s.unwrapBKey[i]
+	}
+	account := s.account
+	account.KB = hex.EncodeToString(kB)
+	return &account, nil
+}
+
+// FirefoxSyncFolder reads bookmarks from the folder synced to the account,
+// in the order they are arranged in the folder, like FirefoxFolder.
+func FirefoxSyncFolder(ctx context.Context, client *http.Client, account *SyncAccount, folder string) ([]Bookmark, error) {
+	storage, err := account.syncStorage(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := storage.get(ctx, client, "/storage/bookmarks?full=1")
+	if err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+	var bsos []syncBSO
+	if err := json.Unmarshal(body, &bsos); err != nil {
+		return nil, fmt.Errorf("get bookmarks: %w", err)
+	}
+
+	records := make(map[string]syncBookmark, len(bsos))
+	var folderRecord *syncBookmark
+	for _, bso := range bsos {
+		var record syncBookmark
+		if err := storage.decrypt("bookmarks", bso.Payload, &record); err != nil {
+			return nil, fmt.Errorf("decrypt bookmark %s: %w", bso.ID, err)
+		}
+		if record.Deleted {
+			continue
+		}
+		record.modified = bso.Modified
+		records[record.ID] = record
+		if folderRecord == nil && record.Type == "folder" && record.Title == folder {
+			folderRecord = &record
+		}
+	}
+	if folderRecord == nil {
+		return nil, fmt.Errorf("no folder %q in synced bookmarks", folder)
+	}
+	slog.Debug("get bookmarks: found synced folder", "folder", folder, "id", folderRecord.ID)
+
+	var list []Bookmark
+	for position, id := range folderRecord.Children {
+		record, ok := records[id]
+		if !ok || record.Type != "bookmark" || len(record.URI) == 0 {
+			continue
+		}
+		b := Bookmark{
+			Title:        record.Title,
+			URL:          record.URI,
+			Hash:         URLHash(record.URI),
+			Tags:         record.Tags,
+			Position:     position,
+			Description:  record.Description,
+			LastModified: time.UnixMilli(int64(record.modified * 1000)),
+		}
+		if record.DateAdded > 0 {
+			b.DateAdded = time.UnixMilli(record.DateAdded)
+		}
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+// SyncModTime is the last time the bookmarks were changed on the sync server.
+func SyncModTime(ctx context.Context, client *http.Client, account *SyncAccount) (time.Time, error) {
+	storage, err := account.syncStorage(ctx, client)
+	if err != nil {
+		return time.Time{}, err
+	}
+	body, err := storage.get(ctx, client, "/info/collections")
+	if err != nil {
+		return time.Time{}, err
+	}
+	var collections map[string]float64
+	if err := json.Unmarshal(body, &collections); err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(collections["bookmarks"])
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// syncBSO is a record of the storage server, the payload is encrypted, see decrypt.
+type syncBSO struct {
+	ID       string  `json:"id"`
+	Modified float64 `json:"modified"`
+	Payload  string  `json:"payload"`
+}
+
+// syncBookmark is a record of the bookmarks collection, see
+// https://mozilla-services.readthedocs.io/en/latest/sync/objectformats.html#bookmarks
+type syncBookmark struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Deleted     bool     `json:"deleted"`
+	Title       string   `json:"title"`
+	URI         string   `json:"bmkUri"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	Children    []string `json:"children"`
+	// DateAdded is in milliseconds
+	DateAdded int64 `json:"dateAdded"`
+
+	modified float64
+}
+
+// syncStorage is the account's storage server with the credentials for it,
+// and the keys to decrypt the collections with.
+type syncStorage struct {
+	endpoint string
+	creds    hawkCredentials
+	expires  time.Time
+
+	defaultKey  syncKeyBundle
+	collections map[string]syncKeyBundle
+}
+
+// syncKeyBundle decrypts and verifies records, see
+// https://mozilla-services.readthedocs.io/en/latest/sync/storageformat5.html
+type syncKeyBundle struct {
+	encKey  []byte
+	hmacKey []byte
+}
+
+// syncStorage exchanges the session for the storage credentials:
+// an oauth token for the token server, which gives the storage server
+// of the account. Then it reads the collection keys, encrypted with kB.
+func (a *SyncAccount) syncStorage(ctx context.Context, client *http.Client) (*syncStorage, error) {
+	if a.storage != nil && time.Now().Before(a.storage.expires) {
+		return a.storage, nil
+	}
+
+	kB, err := hex.DecodeString(a.KB)
+	if err != nil || len(kB) != 32 {
+		return nil, errors.New("malformed sync key, sign in again")
+	}
+	creds, err := a.sessionCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = fxaRequest(ctx, client, a.AccountsURL, http.MethodPost, "/oauth/token", &creds, map[string]any{
+		"client_id":   firefoxClientID,
+		"grant_type":  "fxa-credentials",
+		"scope":       oldSyncScope,
+		"access_type": "online",
+	}, &token)
+	if err != nil {
+		return nil, fmt.Errorf("get oauth token: %w", err)
+	}
+
+	var keyData map[string]struct {
+		KeyRotationTimestamp int64 `json:"keyRotationTimestamp"`
+	}
+	err = fxaRequest(ctx, client, a.AccountsURL, http.MethodPost, "/account/scoped-key-data", &creds, map[string]any{
+		"client_id": firefoxClientID,
+		"scope":     oldSyncScope,
+	}, &keyData)
+	if err != nil {
+		return nil, fmt.Errorf("get key data: %w", err)
+	}
+	kBHash := sha256.Sum256(kB)
+	keyID := fmt.Sprintf("%d-%s", keyData[oldSyncScope].KeyRotationTimestamp, base64.RawURLEncoding.EncodeToString(kBHash[:16]))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.TokenServerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("X-KeyID", keyID)
+	var node struct {
+		ID          string `json:"id"`
+		Key         string `json:"key"`
+		APIEndpoint string `json:"api_endpoint"`
+		Duration    int    `json:"duration"`
+	}
+	if err := doJSON(client, req, &node); err != nil {
+		return nil, fmt.Errorf("get sync token: %w", err)
+	}
+
+	storage := &syncStorage{
+		endpoint: strings.TrimSuffix(node.APIEndpoint, "/"),
+		// the key is used as is, it's not hex
+		creds: hawkCredentials{id: node.ID, key: []byte(node.Key)},
+		// renew it a bit before the server stops taking it
+		expires: time.Now().Add(time.Duration(node.Duration)*time.Second - time.Minute),
+	}
+	if storage.defaultKey, err = newSyncKeyBundle(kB); err != nil {
+		return nil, err
+	}
+
+	body, err := storage.get(ctx, client, "/storage/crypto/keys")
+	if err != nil {
+		return nil, fmt.Errorf("get crypto keys: %w", err)
+	}
+	var bso syncBSO
+	if err := json.Unmarshal(body, &bso); err != nil {
+		return nil, fmt.Errorf("get crypto keys: %w", err)
+	}
+	var keys struct {
+		Default     []string            `json:"default"`
+		Collections map[string][]string `json:"collections"`
+	}
+	if err := storage.decrypt("", bso.Payload, &keys); err != nil {
+		return nil, fmt.Errorf("decrypt crypto keys: %w", err)
+	}
+	if storage.defaultKey, err = decodeSyncKeyBundle(keys.Default); err != nil {
+		return nil, fmt.Errorf("decrypt crypto keys: %w", err)
+	}
+	storage.collections = make(map[string]syncKeyBundle, len(keys.Collections))
+	for name, pair := range keys.Collections {
+		if storage.collections[name], err = decodeSyncKeyBundle(pair); err != nil {
+			return nil, fmt.Errorf("decrypt crypto keys: %w", err)
+		}
+	}
+
+	a.storage = storage
+	return storage, nil
+}
+
+// sessionCredentials sign requests to the accounts server on behalf of the session.
+func (a *SyncAccount) sessionCredentials() (hawkCredentials, error) {
+	token, err := hex.DecodeString(a.SessionToken)
+	if err != nil {
+		return hawkCredentials{}, errors.New("malformed session token, sign in again")
+	}
+	derived, err := hkdf.Key(sha256.New, token, nil, piclKey("sessionToken"), 64)
+	if err != nil {
+		return hawkCredentials{}, err
+	}
+	return hawkCredentials{id: hex.EncodeToString(derived[:32]), key: derived[32:]}, nil
+}
+
+// newSyncKeyBundle derives the bundle the collection keys are encrypted with from kB.
+func newSyncKeyBundle(kB []byte) (syncKeyBundle, error) {
+	keys, err := hkdf.Key(sha256.New, kB, nil, piclKey("oldsync"), 64)
+	if err != nil {
+		return syncKeyBundle{}, err
+	}
+	return syncKeyBundle{encKey: keys[:32], hmacKey: keys[32:]}, nil
+}
+
+// decodeSyncKeyBundle decodes the base64 pair of keys of crypto/keys.
+func decodeSyncKeyBundle(pair []string) (syncKeyBundle, error) {
+	if len(pair) != 2 {
+		return syncKeyBundle{}, errors.New("malformed key bundle")
+	}
+	encKey, err := base64.StdEncoding.DecodeString(pair[0])
+	if err != nil {
+		return syncKeyBundle{}, err
+	}
+	hmacKey, err := base64.StdEncoding.DecodeString(pair[1])
+	if err != nil {
+		return syncKeyBundle{}, err
+	}
+	return syncKeyBundle{encKey: encKey, hmacKey: hmacKey}, nil
+}
+
+// decrypt verifies and decrypts the payload of a record of the collection,
+// with the collection's own key, if it has one.
+func (s *syncStorage) decrypt(collection, payload string, v any) error {
+	bundle, ok := s.collections[collection]
+	if !ok {
+		bundle = s.defaultKey
+	}
+
+	var encrypted struct {
+		Ciphertext string `json:"ciphertext"`
+		IV         string `json:"IV"`
+		HMAC       string `json:"hmac"`
+	}
+	if err := json.Unmarshal([]byte(payload), &encrypted); err != nil {
+		return err
+	}
+
+	// the hmac is of the base64 text, not of the bytes
+	mac := hmac.New(sha256.New, bundle.hmacKey)
+	mac.Write([]byte(encrypted.Ciphertext))
+	want, err := hex.DecodeString(encrypted.HMAC)
+	if err != nil || !hmac.Equal(mac.Sum(nil), want) {
+		return errors.New("hmac mismatch")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.Ciphertext)
+	if err != nil {
+		return err
+	}
+	iv, err := base64.StdEncoding.DecodeString(encrypted.IV)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(bundle.encKey)
+	if err != nil {
+		return err
+	}
+	if len(iv) != block.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return errors.New("malformed ciphertext")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	// pkcs#7 padding
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return errors.New("malformed padding")
+	}
+	return json.Unmarshal(plaintext[:len(plaintext)-pad], v)
+}
+
+// get reads a resource of the storage server.
+func (s *syncStorage) get(ctx context.Context, client *http.Client, resource string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+resource, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.creds.sign(req, nil); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: http status %d", resource, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fxaIncorrectEmailCase is the errno of a sign in with the email
+// in another case than it was signed up with.
+const fxaIncorrectEmailCase = 120
+
+// fxaError is an error response of the accounts server.
+type fxaError struct {
+	Code    int    `json:"code"`
+	Errno   int    `json:"errno"`
+	Message string `json:"message"`
+	// Email is the one signed up with, for fxaIncorrectEmailCase
+	Email string `json:"email"`
+}
+
+func (e *fxaError) Error() string {
+	return fmt.Sprintf("%s (errno %d)", e.Message, e.Errno)
+}
+
+// fxaRequest makes a request to the accounts server, signed with the credentials if any.
+func fxaRequest(ctx context.Context, client *http.Client, accountsURL, method, resource string, creds *hawkCredentials, request, response any) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, accountsURL+resource, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if creds != nil {
+		if err := creds.sign(req, body); err != nil {
+			return err
+		}
+	}
+	return doJSON(client, req, response)
+}
+
+// doJSON makes the request and decodes the json response,
+// an error response of the accounts server is returned as *fxaError.
+func doJSON(client *http.Client, req *http.Request, response any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var fxaErr fxaError
+		if json.NewDecoder(resp.Body).Decode(&fxaErr) == nil && len(fxaErr.Message) > 0 {
+			return &fxaErr
+		}
+		return fmt.Errorf("%s: http status %d", req.URL.Path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// hawkCredentials sign requests with the Hawk scheme, which both
+// the accounts server and the storage server use.
+// See https://github.com/mozilla/hawk/blob/main/API.md
+type hawkCredentials struct {
+	id  string
+	key []byte
+}
+
+// sign sets the request's Authorization, the body is hashed if there is one.
+func (c hawkCredentials) sign(req *http.Request, body []byte) error {
+	nonce := make([]byte, 6)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceStr := base64.StdEncoding.EncodeToString(nonce)
+
+	var hash string
+	if body != nil {
+		contentType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+		sum := sha256.Sum256([]byte("hawk.1.payload\n" + strings.ToLower(strings.TrimSpace(contentType)) + "\n" + string(body) + "\n"))
+		hash = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	port := req.URL.Port()
+	if len(port) == 0 {
+		port = "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	normalized := strings.Join([]string{
+		"hawk.1.header",
+		ts,
+		nonceStr,
+		req.Method,
+		req.URL.RequestURI(),
+		strings.ToLower(req.URL.Hostname()),
+		port,
+		hash,
+		"", // ext
+	}, "\n") + "\n"
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(normalized))
+
+	header := fmt.Sprintf(`Hawk id="%s", ts="%s", nonce="%s"`, c.id, ts, nonceStr)
+	if len(hash) > 0 {
+		header += fmt.Sprintf(`, hash="%s"`, hash)
+	}
+	header += fmt.Sprintf(`, mac="%s"`, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// piclKey is the info of keys derived by the onepw protocol.
+func piclKey(name string) string {
+	return "identity.mozilla.com/picl/v1/" + name
+}
@@ -0,0 +1,132 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// the test vectors of the onepw protocol, see SignInSync
+func TestStretchPassword(t *testing.T) {
+	authPW, unwrapBKey, err := stretchPassword("andré@example.org", "pässwörd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(authPW), "247b675ffb4c46310bc87e26d712153abe5e1c90ef00a4784594f97ef54f2375"; got != want {
+		t.Errorf("authPW = %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(unwrapBKey), "de6a2648b78284fcb9ffa81ba95803309cfba7af583c01a8a1a63e567234dd28"; got != want {
+		t.Errorf("unwrapBKey = %s, want %s", got, want)
+	}
+}
+
+// the key fetch of the onepw protocol, with its kA, wrapkB and keyFetchToken
+func TestSyncSignInAccount(t *testing.T) {
+	keyFetchToken := bytesFrom(0x80)
+	unwrapBKey, _ := hex.DecodeString("de6a2648b78284fcb9ffa81ba95803309cfba7af583c01a8a1a63e567234dd28")
+	kA, wrapKB := bytesFrom(0x20), bytesFrom(0x40)
+
+	derived, _ := hkdf.Key(sha256.New, keyFetchToken, nil, piclKey("keyFetchToken"), 96)
+	keys, _ := hkdf.Key(sha256.New, derived[64:], nil, piclKey("account/keys"), 96)
+	bundle := make([]byte, 64, 96)
+	for i := range 32 {
+		bundle[i] = kA[i] ^ keys[32+i]
+		bundle[32+i] = wrapKB[i] ^ keys[64+i]
+	}
+	mac := hmac.New(sha256.New, keys[:32])
+	mac.Write(bundle)
+	bundle = mac.Sum(bundle)
+
+	for _, tc := range []struct {
+		name    string
+		bundle  []byte
+		wantErr bool
+	}{
+		{name: "valid", bundle: bundle},
+		{name: "tampered", bundle: append([]byte{bundle[0] ^ 1}, bundle[1:]...), wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/account/keys" || !strings.HasPrefix(r.Header.Get("Authorization"), "Hawk ") {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				fmt.Fprintf(w, `{"bundle": %q}`, hex.EncodeToString(tc.bundle))
+			}))
+			defer srv.Close()
+
+			s := &SyncSignIn{
+				client:        srv.Client(),
+				account:       SyncAccount{AccountsURL: srv.URL},
+				keyFetchToken: keyFetchToken,
+				unwrapBKey:    unwrapBKey,
+			}
+			account, err := s.Account(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "9e2b640bf3c7c2bbf1b6e250e5154d7fccaaf5fc0c6957fff9ff640d2e698377"; account.KB != want {
+				t.Errorf("kB = %s, want %s", account.KB, want)
+			}
+		})
+	}
+}
+
+func TestSyncStorageDecrypt(t *testing.T) {
+	bundle := syncKeyBundle{encKey: bytesFrom(0x00), hmacKey: bytesFrom(0x10)}
+	iv := bytesFrom(0x30)[:aes.BlockSize]
+
+	plaintext := []byte(`{"id":"menu","title":"archive"}`)
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, _ := aes.NewCipher(bundle.encKey)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+	mac := hmac.New(sha256.New, bundle.hmacKey)
+	mac.Write([]byte(encoded))
+	payload := func(hmacHex string) string {
+		return fmt.Sprintf(`{"ciphertext": %q, "IV": %q, "hmac": %q}`, encoded, base64.StdEncoding.EncodeToString(iv), hmacHex)
+	}
+
+	s := &syncStorage{defaultKey: bundle}
+	var record struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	if err := s.decrypt("bookmarks", payload(hex.EncodeToString(mac.Sum(nil))), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID != "menu" || record.Title != "archive" {
+		t.Errorf("decrypted %+v", record)
+	}
+	if err := s.decrypt("bookmarks", payload(strings.Repeat("00", sha256.Size)), &record); err == nil {
+		t.Error("want an hmac mismatch, got none")
+	}
+}
+
+// bytesFrom is 32 bytes counting from the first one, as the onepw vectors have them.
+func bytesFrom(first byte) []byte {
+	bs := make([]byte, 32)
+	for i := range bs {
+		bs[i] = first + byte(i)
+	}
+	return bs
+}
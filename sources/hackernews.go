@@ -0,0 +1,176 @@
+package sources
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HackerNewsURL is the site, the official api has no favorites and upvotes.
+const HackerNewsURL = "https://news.ycombinator.com"
+
+const (
+	// a thousand of favorites is plenty
+	maxHNPages = 35
+	// hn asks crawlers to wait 30 seconds, we read a few pages only
+	hnPageDelay = time.Second
+)
+
+var (
+	hnStoryRe    = regexp.MustCompile(`<tr class=["']athing[^"']*["'] id=["'](\d+)["']`)
+	hnTitleRe    = regexp.MustCompile(`(?s)<span class=["']titleline["']>\s*<a href=["']([^"']+)["'][^>]*>(.*?)</a>`)
+	hnAgeRe      = regexp.MustCompile(`<span class=["']age["'] title=["']([0-9T:-]+)`)
+	hnMoreLinkRe = regexp.MustCompile(`<a href=["']([^"']+)["'] class=["']morelink["']`)
+	hnTagRe      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// HackerNews reads the stories a user has favorited or upvoted, from the site's pages.
+type HackerNews struct {
+	Client *http.Client
+	// Site is HackerNewsURL if empty
+	Site string
+	User string
+	// Password is only needed for the upvoted stories, they are private
+	Password string
+}
+
+// HNStory is a story of a list, URL is the linked article, or the
+// discussion itself for Ask HN and the like.
+type HNStory struct {
+	Title string
+	URL   string
+	// Discussion is the story's page on hn
+	Discussion string
+	Posted     time.Time
+}
+
+func (hn HackerNews) site() string {
+	return strings.TrimSuffix(cmp.Or(hn.Site, HackerNewsURL), "/")
+}
+
+// Favorites reads the user's favorite stories, they are public.
+func (hn HackerNews) Favorites(ctx context.Context) ([]HNStory, error) {
+	return hn.stories(ctx, "/favorites?id="+url.QueryEscape(hn.User), "")
+}
+
+// Upvoted signs in and reads the stories the user has upvoted.
+func (hn HackerNews) Upvoted(ctx context.Context) ([]HNStory, error) {
+	cookie, err := hn.signIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return hn.stories(ctx, "/upvoted?id="+url.QueryEscape(hn.User), cookie)
+}
+
+// signIn returns the session cookie of the user.
+func (hn HackerNews) signIn(ctx context.Context) (string, error) {
+	if len(hn.Password) == 0 {
+		return "", errors.New("upvoted stories need the password")
+	}
+	form := url.Values{"acct": {hn.User}, "pw": {hn.Password}, "goto": {"news"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hn.site()+"/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// the cookie comes with the redirect, don't follow it
+	client := *hn.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sign in: %w", err)
+	}
+	resp.Body.Close()
+	for _, c := range resp.Cookies() {
+		if c.Name == "user" && len(c.Value) > 0 {
+			return c.Name + "=" + c.Value, nil
+		}
+	}
+	return "", errors.New("sign in: bad login")
+}
+
+// stories reads every page of the list, following the "More" links.
+func (hn HackerNews) stories(ctx context.Context, page, cookie string) ([]HNStory, error) {
+	var list []HNStory
+	for i := 0; len(page) > 0 && i < maxHNPages; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(hnPageDelay):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hn.site()+"/"+strings.TrimPrefix(page, "/"), nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(cookie) > 0 {
+			req.Header.Set("Cookie", cookie)
+		}
+		resp, err := hn.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: http status %d", page, resp.StatusCode)
+		}
+
+		stories, next := parseHNPage(hn.site(), string(body))
+		list = append(list, stories...)
+		page = next
+	}
+	return list, nil
+}
+
+// parseHNPage parses stories of a list page, and the link to the next page if there is one.
+func parseHNPage(site, page string) ([]HNStory, string) {
+	var list []HNStory
+	rows := hnStoryRe.FindAllStringSubmatchIndex(page, -1)
+	for i, row := range rows {
+		// the story is its row and the subtext row after it
+		end := len(page)
+		if i+1 < len(rows) {
+			end = rows[i+1][0]
+		}
+		story := page[row[0]:end]
+
+		m := hnTitleRe.FindStringSubmatch(story)
+		if m == nil {
+			continue
+		}
+		s := HNStory{
+			Title:      html.UnescapeString(hnTagRe.ReplaceAllString(m[2], "")),
+			URL:        html.UnescapeString(m[1]),
+			Discussion: site + "/item?id=" + page[row[2]:row[3]],
+		}
+		if !strings.Contains(s.URL, "://") {
+			// item?id=..., a story without a link
+			s.URL = site + "/" + s.URL
+		}
+		if age := hnAgeRe.FindStringSubmatch(story); age != nil {
+			s.Posted, _ = time.Parse("2006-01-02T15:04:05", age[1])
+		}
+		list = append(list, s)
+	}
+
+	next := ""
+	if m := hnMoreLinkRe.FindStringSubmatch(page); m != nil {
+		next = html.UnescapeString(m[1])
+	}
+	return list, next
+}
@@ -0,0 +1,219 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a folder of newsletters doesn't need more at once, the rest come on the next run
+const maxIMAPMessages = 200
+
+// IMAP reads new messages of a mail folder, it speaks just enough of IMAP4rev1 for that.
+type IMAP struct {
+	// Addr is host:port of the server
+	Addr string
+	// TLS is for imaps, otherwise the connection is upgraded with STARTTLS,
+	// only servers on the loopback may do without it, like a mail bridge
+	TLS      bool
+	User     string
+	Password string
+	Folder   string
+}
+
+// IMAPMessage is a message as it is, with its headers.
+type IMAPMessage struct {
+	UID uint32
+	Raw []byte
+}
+
+// Messages reads the messages with uids above the last one, which is of the uidValidity:
+// when the folder was recreated, the validity changes and all of its messages are new.
+// It returns the validity of the folder, the messages are left unread.
+func (m IMAP) Messages(ctx context.Context, uidValidity, last uint32) ([]IMAPMessage, uint32, error) {
+	dialer := &net.Dialer{Timeout: time.Minute}
+	host, _, _ := net.SplitHostPort(m.Addr)
+	var conn net.Conn
+	var err error
+	if m.TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", m.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.Addr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(10 * time.Minute))
+
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	if greeting, err := c.line(); err != nil {
+		return nil, 0, err
+	} else if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return nil, 0, fmt.Errorf("server says %q", greeting)
+	}
+	if !m.TLS && !isLoopback(host) {
+		// LOGIN would send the password as it is
+		if _, err := c.command("STARTTLS"); err != nil {
+			return nil, 0, fmt.Errorf("starttls, use imaps:// if the server has no STARTTLS: %w", err)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, 0, fmt.Errorf("starttls: %w", err)
+		}
+		// the replies before the handshake are discarded, as RFC 3501 says
+		conn = tlsConn
+		c = &imapConn{conn: conn, r: bufio.NewReader(conn), tag: c.tag}
+	}
+
+	if _, err := c.command("LOGIN " + imapQuote(m.User) + " " + imapQuote(m.Password)); err != nil {
+		return nil, 0, fmt.Errorf("login: %w", err)
+	}
+	defer c.command("LOGOUT")
+
+	// EXAMINE is SELECT for reading only
+	replies, err := c.command("EXAMINE " + imapQuote(m.Folder))
+	if err != nil {
+		return nil, 0, fmt.Errorf("open %s: %w", m.Folder, err)
+	}
+	validity := uint32(0)
+	for _, r := range replies {
+		if _, rest, ok := strings.Cut(r.text, "[UIDVALIDITY "); ok {
+			number, _, _ := strings.Cut(rest, "]")
+			v, _ := strconv.ParseUint(number, 10, 32)
+			validity = uint32(v)
+		}
+	}
+	if validity != uidValidity {
+		last = 0
+	}
+
+	replies, err = c.command(fmt.Sprintf("UID SEARCH UID %d:*", last+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("search: %w", err)
+	}
+	var uids []uint32
+	for _, r := range replies {
+		fields, ok := strings.CutPrefix(r.text, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(fields) {
+			// n:* is the last message if there are none after n, skip it
+			if uid, err := strconv.ParseUint(f, 10, 32); err == nil && uint32(uid) > last {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	if len(uids) > maxIMAPMessages {
+		uids = uids[:maxIMAPMessages]
+	}
+
+	var list []IMAPMessage
+	for _, uid := range uids {
+		replies, err := c.command(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+		if err != nil {
+			return nil, 0, fmt.Errorf("fetch %d: %w", uid, err)
+		}
+		for _, r := range replies {
+			if strings.Contains(r.text, "FETCH") && len(r.literals) > 0 {
+				list = append(list, IMAPMessage{UID: uid, Raw: r.literals[0]})
+				break
+			}
+		}
+	}
+	return list, validity, nil
+}
+
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapReply is an untagged reply, literals are cut out of its text.
+type imapReply struct {
+	text     string
+	literals [][]byte
+}
+
+// command sends the command and reads the replies until the tagged one.
+func (c *imapConn) command(cmd string) ([]imapReply, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	if _, err := io.WriteString(c.conn, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var replies []imapReply
+	for {
+		r, err := c.reply()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(r.text, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, errors.New(status)
+			}
+			return replies, nil
+		}
+		replies = append(replies, r)
+	}
+}
+
+// reply reads a line, and the literals in it, {size} followed by the bytes.
+func (c *imapConn) reply() (imapReply, error) {
+	var r imapReply
+	for {
+		line, err := c.line()
+		if err != nil {
+			return r, err
+		}
+		r.text += line
+		open := strings.LastIndexByte(line, '{')
+		if open < 0 || !strings.HasSuffix(line, "}") {
+			return r, nil
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(line[open+1:], "}"))
+		if err != nil {
+			return r, nil
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return r, err
+		}
+		r.literals = append(r.literals, literal)
+	}
+}
+
+func (c *imapConn) line() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isLoopback tells if the host is localhost or a loopback address, connections
+// to it don't leave the machine.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// imapQuote makes a quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,120 @@
+package sources
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Karakeep is a Karakeep (formerly Hoarder) instance, see https://docs.karakeep.app/api/
+type Karakeep struct {
+	Client *http.Client
+	// URL is the instance's base url, e.g. https://keep.example.com
+	URL string
+	// Token is the api key from Karakeep's settings
+	Token string
+}
+
+// karakeepBookmark is a bookmark of Karakeep's api, the content is of the links only.
+type karakeepBookmark struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	Title      string    `json:"title"`
+	Note       string    `json:"note"`
+	Tags       []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Content struct {
+		Type  string `json:"type"`
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	} `json:"content"`
+}
+
+// ListBookmarks reads the links of the named list, lists are Karakeep's folders.
+// Karakeep lists the recent bookmarks first.
+func (k Karakeep) ListBookmarks(ctx context.Context, list string) ([]Bookmark, error) {
+	var lists struct {
+		Lists []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"lists"`
+	}
+	if err := k.get(ctx, "/api/v1/lists", nil, &lists); err != nil {
+		return nil, err
+	}
+	listID := ""
+	for _, l := range lists.Lists {
+		if l.Name == list {
+			listID = l.ID
+			break
+		}
+	}
+	if len(listID) == 0 {
+		return nil, fmt.Errorf("no list %q in karakeep", list)
+	}
+
+	var bookmarks []Bookmark
+	query := url.Values{"limit": {"100"}}
+	for {
+		var page struct {
+			Bookmarks  []karakeepBookmark `json:"bookmarks"`
+			NextCursor string             `json:"nextCursor"`
+		}
+		if err := k.get(ctx, "/api/v1/lists/"+url.PathEscape(listID)+"/bookmarks", query, &page); err != nil {
+			return nil, err
+		}
+		for _, kb := range page.Bookmarks {
+			if kb.Content.Type != "link" {
+				// notes and images have nothing to archive
+				continue
+			}
+			b := Bookmark{
+				ID:           kb.ID,
+				Title:        cmp.Or(kb.Title, kb.Content.Title),
+				URL:          kb.Content.URL,
+				Hash:         URLHash(kb.Content.URL),
+				DateAdded:    kb.CreatedAt,
+				LastModified: kb.ModifiedAt,
+				Position:     len(bookmarks),
+				Description:  kb.Note,
+			}
+			for _, tag := range kb.Tags {
+				b.Tags = append(b.Tags, tag.Name)
+			}
+			bookmarks = append(bookmarks, b)
+		}
+		if len(page.NextCursor) == 0 {
+			return bookmarks, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+func (k Karakeep) get(ctx context.Context, resource string, query url.Values, response any) error {
+	endpoint := strings.TrimSuffix(k.URL, "/") + resource
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.Token)
+
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("karakeep: %s: http status %d", resource, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
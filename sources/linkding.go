@@ -0,0 +1,130 @@
+package sources
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Linkding is a linkding instance, see https://linkding.link/api/
+type Linkding struct {
+	Client *http.Client
+	// URL is the instance's base url, e.g. https://links.example.com
+	URL string
+	// Token is the api token from linkding's settings
+	Token string
+}
+
+// linkdingBookmark is a bookmark of linkding's api.
+type linkdingBookmark struct {
+	ID           int       `json:"id"`
+	URL          string    `json:"url"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Notes        string    `json:"notes"`
+	WebsiteTitle string    `json:"website_title"`
+	Tags         []string  `json:"tag_names"`
+	DateAdded    time.Time `json:"date_added"`
+	DateModified time.Time `json:"date_modified"`
+}
+
+// Bookmarks reads the bookmarks having the tag, the archived ones are not included.
+// Linkding lists the recent bookmarks first.
+func (l Linkding) Bookmarks(ctx context.Context, tag string) ([]Bookmark, error) {
+	query := url.Values{"limit": {"100"}}
+	if len(tag) > 0 {
+		query.Set("q", "#"+tag)
+	}
+	next := strings.TrimSuffix(l.URL, "/") + "/api/bookmarks/?" + query.Encode()
+
+	var list []Bookmark
+	for len(next) > 0 {
+		var page struct {
+			Next    string             `json:"next"`
+			Results []linkdingBookmark `json:"results"`
+		}
+		if err := l.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, lb := range page.Results {
+			b := Bookmark{
+				ID:           strconv.Itoa(lb.ID),
+				Title:        cmp.Or(lb.Title, lb.WebsiteTitle),
+				URL:          lb.URL,
+				Hash:         URLHash(lb.URL),
+				DateAdded:    lb.DateAdded,
+				LastModified: lb.DateModified,
+				Tags:         lb.Tags,
+				Position:     len(list),
+				Description:  lb.Description,
+			}
+			list = append(list, b)
+		}
+		next = page.Next
+	}
+	return list, nil
+}
+
+// archiveLinkPrefix starts the line of the notes with the link to the archived copy.
+const archiveLinkPrefix = "Archived: "
+
+// SetArchiveLink puts the link to the archived copy of the bookmark into its notes,
+// instead of the previous one if there is.
+func (l Linkding) SetArchiveLink(ctx context.Context, id, link string) error {
+	endpoint := strings.TrimSuffix(l.URL, "/") + "/api/bookmarks/" + url.PathEscape(id) + "/"
+	var lb linkdingBookmark
+	if err := l.do(ctx, http.MethodGet, endpoint, nil, &lb); err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(lb.Notes, "\n") {
+		if !strings.HasPrefix(line, archiveLinkPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	notes := strings.TrimSpace(strings.Join(lines, "\n"))
+	if len(notes) > 0 {
+		notes += "\n\n"
+	}
+	notes += archiveLinkPrefix + link
+	if notes == lb.Notes {
+		return nil
+	}
+	return l.do(ctx, http.MethodPatch, endpoint, map[string]string{"notes": notes}, &lb)
+}
+
+func (l Linkding) do(ctx context.Context, method, endpoint string, request, response any) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+l.Token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("linkding: %s %s: http status %d", method, req.URL.Path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,157 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// a thousand of bookmarks is plenty, the api gives 40 a page
+const maxMastodonPages = 25
+
+var (
+	mastodonLinkRe = regexp.MustCompile(`<a ([^>]*)>`)
+	mastodonHrefRe = regexp.MustCompile(`href="([^"]+)"`)
+	mastodonNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+	mastodonTagRe  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Mastodon reads statuses the account of the token has bookmarked or favourited.
+// The token is of an app made in the account's preferences, under Development,
+// with the read:bookmarks and read:favourites scopes.
+type Mastodon struct {
+	Client *http.Client
+	// URL is of the server, like https://mastodon.social
+	URL   string
+	Token string
+}
+
+// MastodonStatus is a bookmarked or favourited status, of a boost it's the boosted one.
+type MastodonStatus struct {
+	// URL is the status page on its own server
+	URL     string
+	Author  string
+	Text    string
+	Created time.Time
+	// Links are of the text and the preview card, without mentions and hashtags
+	Links []string
+	Tags  []string
+}
+
+// Bookmarks reads the statuses bookmarked by the account.
+func (m Mastodon) Bookmarks(ctx context.Context) ([]MastodonStatus, error) {
+	return m.statuses(ctx, "/api/v1/bookmarks")
+}
+
+// Favourites reads the statuses favourited by the account.
+func (m Mastodon) Favourites(ctx context.Context) ([]MastodonStatus, error) {
+	return m.statuses(ctx, "/api/v1/favourites")
+}
+
+type mastodonStatus struct {
+	URL       string    `json:"url"`
+	URI       string    `json:"uri"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Account   struct {
+		Acct        string `json:"acct"`
+		DisplayName string `json:"display_name"`
+	} `json:"account"`
+	Card *struct {
+		URL string `json:"url"`
+	} `json:"card"`
+	Tags []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Reblog *mastodonStatus `json:"reblog"`
+}
+
+// statuses reads every page of the list, following the next links of the Link header.
+func (m Mastodon) statuses(ctx context.Context, path string) ([]MastodonStatus, error) {
+	if len(m.Token) == 0 {
+		return nil, errors.New("no api token")
+	}
+
+	var list []MastodonStatus
+	page := strings.TrimSuffix(m.URL, "/") + path + "?limit=40"
+	for i := 0; len(page) > 0 && i < maxMastodonPages; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, page, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+m.Token)
+
+		resp, err := m.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var statuses []mastodonStatus
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&statuses)
+		} else {
+			err = fmt.Errorf("http status %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, s := range statuses {
+			if s.Reblog != nil {
+				s = *s.Reblog
+			}
+			list = append(list, s.status())
+		}
+
+		page = ""
+		if next := mastodonNextRe.FindStringSubmatch(resp.Header.Get("Link")); next != nil && len(statuses) > 0 {
+			page = next[1]
+		}
+	}
+	return list, nil
+}
+
+func (s mastodonStatus) status() MastodonStatus {
+	status := MastodonStatus{
+		URL:     s.URL,
+		Author:  s.Account.DisplayName,
+		Text:    html.UnescapeString(mastodonTagRe.ReplaceAllString(strings.ReplaceAll(s.Content, "</p><p>", " "), "")),
+		Created: s.CreatedAt,
+	}
+	if len(status.URL) == 0 {
+		status.URL = s.URI
+	}
+	if len(status.Author) == 0 {
+		status.Author = s.Account.Acct
+	}
+	for _, t := range s.Tags {
+		status.Tags = append(status.Tags, t.Name)
+	}
+
+	seen := make(map[string]bool)
+	add := func(link string) {
+		if (strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")) && !seen[link] {
+			seen[link] = true
+			status.Links = append(status.Links, link)
+		}
+	}
+	for _, a := range mastodonLinkRe.FindAllStringSubmatch(s.Content, -1) {
+		// mentions and hashtags are links to profiles and tag pages
+		if strings.Contains(a[1], "mention") || strings.Contains(a[1], "hashtag") {
+			continue
+		}
+		if href := mastodonHrefRe.FindStringSubmatch(a[1]); href != nil {
+			add(html.UnescapeString(href[1]))
+		}
+	}
+	if s.Card != nil {
+		add(s.Card.URL)
+	}
+	return status
+}
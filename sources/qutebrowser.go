@@ -0,0 +1,107 @@
+package sources
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// QutebrowserDir is qutebrowser's config directory, where it keeps
+// the bookmarks/urls and quickmarks files.
+func QutebrowserDir() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		homedir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("get user home dir: %w", err)
+		}
+		return filepath.Join(homedir, ".qutebrowser"), nil
+	case "windows":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("get user config dir: %w", err)
+		}
+		return filepath.Join(dir, "qutebrowser", "config"), nil
+	default:
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("get user config dir: %w", err)
+		}
+		return filepath.Join(dir, "qutebrowser"), nil
+	}
+}
+
+// QutebrowserFiles are the files qutebrowser keeps bookmarks in: the bookmarks
+// are "url title" lines, the quickmarks are "name url" ones.
+func QutebrowserFiles(dir string) (bookmarks, quickmarks string) {
+	return filepath.Join(dir, "bookmarks", "urls"), filepath.Join(dir, "quickmarks")
+}
+
+// QutebrowserBookmarks reads both bookmarks and quickmarks, in the order of the files,
+// the quickmarks are named by their names. There are no folders, dates and tags.
+func QutebrowserBookmarks(dir string) ([]Bookmark, error) {
+	bookmarksFile, quickmarksFile := QutebrowserFiles(dir)
+
+	var list []Bookmark
+	seen := make(map[string]bool)
+	found := false
+	read := func(name string, parse func(line string) (url, title string)) error {
+		f, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		found = true
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			url, title := parse(line)
+			if len(url) == 0 || seen[url] {
+				continue
+			}
+			seen[url] = true
+			list = append(list, Bookmark{
+				Title:    title,
+				URL:      url,
+				Hash:     URLHash(url),
+				Position: len(list),
+			})
+		}
+		return scanner.Err()
+	}
+
+	err := read(bookmarksFile, func(line string) (string, string) {
+		url, title, _ := strings.Cut(line, " ")
+		return url, strings.TrimSpace(title)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	}
+	// the name may have spaces, the url can't
+	err = read(quickmarksFile, func(line string) (string, string) {
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return line, ""
+		}
+		return line[i+1:], strings.TrimSpace(line[:i])
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read quickmarks: %w", err)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no bookmarks and quickmarks files in %s", dir)
+	}
+	return list, nil
+}
@@ -0,0 +1,42 @@
+package sources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQutebrowserBookmarks(t *testing.T) {
+	dir := t.TempDir()
+	bookmarks, quickmarks := QutebrowserFiles(dir)
+	if err := os.MkdirAll(filepath.Dir(bookmarks), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, bookmarks, "https://go.dev/ The Go Programming Language\n\n# a comment\nhttps://example.com/\n")
+	writeFile(t, quickmarks, "go docs https://pkg.go.dev/\ngo https://go.dev/\n")
+
+	list, err := QutebrowserBookmarks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Bookmark{
+		{Title: "The Go Programming Language", URL: "https://go.dev/", Hash: URLHash("https://go.dev/"), Position: 0},
+		{URL: "https://example.com/", Hash: URLHash("https://example.com/"), Position: 1},
+		{Title: "go docs", URL: "https://pkg.go.dev/", Hash: URLHash("https://pkg.go.dev/"), Position: 2},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("got  %+v\nwant %+v", list, want)
+	}
+
+	if _, err := QutebrowserBookmarks(t.TempDir()); err == nil {
+		t.Error("want an error without any files, got none")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	redditTokenURL = "https://www.reddit.com/api/v1/access_token"
+	redditAPIURL   = "https://oauth.reddit.com"
+	// old reddit renders the comments without scripts, so wget gets them
+	redditThreadURL = "https://old.reddit.com"
+)
+
+// Reddit reads the user's saved posts and comments, as a "script" app of the user.
+// See https://github.com/reddit-archive/reddit/wiki/OAuth2-Quick-Start-Example
+type Reddit struct {
+	Client *http.Client
+	// ClientID and ClientSecret are of the app made at https://www.reddit.com/prefs/apps
+	ClientID     string
+	ClientSecret string
+	User         string
+	Password     string
+}
+
+// RedditSaved is a saved post or comment. URL is the external link of the post,
+// empty for self posts and comments.
+type RedditSaved struct {
+	Title     string
+	Thread    string
+	URL       string
+	Subreddit string
+	Created   time.Time
+}
+
+// Saved reads everything the user has saved, reddit gives the last thousand at most.
+func (r Reddit) Saved(ctx context.Context) ([]RedditSaved, error) {
+	token, err := r.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []RedditSaved
+	query := url.Values{"limit": {"100"}, "raw_json": {"1"}}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			redditAPIURL+"/user/"+url.PathEscape(r.User)+"/saved?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("User-Agent", r.userAgent())
+
+		var listing struct {
+			Data struct {
+				After    string `json:"after"`
+				Children []struct {
+					Kind string `json:"kind"`
+					Data struct {
+						Title     string  `json:"title"`
+						LinkTitle string  `json:"link_title"`
+						Permalink string  `json:"permalink"`
+						URL       string  `json:"url"`
+						IsSelf    bool    `json:"is_self"`
+						Subreddit string  `json:"subreddit"`
+						Created   float64 `json:"created_utc"`
+					} `json:"data"`
+				} `json:"children"`
+			} `json:"data"`
+		}
+		if err := r.do(req, &listing); err != nil {
+			return nil, fmt.Errorf("get saved: %w", err)
+		}
+
+		for _, child := range listing.Data.Children {
+			d := child.Data
+			saved := RedditSaved{
+				Title:     d.Title,
+				Thread:    redditThreadURL + d.Permalink,
+				Subreddit: d.Subreddit,
+				Created:   time.Unix(int64(d.Created), 0),
+			}
+			switch child.Kind {
+			case "t3":
+				if !d.IsSelf && !strings.Contains(d.URL, d.Permalink) {
+					saved.URL = d.URL
+				}
+			case "t1":
+				// a comment, its permalink is the thread focused on it
+				saved.Title = "Comment on " + d.LinkTitle
+			default:
+				continue
+			}
+			list = append(list, saved)
+		}
+
+		if len(listing.Data.After) == 0 {
+			return list, nil
+		}
+		query.Set("after", listing.Data.After)
+	}
+}
+
+// token signs in with the password grant, which is for the app's own user.
+func (r Reddit) token(ctx context.Context) (string, error) {
+	form := url.Values{"grant_type": {"password"}, "username": {r.User}, "password": {r.Password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, redditTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(r.ClientID, r.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", r.userAgent())
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := r.do(req, &resp); err != nil {
+		return "", fmt.Errorf("sign in: %w", err)
+	}
+	if len(resp.Error) > 0 {
+		return "", fmt.Errorf("sign in: %s", resp.Error)
+	}
+	if len(resp.AccessToken) == 0 {
+		return "", errors.New("sign in: no access token")
+	}
+	return resp.AccessToken, nil
+}
+
+// userAgent is as reddit asks for it, generic ones are throttled.
+func (r Reddit) userAgent() string {
+	return "ueb-archive:saved-posts:v1 (by /u/" + r.User + ")"
+}
+
+func (r Reddit) do(req *http.Request, response any) error {
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: http status %d", req.URL.Path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,170 @@
+package sources
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// TelegramAPIURL is of the Bot API, reading Saved Messages needs MTProto, a whole client.
+const TelegramAPIURL = "https://api.telegram.org"
+
+// Telegram reads messages sent to the bot, with the token @BotFather has given for it.
+type Telegram struct {
+	Client *http.Client
+	Token  string
+	// API is TelegramAPIURL if empty
+	API string
+}
+
+// TelegramMessage is a message with links, sent or forwarded to the bot.
+type TelegramMessage struct {
+	ChatID    int64
+	MessageID int64
+	// FromID is the sender's id, it stays the same, unlike the username,
+	// which may be changed, or taken by someone else then
+	FromID       int64
+	FromUsername string
+	Date         time.Time
+	Text         string
+	Links        []string
+}
+
+type telegramEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url"`
+}
+
+// Updates reads messages the bot has got since the offset, the update id after the last
+// one read. Passing it on the next call tells telegram to forget the ones before,
+// it keeps them a day at most anyway.
+func (t Telegram) Updates(ctx context.Context, offset int64) ([]TelegramMessage, int64, error) {
+	var updates []struct {
+		UpdateID int64 `json:"update_id"`
+		Message  *struct {
+			MessageID int64 `json:"message_id"`
+			Date      int64 `json:"date"`
+			Chat      struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			From struct {
+				ID       int64  `json:"id"`
+				Username string `json:"username"`
+			} `json:"from"`
+			Text            string           `json:"text"`
+			Entities        []telegramEntity `json:"entities"`
+			Caption         string           `json:"caption"`
+			CaptionEntities []telegramEntity `json:"caption_entities"`
+		} `json:"message"`
+	}
+	query := url.Values{"offset": {strconv.FormatInt(offset, 10)}, "allowed_updates": {`["message"]`}}
+	if err := t.call(ctx, "getUpdates", query, &updates); err != nil {
+		return nil, offset, err
+	}
+
+	var list []TelegramMessage
+	for _, u := range updates {
+		offset = max(offset, u.UpdateID+1)
+		m := u.Message
+		if m == nil {
+			continue
+		}
+		msg := TelegramMessage{
+			ChatID:       m.Chat.ID,
+			MessageID:    m.MessageID,
+			FromID:       m.From.ID,
+			FromUsername: m.From.Username,
+			Date:         time.Unix(m.Date, 0),
+			Text:         m.Text,
+			Links:        telegramLinks(m.Text, m.Entities),
+		}
+		if len(msg.Text) == 0 {
+			// forwarded photos and videos have their text as the caption
+			msg.Text = m.Caption
+			msg.Links = telegramLinks(m.Caption, m.CaptionEntities)
+		}
+		if len(msg.Links) > 0 {
+			list = append(list, msg)
+		}
+	}
+	return list, offset, nil
+}
+
+// telegramLinks are the links of the text, both the plain urls and the ones behind words.
+func telegramLinks(text string, entities []telegramEntity) []string {
+	// offsets are in utf-16 code units
+	units := utf16.Encode([]rune(text))
+	var links []string
+	for _, e := range entities {
+		link := e.URL
+		if e.Type == "url" && e.Offset >= 0 && e.Offset+e.Length <= len(units) {
+			link = string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+		}
+		if len(link) == 0 {
+			continue
+		}
+		if !strings.Contains(link, "://") {
+			// telegram finds urls without the scheme, like example.com/page
+			link = "https://" + link
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// Reply answers the message, so the sender knows it's taken.
+func (t Telegram) Reply(ctx context.Context, msg TelegramMessage, text string) error {
+	query := url.Values{
+		"chat_id":          {strconv.FormatInt(msg.ChatID, 10)},
+		"reply_parameters": {fmt.Sprintf(`{"message_id":%d}`, msg.MessageID)},
+		"text":             {text},
+	}
+	return t.call(ctx, "sendMessage", query, nil)
+}
+
+func (t Telegram) call(ctx context.Context, method string, query url.Values, result any) error {
+	api := strings.TrimSuffix(cmp.Or(t.API, TelegramAPIURL), "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api+"/bot"+t.Token+"/"+method,
+		strings.NewReader(query.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		// the error has the url, with the token in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %w", method, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: http status %d: %w", method, resp.StatusCode, err)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
@@ -0,0 +1,93 @@
+package sources
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	textBrowserLinkRe = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+	textBrowserTagRe  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// TextBrowsers are the text-mode browsers whose bookmark files we read.
+var TextBrowsers = []string{"lynx", "w3m", "elinks"}
+
+// TextBrowserFile is the browser's bookmark file: lynx keeps an html page in the
+// home directory, w3m one in ~/.w3m, elinks a tab-separated file in ~/.elinks.
+func TextBrowserFile(browser string) (string, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get user home dir: %w", err)
+	}
+	switch browser {
+	case "lynx":
+		return filepath.Join(homedir, "lynx_bookmarks.html"), nil
+	case "w3m":
+		dir := os.Getenv("W3M_DIR")
+		if len(dir) == 0 {
+			dir = filepath.Join(homedir, ".w3m")
+		}
+		return filepath.Join(dir, "bookmark.html"), nil
+	case "elinks":
+		dir := os.Getenv("ELINKS_CONFDIR")
+		if len(dir) == 0 {
+			dir = filepath.Join(homedir, ".elinks")
+		}
+		return filepath.Join(dir, "bookmarks"), nil
+	default:
+		return "", fmt.Errorf("%s is not a text browser", browser)
+	}
+}
+
+// TextBrowserBookmarks reads all bookmarks of the browser's file, in its order,
+// w3m's sections and elinks' folders are left out, as qutebrowser has none.
+func TextBrowserBookmarks(browser, fileName string) ([]Bookmark, error) {
+	bs, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Bookmark
+	seen := make(map[string]bool)
+	add := func(url, title string) {
+		url = strings.TrimSpace(url)
+		if len(url) == 0 || seen[url] {
+			return
+		}
+		seen[url] = true
+		list = append(list, Bookmark{
+			Title:    strings.TrimSpace(title),
+			URL:      url,
+			Hash:     URLHash(url),
+			Position: len(list),
+		})
+	}
+
+	if browser != "elinks" {
+		for _, m := range textBrowserLinkRe.FindAllStringSubmatch(string(bs), -1) {
+			title := textBrowserTagRe.ReplaceAllString(m[2], "")
+			add(html.UnescapeString(m[1]), html.UnescapeString(strings.Join(strings.Fields(title), " ")))
+		}
+		return list, nil
+	}
+
+	// "title\turl\tdepth\tflags" lines, folders have no url
+	scanner := bufio.NewScanner(strings.NewReader(string(bs)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		if len(fields) > 3 && strings.Contains(fields[3], "F") {
+			continue
+		}
+		add(fields[1], fields[0])
+	}
+	return list, scanner.Err()
+}
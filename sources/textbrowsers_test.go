@@ -0,0 +1,65 @@
+package sources
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTextBrowserBookmarks(t *testing.T) {
+	tests := []struct {
+		browser string
+		content string
+	}{
+		{
+			browser: "lynx",
+			content: `<head><title>Bookmark file</title></head>
+<p>You can delete links by the 'R' command</p>
+<ol>
+<LI><a href="https://go.dev/?a=1&amp;b=2">The Go
+ Programming Language</a>
+<LI><a href="https://example.com/">Example &amp; <b>Co</b></a>
+</ol>`,
+		},
+		{
+			browser: "w3m",
+			content: `<html><head><title>Bookmarks</title></head>
+<body>
+<h1>Bookmarks</h1>
+<h2>Default</h2>
+<ul>
+<li><a href="https://go.dev/?a=1&amp;b=2">The Go Programming Language</a>
+<li><a href="https://example.com/">Example &amp; Co</a>
+<li><a href="https://go.dev/?a=1&amp;b=2">once more</a>
+<!--End of section (do not delete this comment)-->
+</ul>
+</body></html>`,
+		},
+		{
+			browser: "elinks",
+			content: "Go\t\t0\tF\n" +
+				"The Go Programming Language\thttps://go.dev/?a=1&b=2\t1\t\n" +
+				"Example & Co\thttps://example.com/\t1\t\n" +
+				"-\t\t1\t\n",
+		},
+	}
+
+	want := []Bookmark{
+		{Title: "The Go Programming Language", URL: "https://go.dev/?a=1&b=2", Hash: URLHash("https://go.dev/?a=1&b=2"), Position: 0},
+		{Title: "Example & Co", URL: "https://example.com/", Hash: URLHash("https://example.com/"), Position: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.browser, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "bookmarks")
+			writeFile(t, name, tc.content)
+
+			list, err := TextBrowserBookmarks(tc.browser, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(list, want) {
+				t.Errorf("got  %+v\nwant %+v", list, want)
+			}
+		})
+	}
+}
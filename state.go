@@ -0,0 +1,70 @@
+package uebarchive
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+// the state database lives in the archive root and keeps
+// whatever we want to remember between runs.
+const stateSchema = `
+create table if not exists runs (
+	id integer primary key autoincrement,
+	started integer not null,
+	duration_ms integer not null,
+	total integer not null,
+	failed integer not null,
+	bytes integer not null
+);
+`
+
+func openStateDB() (*sql.DB, error) {
+	return store.OpenState(archiveRoot, stateSchema+queueSchema+addedSchema+warcSchema+linkChecksSchema+linkDriftSchema+imapSchema+telegramSchema+urlFileSchema)
+}
+
+func stateDBExists() bool {
+	return store.StateExists(archiveRoot)
+}
+
+type runRecord struct {
+	started  time.Time
+	duration time.Duration
+	total    int
+	failed   int
+	bytes    int64
+}
+
+func saveRun(db *sql.DB, run runRecord) error {
+	_, err := db.Exec(`insert into runs (started, duration_ms, total, failed, bytes) values (?, ?, ?, ?, ?)`,
+		run.started.Unix(), run.duration.Milliseconds(), run.total, run.failed, run.bytes)
+	if err != nil {
+		return fmt.Errorf("save run into state database: %w", err)
+	}
+	return nil
+}
+
+// listRuns returns the most recent runs first.
+func listRuns(db *sql.DB, limit int) ([]runRecord, error) {
+	rows, err := db.Query(`select started, duration_ms, total, failed, bytes from runs order by id desc limit ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query runs from state database: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []runRecord
+	for rows.Next() {
+		var started, durationMS int64
+		var run runRecord
+		if err := rows.Scan(&started, &durationMS, &run.total, &run.failed, &run.bytes); err != nil {
+			return nil, fmt.Errorf("query run row: %w", err)
+		}
+		run.started = time.Unix(started, 0)
+		run.duration = time.Duration(durationMS) * time.Millisecond
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,134 @@
+package uebarchive
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+type runStats struct {
+	runRecord
+
+	avgFetch  time.Duration
+	perDomain map[string]int
+	// skipped bookmarks are counted as failed too
+	skipped int
+	// diskBytes is what all the captures take on the disk, bytes are only of the captured files
+	diskBytes int64
+	largest   []bookmark
+}
+
+func collectStats(list []bookmark, started time.Time) runStats {
+	stats := runStats{
+		runRecord: runRecord{
+			started:  started,
+			duration: time.Since(started).Truncate(time.Second),
+			total:    len(list),
+		},
+		perDomain: make(map[string]int),
+	}
+
+	var fetchTime time.Duration
+	for _, bmark := range list {
+		stats.perDomain[bmark.domain()]++
+		if bmark.archiveMeta == nil {
+			stats.failed++
+			if bmark.skipped() {
+				stats.skipped++
+			}
+			continue
+		}
+		stats.bytes += bmark.archiveMeta.size
+		stats.diskBytes += bmark.diskUsage()
+		fetchTime += bmark.archiveMeta.execTime
+	}
+	stats.largest = largestCaptures(list, largestCapturesShown)
+
+	if ok := stats.total - stats.failed; ok > 0 {
+		stats.avgFetch = (fetchTime / time.Duration(ok)).Truncate(time.Millisecond)
+	}
+
+	return stats
+}
+
+func (r runRecord) failureRate() float64 {
+	if r.total == 0 {
+		return 0
+	}
+	return 100 * float64(r.failed) / float64(r.total)
+}
+
+// printSummary tells how the run went, along with every failed bookmark,
+// so a cron mail is enough to see what's wrong.
+func printSummary(list []bookmark, stats runStats) {
+	if quiet {
+		// failures are already reported as warnings
+		return
+	}
+
+	fmt.Fprintf(console, "\narchived %d of %d bookmarks (%s, %s on disk) in %s, %d failed, %d skipped\n",
+		stats.total-stats.failed, stats.total, humanBytes(stats.bytes), humanBytes(stats.diskBytes), stats.duration, stats.failed-stats.skipped, stats.skipped)
+	if stats.failed == stats.skipped {
+		return
+	}
+
+	for _, bmark := range list {
+		if bmark.archiveMeta == nil && !bmark.skipped() {
+			fmt.Fprintf(console, "FAILED  %s: %s\n", bmark.url, bmark.failure)
+		}
+	}
+	fmt.Fprintf(console, "details: %s\n", path.Join(archiveRoot, "failures.html"))
+}
+
+func makeStatsPage(stats runStats, history []runRecord) error {
+	page := `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>μeb-archive stats</title></head><body><h1>μeb-archive stats</h1>`
+	page += `<p><a href="index.html">back to index</a></p>`
+
+	page += "<ul>"
+	page += fmt.Sprintf("<li>total pages: %d</li>", stats.total)
+	page += fmt.Sprintf("<li>total size: %s, %s on disk</li>", humanBytes(stats.bytes), humanBytes(stats.diskBytes))
+	page += fmt.Sprintf("<li>average fetch time: %s</li>", stats.avgFetch)
+	page += fmt.Sprintf("<li>failed: %d (%.1f%%)</li>", stats.failed, stats.failureRate())
+	page += "</ul>"
+
+	domains := slices.SortedFunc(maps.Keys(stats.perDomain), func(a, b string) int {
+		if c := cmp.Compare(stats.perDomain[b], stats.perDomain[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	page += "<h2>domains</h2><table><tr><th>domain</th><th>pages</th></tr>"
+	for _, domain := range domains {
+		page += fmt.Sprintf("<tr><td>%s</td><td>%d</td></tr>", html.EscapeString(domain), stats.perDomain[domain])
+	}
+	page += "</table>"
+
+	page += "<h2>largest captures</h2><table><tr><th>page</th><th>files</th><th>on disk</th></tr>"
+	for _, bmark := range stats.largest {
+		rel, _ := bmark.archiveMeta.index()
+		page += fmt.Sprintf(`<tr><td><a href="%s">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(index.FileHref(rel)), html.EscapeString(bmark.displayTitle()),
+			humanBytes(bmark.archiveMeta.size), humanBytes(bmark.diskUsage()))
+	}
+	page += "</table>"
+
+	page += "<h2>runs</h2><table><tr><th>started</th><th>took</th><th>pages</th><th>failed</th><th>size</th></tr>"
+	for _, run := range history {
+		page += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%d (%.1f%%)</td><td>%s</td></tr>",
+			run.started.Format(time.DateTime), run.duration, run.total, run.failed, run.failureRate(), humanBytes(run.bytes))
+	}
+	page += "</table></body></html>"
+
+	if err := os.WriteFile(path.Join(archiveRoot, "stats.html"), []byte(page), 0o600); err != nil {
+		return fmt.Errorf("write stats file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package store reads and writes what the archive keeps in its root:
+// the index.json manifest of the bookmarks and the state database.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// ManifestFile is the manifest's name in the archive root.
+const ManifestFile = "index.json"
+
+// Entry is a single bookmark as it appears in the index.json,
+// that's a public format, so be careful with renaming the fields.
+type Entry struct {
+	Hash      int64     `json:"hash"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	DateAdded time.Time `json:"date_added"`
+	Modified  time.Time `json:"last_modified,omitzero"`
+	Position  int       `json:"position,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	Aliases   []string  `json:"aliases,omitempty"`
+	Merged    []int64   `json:"merged,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	AutoTags  []string  `json:"auto_tags,omitempty"`
+
+	Path       string    `json:"path,omitempty"`
+	Files      []string  `json:"files,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	DiskSize   int64     `json:"disk_size,omitempty"`
+	ArchivedAt time.Time `json:"archived_at,omitzero"`
+	FetchTime  string    `json:"fetch_time,omitempty"`
+	HTTPStatus int       `json:"http_status,omitempty"`
+	Downloaded string    `json:"downloaded,omitempty"`
+
+	Requests int         `json:"requests,omitempty"`
+	Statuses map[int]int `json:"statuses,omitempty"`
+	Received int64       `json:"received,omitempty"`
+
+	RobotsSkipped []string `json:"robots_skipped,omitempty"`
+	Recovered     string   `json:"recovered,omitempty"`
+	Wayback       string   `json:"wayback,omitempty"`
+	FinalURL      string   `json:"final_url,omitempty"`
+	Redirects     []string `json:"redirects,omitempty"`
+	Thumbnail     string   `json:"thumbnail,omitempty"`
+	Text          string   `json:"text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Sanitized     int      `json:"sanitized,omitempty"`
+	Localized     int      `json:"localized,omitempty"`
+	Requisites    int      `json:"requisites,omitempty"`
+	Missing       []string `json:"missing,omitempty"`
+
+	Words map[string]int `json:"words,omitempty"`
+
+	PageTitle   string    `json:"page_title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Published   time.Time `json:"published,omitzero"`
+	Canonical   string    `json:"canonical,omitempty"`
+	Lang        string    `json:"lang,omitempty"`
+
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// ReadManifest reads the entries of the archive's manifest, in the order of the index.
+func ReadManifest(root string) ([]Entry, error) {
+	bs, err := os.ReadFile(path.Join(root, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(bs, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// WriteManifest replaces the archive's manifest with the entries.
+func WriteManifest(root string, entries []Entry) error {
+	bs, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path.Join(root, ManifestFile), bs, 0o600); err != nil {
+		return fmt.Errorf("write manifest file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StateFile is the state database's name in the archive root,
+// it keeps whatever is remembered between runs.
+const StateFile = "state.sqlite"
+
+// OpenState opens the archive's state database, creating the root and the tables
+// of the schema if there are none yet.
+func OpenState(root, schema string) (*sql.DB, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, fmt.Errorf("create archive root: %w", err)
+	}
+
+	connstr := fmt.Sprintf("file:%s?_busy_timeout=5000", path.Join(root, StateFile))
+	db, err := sql.Open("sqlite3", connstr)
+	if err != nil {
+		return nil, fmt.Errorf("open state database: %w", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init state database: %w", err)
+	}
+
+	return db, nil
+}
+
+// StateExists tells if there is a state database in the root, a dry run doesn't create one.
+func StateExists(root string) bool {
+	_, err := os.Stat(path.Join(root, StateFile))
+	return err == nil
+}
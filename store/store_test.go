@@ -0,0 +1,68 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	entries := []Entry{
+		{
+			Hash:       47356483967542,
+			Title:      "Go",
+			URL:        "https://go.dev/",
+			Status:     "OK",
+			DateAdded:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			Tags:       []string{"lang"},
+			Path:       "captures/47356483967542/go.dev/index.html",
+			Files:      []string{"captures/47356483967542/go.dev/index.html"},
+			Statuses:   map[int]int{200: 1},
+			HTTPStatus: 200,
+		},
+		{Hash: 1, URL: "https://example.com/gone", Status: "MISSING", Error: "http status 404", ExitCode: 8},
+	}
+	if err := WriteManifest(root, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadManifest(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("got  %+v\nwant %+v", got, entries)
+	}
+}
+
+func TestOpenState(t *testing.T) {
+	root := t.TempDir() + "/archive"
+	if StateExists(root) {
+		t.Fatal("the state exists before it's opened")
+	}
+
+	const schema = `create table if not exists runs (id integer primary key, total integer not null);`
+	db, err := OpenState(root, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`insert into runs (total) values (3)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the tables are kept as they are
+	db, err = OpenState(root, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var total int
+	if err := db.QueryRow(`select total from runs`).Scan(&total); err != nil || total != 3 {
+		t.Errorf("total = %d, %v; want 3", total, err)
+	}
+	if !StateExists(root) {
+		t.Error("the state doesn't exist after it's opened")
+	}
+}
@@ -0,0 +1,187 @@
+package uebarchive
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// summarizerKind is the api the summary step talks to: ollama or openai
+	summarizerKind string
+	summarizerURL  string
+	// summarizerModel is the model to ask, the api's default one if empty
+	summarizerModel string
+	summarizerKey   string
+)
+
+const (
+	// the beginning of a long article is enough to tell what it's about,
+	// and local models have small context windows
+	maxSummaryInput = 12000
+	// local models on a laptop are slow
+	summaryTimeout = 5 * time.Minute
+)
+
+const summaryPrompt = `Summarize the following web page in 2-3 sentences, in the language of the page.
+Reply with the summary only, no introduction.
+
+Title: %s
+
+%s`
+
+// summarizer writes a summary of a text, it's an llm behind an api.
+type summarizer interface {
+	summarize(ctx context.Context, prompt string) (string, error)
+}
+
+// newSummarizer is the -summarizer one, with the api's defaults for the url and the model.
+func newSummarizer() (summarizer, error) {
+	client := &http.Client{Timeout: summaryTimeout}
+	switch summarizerKind {
+	case "ollama":
+		return ollamaSummarizer{
+			client: client,
+			url:    strings.TrimSuffix(cmp.Or(summarizerURL, "http://localhost:11434"), "/"),
+			model:  cmp.Or(summarizerModel, "llama3.2"),
+		}, nil
+	case "openai":
+		return openAISummarizer{
+			client: client,
+			url:    strings.TrimSuffix(cmp.Or(summarizerURL, "https://api.openai.com/v1"), "/"),
+			model:  cmp.Or(summarizerModel, "gpt-4o-mini"),
+			key:    summarizerKey,
+		}, nil
+	case "":
+		return nil, errors.New("the summary step needs -summarizer")
+	default:
+		return nil, fmt.Errorf("unknown -summarizer %q, have: ollama, openai", summarizerKind)
+	}
+}
+
+// summaryStep asks the -summarizer for a few sentences on what the captured article is about.
+type summaryStep struct{}
+
+func (summaryStep) name() string { return "summary" }
+
+func (summaryStep) run(ctx context.Context, bmark *bookmark) error {
+	s, err := newSummarizer()
+	if err != nil {
+		return err
+	}
+	text, ok, err := readArticle(*bmark)
+	if err != nil || !ok {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, block := range text.blocks {
+		if sb.Len() > maxSummaryInput {
+			break
+		}
+		sb.WriteString(block.text + "\n")
+	}
+	input := sb.String()
+	if len(input) > maxSummaryInput {
+		input = strings.ToValidUTF8(input[:maxSummaryInput], "")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+	summary, err := s.summarize(ctx, fmt.Sprintf(summaryPrompt, text.title, input))
+	if err != nil {
+		return fmt.Errorf("summarize: %w", err)
+	}
+	bmark.archiveMeta.summary = cleanText(summary)
+	return nil
+}
+
+// ollamaSummarizer uses ollama's own api, see https://github.com/ollama/ollama/blob/main/docs/api.md
+type ollamaSummarizer struct {
+	client *http.Client
+	url    string
+	model  string
+}
+
+func (o ollamaSummarizer) summarize(ctx context.Context, prompt string) (string, error) {
+	var resp struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+	}
+	err := postJSON(ctx, o.client, o.url+"/api/generate", "", map[string]any{
+		"model":  o.model,
+		"prompt": prompt,
+		"stream": false,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Error) > 0 {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Response, nil
+}
+
+// openAISummarizer uses the chat completions api, which most of the hosted
+// and self-hosted servers implement as well: llama.cpp, vLLM, LM Studio.
+type openAISummarizer struct {
+	client *http.Client
+	url    string
+	model  string
+	key    string
+}
+
+func (o openAISummarizer) summarize(ctx context.Context, prompt string) (string, error) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(ctx, o.client, o.url+"/chat/completions", o.key, map[string]any{
+		"model":       o.model,
+		"messages":    []map[string]string{{"role": "user", "content": prompt}},
+		"temperature": 0.2,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in the response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// postJSON posts the request as json and decodes the json response,
+// a non-empty key is sent as the bearer token.
+func postJSON(ctx context.Context, client *http.Client, endpoint, key string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(key) > 0 {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: http status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,91 @@
+package uebarchive
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sdNotify sends a state like "READY=1" to systemd, if we're running
+// under it with Type=notify, does nothing otherwise.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if len(socket) == 0 {
+		return
+	}
+	if socket[0] == '@' {
+		// abstract socket
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Debug("sd_notify failed", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Debug("sd_notify failed", "err", err)
+	}
+}
+
+// lastProgress is when the daemon has last shown it isn't stuck: a bookmark archived,
+// a link checked, or the main loop waiting for the next run, see markProgress.
+var lastProgress atomic.Int64
+
+func markProgress() {
+	lastProgress.Store(time.Now().UnixNano())
+}
+
+// stalled tells if there has been no progress for longer than a download may take,
+// with a few minutes more for its post-processing.
+func stalled() bool {
+	limit := max(downloadTimeout, mirrorTimeout) + 15*time.Minute
+	return time.Since(time.Unix(0, lastProgress.Load())) > limit
+}
+
+// sdWatchdog pings systemd twice per WatchdogSec= until the context is done,
+// as long as the daemon makes progress, so a stuck one is restarted.
+func sdWatchdog(ctx context.Context) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	tick := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if stalled() {
+				slog.Warn("no progress for a while, leaving the watchdog to restart the daemon")
+				continue
+			}
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
+
+// listen returns the socket passed by systemd socket activation,
+// or listens on the addr if there is none.
+func listen(addr string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+		if n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS")); n > 0 {
+			// the first passed descriptor is always 3, we only need one
+			f := os.NewFile(3, "LISTEN_FD_3")
+			defer f.Close()
+			slog.Debug("using the socket from systemd")
+			return net.FileListener(f)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,99 @@
+package uebarchive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+var (
+	telegramToken string
+	telegramUsers string
+)
+
+// the telegram table remembers the update to read from, per bot.
+const telegramSchema = `
+create table if not exists telegram_bots (
+	bot text primary key,
+	next_update integer not null
+);
+`
+
+// addTelegramLinks adds links sent or forwarded to the -telegram-token bot, see addedSources,
+// the easy way to archive a page from the phone. Anyone can write to a bot,
+// so only the messages of -telegram-users are taken, and answered to: user ids,
+// which are better, as a username may be changed and taken by anyone then, or usernames.
+func addTelegramLinks(ctx context.Context, state *sql.DB) error {
+	if len(telegramUsers) == 0 {
+		return errors.New("-telegram-users is required, anyone can write to the bot")
+	}
+	users := strings.Split(strings.ReplaceAll(telegramUsers, "@", ""), ",")
+	for i := range users {
+		users[i] = strings.ToLower(strings.TrimSpace(users[i]))
+	}
+
+	transport, err := proxyTransport(defaultFetch.proxy)
+	if err != nil {
+		return err
+	}
+	bot := sources.Telegram{
+		Client: &http.Client{Timeout: time.Minute, Transport: transport},
+		Token:  telegramToken,
+	}
+	// the bot's id is the token up to the colon, the rest is the secret
+	botID, _, _ := strings.Cut(telegramToken, ":")
+
+	var offset int64
+	err = state.QueryRow(`select next_update from telegram_bots where bot = ?`, botID).Scan(&offset)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read telegram state: %w", err)
+	}
+
+	messages, offset, err := bot.Updates(ctx, offset)
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for _, msg := range messages {
+		// usernames are case-insensitive
+		id, username := strconv.FormatInt(msg.FromID, 10), strings.ToLower(msg.FromUsername)
+		if !slices.Contains(users, id) && (len(username) == 0 || !slices.Contains(users, username)) {
+			slog.Warn("telegram message from a stranger, skipping", "id", id, "username", msg.FromUsername)
+			continue
+		}
+		for _, link := range msg.Links {
+			b := newBookmark(link, "")
+			b.dateAdded = msg.Date
+			b.tags = []string{"telegram"}
+			if err := addBookmark(state, b); err != nil {
+				return err
+			}
+			added++
+		}
+		reply := fmt.Sprintf("%d links added, they are archived now", len(msg.Links))
+		if len(msg.Links) == 1 {
+			reply = "added, it's archived now"
+		}
+		if err := bot.Reply(ctx, msg, reply); err != nil {
+			slog.Warn("failed to answer the telegram message", "err", err)
+		}
+	}
+
+	_, err = state.Exec(`insert into telegram_bots (bot, next_update) values (?, ?)
+		on conflict (bot) do update set next_update=excluded.next_update`, botID, offset)
+	if err != nil {
+		return fmt.Errorf("save telegram state: %w", err)
+	}
+	slog.Info("telegram messages read", "messages", len(messages), "links", added)
+	return nil
+}
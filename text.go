@@ -0,0 +1,66 @@
+package uebarchive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// textFileName is the page's text in the capture directory.
+const textFileName = "page.txt"
+
+var (
+	// tags which start a new line of the text
+	blockTagRe = regexp.MustCompile(`(?i)</?(?:address|article|aside|blockquote|br|dd|div|dl|dt|figcaption|figure|footer|h[1-6]|header|hr|li|main|nav|ol|p|pre|section|table|td|th|title|tr|ul)\b[^>]*>`)
+	newlineRe  = regexp.MustCompile(`\s*\n\s*`)
+)
+
+// textStep saves the visible text of the captured page as page.txt, it's what
+// search looks into, and what's handy to grep through the archive.
+type textStep struct{}
+
+func (textStep) name() string { return "text" }
+
+func (textStep) run(_ context.Context, bmark *bookmark) error {
+	index, ok := bmark.archiveMeta.index()
+	if !ok {
+		return nil
+	}
+	if ext := strings.ToLower(path.Ext(index)); ext != ".html" && ext != ".htm" {
+		return nil
+	}
+	bs, err := os.ReadFile(path.Join(archiveRoot, index))
+	if err != nil {
+		return fmt.Errorf("read page: %w", err)
+	}
+
+	text := path.Join(bmark.captureDir(), textFileName)
+	if err := replaceFile(path.Join(archiveRoot, text), []byte(visibleText(string(bs)))); err != nil {
+		return fmt.Errorf("write text: %w", err)
+	}
+	bmark.archiveMeta.text = text
+	if !slices.Contains(bmark.archiveMeta.saved, text) {
+		bmark.archiveMeta.saved = append(bmark.archiveMeta.saved, text)
+	}
+	return nil
+}
+
+// visibleText is the visible text of the html page, like pageText,
+// but a paragraph, a heading or the like is a line of it.
+func visibleText(page string) string {
+	page = invisibleRe.ReplaceAllString(page, " ")
+	page = blockTagRe.ReplaceAllString(page, "\n")
+	page = anyTagRe.ReplaceAllString(inlineTagRe.ReplaceAllString(page, ""), " ")
+
+	var lines []string
+	for _, line := range newlineRe.Split(page, -1) {
+		if line = cleanText(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,94 @@
+package uebarchive
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/nikonov1101/ueb-archive/index"
+)
+
+// titleLinksDir keeps human-readable redirects to the actual captures.
+// Capture directories stay named after the url hash: the page title is only
+// known once the page is downloaded, and the manifest, exports, wget logs and
+// older archives all find a capture by its hash.
+const titleLinksDir = "by-title"
+
+// displayTitle returns the best title we have for a bookmark:
+// the one from firefox, the one from the page itself, or the url.
+func (b bookmark) displayTitle() string {
+	if len(b.title) > 0 {
+		return b.title
+	}
+	if b.archiveMeta != nil && len(b.archiveMeta.page.title) > 0 {
+		return b.archiveMeta.page.title
+	}
+	return b.url
+}
+
+// makeTitleLinks writes a by-title/<slug>.html redirect for every capture.
+func makeTitleLinks(list []bookmark) error {
+	dir := path.Join(archiveRoot, titleLinksDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clean %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, bmark := range list {
+		rel, ok := bmark.captured()
+		if !ok {
+			continue
+		}
+
+		name := uniqueSlug(seen, bmark.displayTitle(), bmark.hash)
+		target := "../" + index.FileHref(rel)
+		stub := fmt.Sprintf(`<!DOCTYPE html><html><head><meta charset="utf-8"><meta http-equiv="refresh" content="0; url=%s"></head><body><a href="%s">%s</a></body></html>`,
+			html.EscapeString(target), html.EscapeString(target), html.EscapeString(bmark.displayTitle()))
+		if err := os.WriteFile(path.Join(dir, name+".html"), []byte(stub), 0o600); err != nil {
+			return fmt.Errorf("write title link: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// uniqueSlug is the title's slug, with the hash appended if it's taken already.
+func uniqueSlug(seen map[string]bool, title string, hash int64) string {
+	name := slugify(title)
+	if len(name) == 0 || seen[name] {
+		name = strings.TrimPrefix(name+"-", "-") + fmt.Sprint(hash)
+	}
+	seen[name] = true
+	return name
+}
+
+// slugify turns a title into a short file-system friendly name.
+func slugify(title string) string {
+	const maxLen = 60
+
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := []rune(strings.TrimSuffix(sb.String(), "-"))
+	if len(slug) > maxLen {
+		slug = slug[:maxLen]
+	}
+	return strings.TrimSuffix(string(slug), "-")
+}
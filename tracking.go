@@ -0,0 +1,99 @@
+package uebarchive
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+// trackingParams are comma-separated names of query parameters to remove from urls,
+// a name may be a glob pattern.
+var trackingParams = defaultTrackingParams
+
+const defaultTrackingParams = "utm_*,fbclid,gclid,dclid,gbraid,wbraid,msclkid,yclid,twclid,igshid,mc_cid,mc_eid,_hsenc,_hsmi,mkt_tok,oly_anon_id,oly_enc_id,vero_id,wickedid,ref_src"
+
+// isTrackingParam tells if the query parameter is one of -strip-params.
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range strings.Split(trackingParams, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if len(pattern) == 0 {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stripTracking removes tracking parameters from the url query,
+// the rest of the url is left as it is, byte for byte.
+func stripTracking(rawURL string) string {
+	rest, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, query, hasQuery := strings.Cut(rest, "?")
+	if !hasQuery {
+		return rawURL
+	}
+
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if len(param) > 0 && !isTrackingParam(name) {
+			kept = append(kept, param)
+		}
+	}
+
+	stripped := base
+	if len(kept) > 0 {
+		stripped += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		stripped += "#" + fragment
+	}
+	return stripped
+}
+
+// stripTrackingParams strips tracking parameters from the bookmarks' urls,
+// bookmarks whose url has changed get the hash of the new one, and their capture
+// is moved to it, see moveCapture.
+func stripTrackingParams(list []bookmark) {
+	for i := range list {
+		if stripped := stripTracking(list[i].url); stripped != list[i].url {
+			old := list[i]
+			list[i].url = stripped
+			list[i].hash = sources.URLHash(stripped)
+			moveCapture(old, list[i])
+		}
+	}
+}
+
+// moveCapture renames the capture of the bookmark's old url to the one of its new url,
+// a capture made before the -strip-params has changed would be downloaded again
+// otherwise, and the old one pruned. Its meta.json has paths relative to the dir.
+func moveCapture(from, to bookmark) {
+	if dryRun {
+		return
+	}
+	src, dst := path.Join(archiveRoot, from.captureDir()), path.Join(archiveRoot, to.captureDir())
+	if _, err := os.Stat(src); err != nil {
+		return
+	}
+	if _, err := os.Stat(dst); err == nil {
+		// captured under the new url already, the old one is pruned
+		return
+	}
+	if err := os.Rename(src, dst); err != nil {
+		slog.Warn("failed to move the capture to the url without tracking parameters", "url", to.url, "err", err)
+		return
+	}
+	os.Rename(from.logfile(), to.logfile())
+	slog.Info("moved the capture to the url without tracking parameters", "from", from.url, "to", to.url)
+}
@@ -0,0 +1,105 @@
+package uebarchive
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+)
+
+// urlFiles are -url-file text files of urls, read on every run along with the -browser,
+// so urls gone from there are gone from the index, as removed bookmarks are.
+var urlFiles listFlag
+
+// the url_file_urls table remembers when the urls were first seen in a -url-file,
+// the file's own time changes with every line added.
+const urlFileSchema = `
+create table if not exists url_file_urls (
+	url text primary key,
+	first_seen integer not null
+);
+`
+
+// readURLFile reads an url per line, optionally followed by the title,
+// blank lines and # comments are skipped. The file doesn't tell when the urls were added,
+// so they are added when the file was last written, in the order of the lines,
+// as they are first seen, and keep that date afterwards, see firstSeenDates.
+func readURLFile(name string) ([]bookmark, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []bookmark
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		link, title, _ := strings.Cut(line, " ")
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s: not an url: %q", name, link)
+		}
+		list = append(list, bookmark{
+			title:     strings.TrimSpace(title),
+			url:       link,
+			hash:      sources.URLHash(link),
+			dateAdded: info.ModTime().Add(time.Duration(len(list)) * time.Microsecond),
+			position:  len(list) + 1,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	if err := firstSeenDates(list); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return list, nil
+}
+
+// firstSeenDates sets the dates of the urls seen before to the ones they were
+// first seen with, and remembers the new ones, unless it's a -dry-run.
+func firstSeenDates(list []bookmark) error {
+	if dryRun && !stateDBExists() {
+		return nil
+	}
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	tx, err := state.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, bmark := range list {
+		var firstSeen int64
+		err := tx.QueryRow(`select first_seen from url_file_urls where url = ?`, bmark.url).Scan(&firstSeen)
+		switch {
+		case err == nil:
+			list[i].dateAdded = time.UnixMicro(firstSeen)
+		case !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("read url dates: %w", err)
+		case !dryRun:
+			_, err := tx.Exec(`insert into url_file_urls (url, first_seen) values (?, ?)`, bmark.url, bmark.dateAdded.UnixMicro())
+			if err != nil {
+				return fmt.Errorf("save url dates: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,135 @@
+package uebarchive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+var verifyRepair bool
+
+func verifyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verifyRepair, "repair", false, "download the pages with broken captures again")
+}
+
+// runVerify re-hashes every captured file listed in captures' meta.json
+// and reports files that are missing or have changed since the capture,
+// and index.json entries whose capture directory is gone altogether.
+func runVerify(ctx context.Context, _ []string) error {
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+
+	metas, _ := filepath.Glob(path.Join(archiveRoot, "captures", "*", "meta.json"))
+
+	problems := 0
+	// broken are the urls of the broken captures
+	broken := make(map[string]bool)
+	for _, metaFile := range metas {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		bs, err := os.ReadFile(metaFile)
+		if err != nil {
+			slog.Warn("verify: read capture meta", "path", metaFile, "err", err)
+			problems++
+			continue
+		}
+
+		var meta captureMetaFile
+		if err := json.Unmarshal(bs, &meta); err != nil {
+			slog.Warn("verify: parse capture meta", "path", metaFile, "err", err)
+			problems++
+			continue
+		}
+
+		dir := filepath.Dir(metaFile)
+		for _, f := range meta.Files {
+			sum, _, err := hashFile(path.Join(dir, f.Path))
+			switch {
+			case os.IsNotExist(err):
+				fmt.Printf("MISSING  %s (%s)\n", path.Join(dir, f.Path), meta.URL)
+			case err != nil:
+				fmt.Printf("ERROR    %s: %v\n", path.Join(dir, f.Path), err)
+			case sum != f.SHA256:
+				fmt.Printf("CHANGED  %s (%s)\n", path.Join(dir, f.Path), meta.URL)
+			default:
+				continue
+			}
+			problems++
+			broken[meta.URL] = true
+		}
+	}
+
+	entries, err := readManifest()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	for _, entry := range entries {
+		bmark := entryBookmark(entry)
+		if bmark.archiveMeta == nil {
+			continue
+		}
+		dir := path.Join(archiveRoot, bmark.captureDir())
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("VANISHED %s (%s)\n", dir, bmark.url)
+			problems++
+			broken[bmark.url] = true
+		}
+	}
+
+	slog.Info("verified", "captures", len(metas), "problems", problems)
+	if problems == 0 {
+		return nil
+	}
+	if !verifyRepair || len(broken) == 0 {
+		return exitCode(1)
+	}
+	return repairCaptures(ctx, broken, order)
+}
+
+// repairCaptures downloads the broken pages again, in place of their captures.
+func repairCaptures(ctx context.Context, broken map[string]bool, order func(a, b bookmark) int) error {
+	if _, err := exec.LookPath("wget"); err != nil {
+		return err
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	slog.Info("repairing", "urls", len(broken))
+	list, err := archiveAgain(ctx, state, broken, order)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, bmark := range list {
+		if !broken[bmark.url] {
+			continue
+		}
+		if bmark.archiveMeta == nil {
+			fmt.Printf("FAILED   %s: %s\n", bmark.url, bmark.failure)
+			failed = true
+			continue
+		}
+		fmt.Printf("REPAIRED %s\n", bmark.url)
+	}
+	if failed {
+		return exitCode(1)
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+package uebarchive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// warc files are copied into the archive root, and every response in them
+// is indexed by url, that's what the /replay is served from.
+const warcSchema = `
+create table if not exists warc_records (
+	url text not null,
+	warc text not null,
+	offset integer not null,
+	mime text not null,
+	status integer not null,
+	date integer not null
+);
+create index if not exists warc_records_url on warc_records (url);
+`
+
+// warcRecord is a single record header, the block follows it.
+type warcRecord struct {
+	header textproto.MIMEHeader
+	// offset of the record in the file, of its gzip member for .warc.gz
+	offset int64
+}
+
+func (r warcRecord) targetURI() string {
+	// some writers wrap it in <>, as the 1.0 spec grammar said
+	return strings.Trim(r.header.Get("WARC-Target-URI"), "<>")
+}
+
+// warcReader reads records one by one, plain or gzipped per record.
+type warcReader struct {
+	counter *countingReader
+	buf     *bufio.Reader
+	gzipped bool
+	zr      *gzip.Reader
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newWARCReader(r io.Reader, gzipped bool) *warcReader {
+	counter := &countingReader{r: r}
+	return &warcReader{counter: counter, buf: bufio.NewReader(counter), gzipped: gzipped}
+}
+
+// next returns the record header and its block, the block
+// must be read (or not) before the next call.
+func (w *warcReader) next() (warcRecord, io.Reader, error) {
+	rec := warcRecord{offset: w.counter.n - int64(w.buf.Buffered())}
+
+	src := w.buf
+	if w.gzipped {
+		if _, err := w.buf.Peek(1); err != nil {
+			return rec, nil, err
+		}
+		var err error
+		if w.zr == nil {
+			w.zr, err = gzip.NewReader(w.buf)
+		} else {
+			err = w.zr.Reset(w.buf)
+		}
+		if err != nil {
+			return rec, nil, fmt.Errorf("read warc record at %d: %w", rec.offset, err)
+		}
+		// every record is its own gzip member, that's what makes offsets work
+		w.zr.Multistream(false)
+		src = bufio.NewReader(w.zr)
+	}
+
+	header, length, err := readWARCHeader(src)
+	if err != nil {
+		return rec, nil, err
+	}
+	rec.header = header
+
+	block := io.LimitReader(src, length)
+	return rec, &warcBlock{Reader: block, rest: src, gzipped: w.gzipped}, nil
+}
+
+// warcBlock is the record block, once it's over the rest
+// of the record is skipped, so the reader is at the next one.
+type warcBlock struct {
+	io.Reader
+	rest    *bufio.Reader
+	gzipped bool
+}
+
+// skip discards what's left of the record.
+func (b *warcBlock) skip() error {
+	if _, err := io.Copy(io.Discard, b.Reader); err != nil {
+		return err
+	}
+	if b.gzipped {
+		_, err := io.Copy(io.Discard, b.rest)
+		return err
+	}
+	// the block is followed by two CRLFs
+	_, err := b.rest.Discard(4)
+	return err
+}
+
+func readWARCHeader(r *bufio.Reader) (textproto.MIMEHeader, int64, error) {
+	version, err := r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(version) == 0 {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("read warc version: %w", err)
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, 0, fmt.Errorf("not a warc record: %q", strings.TrimSpace(version))
+	}
+
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, 0, fmt.Errorf("read warc header: %w", err)
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad warc record length: %w", err)
+	}
+	return header, length, nil
+}
+
+// warcResponse is a response or resource record, parsed.
+type warcResponse struct {
+	url    string
+	date   time.Time
+	status int
+	mime   string
+	header http.Header
+	body   []byte
+}
+
+// parseWARCResponse reads the block of a response or resource record,
+// the body is decoded if the server has compressed it.
+func parseWARCResponse(rec warcRecord, block io.Reader) (warcResponse, error) {
+	resp := warcResponse{url: rec.targetURI(), status: http.StatusOK}
+	resp.date, _ = time.Parse(time.RFC3339, rec.header.Get("WARC-Date"))
+
+	if rec.header.Get("WARC-Type") == "resource" {
+		// no http in there, just the content
+		resp.mime = rec.header.Get("Content-Type")
+		resp.header = http.Header{"Content-Type": {resp.mime}}
+		body, err := io.ReadAll(block)
+		resp.body = body
+		return resp, err
+	}
+
+	httpResp, err := http.ReadResponse(bufio.NewReader(block), nil)
+	if err != nil {
+		return resp, fmt.Errorf("read http response: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	resp.status = httpResp.StatusCode
+	resp.header = httpResp.Header
+	resp.mime = httpResp.Header.Get("Content-Type")
+
+	body := io.Reader(httpResp.Body)
+	if strings.EqualFold(httpResp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(httpResp.Body)
+		if err != nil {
+			return resp, fmt.Errorf("decode body: %w", err)
+		}
+		body = zr
+		resp.header.Del("Content-Encoding")
+	}
+	resp.body, err = io.ReadAll(body)
+	// the length is of the compressed body, or of the chunks
+	resp.header.Del("Content-Length")
+	resp.header.Del("Transfer-Encoding")
+	return resp, err
+}
+
+func (r warcResponse) isPage() bool {
+	mt, _, _ := mime.ParseMediaType(r.mime)
+	return r.status == http.StatusOK && (mt == "text/html" || mt == "application/xhtml+xml")
+}
+
+// readWARCs copies warc files into the archive root, indexes their records
+// for the /replay, and returns html pages in them as bookmarks.
+// The copies are named by their content too, see warcName.
+func readWARCs(state *sql.DB, files []string) ([]importedBookmark, error) {
+	if err := os.MkdirAll(path.Join(archiveRoot, "warcs"), 0o700); err != nil {
+		return nil, fmt.Errorf("create warcs dir: %w", err)
+	}
+
+	var pages []importedBookmark
+	for _, file := range files {
+		name, err := warcName(file)
+		if err != nil {
+			return nil, fmt.Errorf("read warc: %w", err)
+		}
+		to := path.Join(archiveRoot, name)
+		if err := os.Link(file, to); err != nil && !sameFile(file, to) {
+			if err := copyFile(file, to); err != nil {
+				return nil, fmt.Errorf("copy warc: %w", err)
+			}
+		}
+
+		found, err := indexWARC(state, name)
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", file, err)
+		}
+		pages = append(pages, found...)
+	}
+	return pages, nil
+}
+
+// warcName is the name of the warc's copy, relative to the archive root:
+// the file's name with the hash of its content, so another warc of the same name
+// doesn't overwrite the one the index refers to, the same one imported again does.
+func warcName(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil)[:6])
+
+	base := path.Base(file)
+	if strings.Contains(base, "-"+sum+".") {
+		// one of ours, imported again from the warcs dir
+		return path.Join("warcs", base), nil
+	}
+	stem, ext := base, ""
+	for _, suffix := range []string{".warc.gz", ".warc"} {
+		if cut, ok := strings.CutSuffix(base, suffix); ok {
+			stem, ext = cut, suffix
+			break
+		}
+	}
+	return path.Join("warcs", stem+"-"+sum+ext), nil
+}
+
+// sameFile is true if both names are the same file, e.g. a warc imported again,
+// copying it would truncate it.
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// indexWARC replaces index rows of the warc, name is relative to the archive root.
+func indexWARC(state *sql.DB, name string) ([]importedBookmark, error) {
+	f, err := os.Open(path.Join(archiveRoot, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tx, err := state.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`delete from warc_records where warc=?`, name); err != nil {
+		return nil, err
+	}
+
+	var pages []importedBookmark
+	r := newWARCReader(f, strings.HasSuffix(name, ".gz"))
+	for {
+		rec, block, err := r.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch rec.header.Get("WARC-Type") {
+		case "response", "resource":
+			if u := rec.targetURI(); !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+				// e.g. wget's own metadata:// records
+				break
+			}
+			resp, err := parseWARCResponse(rec, block)
+			if err != nil {
+				slog.Warn("skipping unreadable warc record", "warc", name, "offset", rec.offset, "err", err)
+				break
+			}
+			_, err = tx.Exec(`insert into warc_records (url, warc, offset, mime, status, date) values (?, ?, ?, ?, ?, ?)`,
+				resp.url, name, rec.offset, resp.mime, resp.status, resp.date.Unix())
+			if err != nil {
+				return nil, fmt.Errorf("save warc record: %w", err)
+			}
+			if resp.isPage() {
+				b := importedBookmark{bookmark: newBookmark(resp.url, ""), fetched: resp.date}
+				b.dateAdded = resp.date
+				b.warc = &warcRef{name: name, offset: rec.offset}
+				pages = append(pages, b)
+			}
+		}
+		if err := block.(*warcBlock).skip(); err != nil {
+			return nil, fmt.Errorf("read warc record at %d: %w", rec.offset, err)
+		}
+	}
+	return pages, tx.Commit()
+}
+
+// warcRef points to a record in a warc file, relative to the archive root.
+type warcRef struct {
+	name   string
+	offset int64
+}
+
+// importWARCPage writes the page, with links pointing to the /replay,
+// as the bookmark's capture. Opened as a file it's text only,
+// served by "ueb-archive serve" it has everything the warc has.
+func importWARCPage(b importedBookmark) error {
+	dir := b.captureDir()
+	if err := os.MkdirAll(path.Join(archiveRoot, dir), 0o700); err != nil {
+		return fmt.Errorf("create capture dir: %w", err)
+	}
+
+	resp, err := readWARCResponseAt(path.Join(archiveRoot, b.warc.name), b.warc.offset)
+	if err != nil {
+		return fmt.Errorf("read warc: %w", err)
+	}
+	index := path.Join(dir, "index.html")
+	page := rewriteForReplay(resp.url, resp.body, resp.mime)
+	if err := os.WriteFile(path.Join(archiveRoot, index), page, 0o600); err != nil {
+		return fmt.Errorf("write page: %w", err)
+	}
+
+	meta := &archiveMeta{saved: []string{index}, archivedAt: b.fetched, httpStatus: resp.status}
+	meta.files = hashCapturedFiles(meta.saved)
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+	b.archiveMeta = meta
+	return writeCaptureMeta(b.bookmark)
+}
+
+var (
+	replayAttrRe = regexp.MustCompile(`(?i)(\s(?:src|href|action|poster|data)\s*=\s*)("[^"]*"|'[^']*')`)
+	replayCSSRe  = regexp.MustCompile(`(?i)url\(\s*("[^"]*"|'[^']*'|[^)'"]*)\s*\)`)
+)
+
+// rewriteForReplay points links of html and css to the /replay,
+// resolving them against the url the content came from, anything else is left as is.
+func rewriteForReplay(from string, content []byte, contentType string) []byte {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if mt != "text/html" && mt != "application/xhtml+xml" && mt != "text/css" {
+		return content
+	}
+	base, err := url.Parse(from)
+	if err != nil {
+		return content
+	}
+	replayURL := func(ref string) string {
+		ref = strings.TrimSpace(ref)
+		if len(ref) == 0 || strings.HasPrefix(ref, "#") {
+			return ref
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ref
+		}
+		return "/replay?url=" + url.QueryEscape(u.String())
+	}
+
+	css := replayCSSRe.ReplaceAllFunc(content, func(m []byte) []byte {
+		sub := replayCSSRe.FindSubmatch(m)
+		ref := strings.Trim(string(sub[1]), `"'`)
+		return []byte(`url("` + replayURL(ref) + `")`)
+	})
+	if mt == "text/css" {
+		return css
+	}
+
+	return replayAttrRe.ReplaceAllFunc(css, func(m []byte) []byte {
+		sub := replayAttrRe.FindSubmatch(m)
+		quote := sub[2][:1]
+		ref := string(sub[2][1 : len(sub[2])-1])
+		return bytes.Join([][]byte{sub[1], quote, []byte(replayURL(ref)), quote}, nil)
+	})
+}
+
+// serveReplay serves the latest response for ?url= from imported warc files.
+func serveReplay(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if len(target) == 0 {
+		http.Error(w, "?url= is required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer state.Close()
+
+	var name string
+	var offset int64
+	row := state.QueryRowContext(r.Context(), `select warc, offset from warc_records where url=? order by date desc limit 1`, target)
+	if err := row.Scan(&name, &offset); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "not in the archived warc files", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := readWARCResponseAt(path.Join(archiveRoot, name), offset)
+	if err != nil {
+		slog.Warn("replay: read warc", "warc", name, "offset", offset, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, key := range []string{"Content-Type", "Last-Modified", "Location"} {
+		if v := resp.header.Get(key); len(v) > 0 {
+			w.Header().Set(key, v)
+		}
+	}
+	if loc := resp.header.Get("Location"); len(loc) > 0 {
+		if u, err := url.Parse(target); err == nil {
+			if abs, err := u.Parse(loc); err == nil {
+				w.Header().Set("Location", "/replay?url="+url.QueryEscape(abs.String()))
+			}
+		}
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(rewriteForReplay(resp.url, resp.body, resp.mime))
+}
+
+func readWARCResponseAt(name string, offset int64) (warcResponse, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return warcResponse{}, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return warcResponse{}, err
+	}
+
+	rec, block, err := newWARCReader(f, strings.HasSuffix(name, ".gz")).next()
+	if err != nil {
+		return warcResponse{}, err
+	}
+	return parseWARCResponse(rec, block)
+}
@@ -0,0 +1,246 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/sources"
+	"github.com/nikonov1101/ueb-archive/store"
+)
+
+var watchPoll time.Duration
+
+func watchFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&watchPoll, "poll", 30*time.Second, "how often to check the browser's bookmarks for changes")
+}
+
+// runWatch archives bookmarks as soon as they are added to the folder,
+// everything archived before is kept as it is.
+func runWatch(ctx context.Context, _ []string) error {
+	order, err := bookmarkOrder(sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+	if _, err := groupKey(groupBy); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("wget"); err != nil {
+		return err
+	}
+
+	modTime, err := bookmarksModTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("watching for new bookmarks", "browser", browser, "url_files", urlFiles, "folder", bookmarksFolder)
+	var seen time.Time
+	for {
+		if mod := modTime(); mod.After(seen) {
+			seen = mod
+			err := archiveNew(ctx, order, nil)
+			var code exitCode
+			if err != nil && !errors.As(err, &code) && ctx.Err() == nil {
+				slog.Error("archive run failed", "err", err)
+			}
+		}
+
+		if err := sleep(ctx, watchPoll); err != nil {
+			return nil
+		}
+	}
+}
+
+// bookmarksModTime returns the func telling when the bookmarks of any of the -browser ones,
+// or a -url-file, were last changed.
+func bookmarksModTime(ctx context.Context) (func() time.Time, error) {
+	funcs := []func() time.Time{func() time.Time { return filesModTime(urlFiles...) }}
+	for _, name := range browserNames() {
+		modTime, err := browserModTime(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, modTime)
+	}
+	return func() time.Time {
+		var latest time.Time
+		for _, modTime := range funcs {
+			if mod := modTime(); mod.After(latest) {
+				latest = mod
+			}
+		}
+		return latest
+	}, nil
+}
+
+// browserModTime returns the func telling when the browser's bookmarks were last changed.
+func browserModTime(ctx context.Context, browser string) (func() time.Time, error) {
+	switch {
+	case browser == "firefox":
+		profiles, err := browserProfiles(browser)
+		if err != nil {
+			return nil, err
+		}
+		return func() time.Time {
+			var latest time.Time
+			for _, p := range profiles {
+				if mod := sources.PlacesModTime(p.file); mod.After(latest) {
+					latest = mod
+				}
+			}
+			return latest
+		}, nil
+	case browser == "firefox-sync":
+		if _, err := loadSyncAccount(); err != nil {
+			return nil, err
+		}
+		var last time.Time
+		return func() time.Time {
+			mod, err := syncModTime(ctx)
+			if err != nil {
+				// the next poll tries again, a run would fail the same way
+				slog.Warn("failed to check the sync server", "err", err)
+				return last
+			}
+			last = mod
+			return mod
+		}, nil
+	case sources.IsChromium(browser):
+		profiles, err := browserProfiles(browser)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, p := range profiles {
+			files = append(files, p.file)
+		}
+		return func() time.Time { return filesModTime(files...) }, nil
+	case browser == "qutebrowser":
+		dir, err := sources.QutebrowserDir()
+		if err != nil {
+			return nil, err
+		}
+		bookmarks, quickmarks := sources.QutebrowserFiles(dir)
+		return func() time.Time { return filesModTime(bookmarks, quickmarks) }, nil
+	case slices.Contains(sources.TextBrowsers, browser):
+		fileName, err := sources.TextBrowserFile(browser)
+		if err != nil {
+			return nil, err
+		}
+		return func() time.Time { return filesModTime(fileName) }, nil
+	case browser == "buku":
+		dbPath, err := sources.BukuDB()
+		if err != nil {
+			return nil, err
+		}
+		return func() time.Time { return filesModTime(dbPath) }, nil
+	case browser == "linkding":
+		ld, err := newLinkding()
+		if err != nil {
+			return nil, err
+		}
+		// tagging or adding a bookmark updates its date_modified
+		var last time.Time
+		return func() time.Time {
+			list, err := ld.Bookmarks(ctx, bookmarksFolder)
+			if err != nil {
+				slog.Warn("failed to check linkding", "err", err)
+				return last
+			}
+			for _, b := range list {
+				if b.LastModified.After(last) {
+					last = b.LastModified
+				}
+			}
+			return last
+		}, nil
+	case browser == "karakeep":
+		if _, err := newKarakeep(); err != nil {
+			return nil, err
+		}
+		return time.Now, nil
+	default:
+		return nil, fmt.Errorf("unknown -browser %q, have: %s", browser, browsers)
+	}
+}
+
+// filesModTime is the last time any of the files was written,
+// browsers replace them on every change.
+func filesModTime(files ...string) time.Time {
+	var latest time.Time
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// archiveNew downloads bookmarks which are not in the index.json yet,
+// along with the ones asked to be downloaded again.
+func archiveNew(ctx context.Context, order func(a, b bookmark) int, again map[string]bool) error {
+	list, err := readBookmarks(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, err := openStateDB()
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	if list, err = withAddedBookmarks(state, list); err != nil {
+		return err
+	}
+	list = dedupeBookmarks(list)
+	againAliases(list, again)
+
+	// no manifest means nothing is archived yet
+	entries, _ := readManifest()
+	known := make(map[int64]store.Entry, len(entries))
+	for _, entry := range entries {
+		if !again[entry.URL] {
+			known[entry.Hash] = entry
+		}
+	}
+
+	// merged into another entry, see mergeSamePage
+	aliases := make(map[string]bool)
+	merged := make(map[int64]bool)
+	for _, entry := range known {
+		for _, alias := range entry.Aliases {
+			aliases[alias] = true
+		}
+		for _, hash := range entry.Merged {
+			merged[hash] = true
+		}
+	}
+
+	added, kept := 0, 0
+	for _, bmark := range list {
+		switch _, ok := known[bmark.hash]; {
+		case ok:
+			kept++
+		case !aliases[bmark.url] && !merged[bmark.hash]:
+			added++
+		}
+	}
+	if added == 0 && kept == len(known) {
+		slog.Debug("no new bookmarks")
+		return nil
+	}
+	slog.Info("found new bookmarks", "count", added)
+
+	if err := appendQueue(state, notArchived(list, known)); err != nil {
+		return err
+	}
+	return archiveBookmarks(ctx, state, list, known, again, order)
+}
@@ -0,0 +1,137 @@
+package uebarchive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// the availability api, see https://archive.org/help/wayback_api.php
+const waybackAvailableURL = "https://archive.org/wayback/available"
+
+var waybackFallback bool
+
+// waybackSnapshot is the closest snapshot the availability api knows of.
+type waybackSnapshot struct {
+	Available bool   `json:"available"`
+	URL       string `json:"url"`
+	Timestamp string `json:"timestamp"`
+	Status    string `json:"status"`
+}
+
+// looksDead tells if the page is gone for good, rather than the fetch failed:
+// the server says 404 or 410, or the host doesn't resolve anymore.
+func looksDead(bmark bookmark) bool {
+	meta, err := parseWgetLog(bmark.logfile())
+	if err == nil && (meta.httpStatus == http.StatusNotFound || meta.httpStatus == http.StatusGone) {
+		return true
+	}
+
+	f, err := os.Open(bmark.logfile())
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	lscan := bufio.NewScanner(f)
+	for lscan.Scan() {
+		if strings.Contains(lscan.Text(), "unable to resolve host address") {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverFromWayback archives the latest web.archive.org snapshot
+// of the dead page instead, the failure stays as it was if there is none.
+func recoverFromWayback(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	failure, exitCode := bmark.failure, bmark.exitCode
+
+	snapshot, err := closestWaybackSnapshot(ctx, bmark.url, bmark.fetch.proxy)
+	if err != nil {
+		logger.Warn("wayback machine lookup failed", "url", bmark.url, "err", err)
+		return
+	}
+	if snapshot == nil {
+		logger.Info("no wayback machine snapshot", "url", bmark.url)
+		return
+	}
+	takenAt, err := time.Parse("20060102150405", snapshot.Timestamp)
+	if err != nil {
+		logger.Warn("bad wayback machine snapshot timestamp", "url", bmark.url, "timestamp", snapshot.Timestamp)
+		return
+	}
+
+	// if_ is the snapshot with links pointing to the other snapshots,
+	// but without the wayback machine toolbar.
+	original, opts := bmark.url, bmark.fetch
+	bmark.url = strings.Replace(snapshot.URL, "/"+snapshot.Timestamp+"/", "/"+snapshot.Timestamp+"if_/", 1)
+	if rest, ok := strings.CutPrefix(bmark.url, "http://web.archive.org/"); ok {
+		bmark.url = "https://web.archive.org/" + rest
+	}
+	logger.Info("recovering from the wayback machine", "url", original, "snapshot", bmark.url)
+	bmark.fetch = opts.public()
+	fetchCapture(ctx, logger, bmark, func(archiveMeta) error {
+		// a capture without a meta.json is still better than the snapshot
+		if _, err := os.Stat(path.Join(archiveRoot, bmark.captureDir())); err == nil {
+			return errors.New("not replacing the previous capture")
+		}
+		return nil
+	})
+	bmark.url, bmark.fetch = original, opts
+
+	if bmark.archiveMeta == nil {
+		bmark.failure, bmark.exitCode = failure, exitCode
+		return
+	}
+	bmark.archiveMeta.recovered = "web.archive.org (" + takenAt.Format(time.DateOnly) + ")"
+	// those are of the snapshot, not of the page
+	bmark.archiveMeta.redirects = nil
+	if err := writeCaptureMeta(*bmark); err != nil {
+		logger.Warn("failed to write capture meta", "url", bmark.url, "err", err)
+	}
+}
+
+func closestWaybackSnapshot(ctx context.Context, pageURL, proxy string) (*waybackSnapshot, error) {
+	transport, err := proxyTransport(proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, waybackAvailableURL+"?url="+url.QueryEscape(pageURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("availability api status=%d", resp.StatusCode)
+	}
+
+	var available struct {
+		ArchivedSnapshots struct {
+			Closest *waybackSnapshot `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&available); err != nil {
+		return nil, fmt.Errorf("decode availability api response: %w", err)
+	}
+
+	closest := available.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.Status != "200" {
+		return nil, nil
+	}
+	return closest, nil
+}
@@ -0,0 +1,316 @@
+package uebarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nikonov1101/ueb-archive/fetch"
+)
+
+var (
+	retries      int
+	retryBackoff time.Duration
+
+	limitRate       byteSize
+	downloadTimeout time.Duration
+	maxSize         byteSize
+
+	// hosts is shared by all workers, so the per-host delay holds for the whole run.
+	hosts *hostLimiter
+)
+
+// downloadOne archives a bookmark, then post-processes the capture, see fetchWithRetries.
+func downloadOne(ctx context.Context, logger *slog.Logger, bmark *bookmark) {
+	// the hook may take minutes, the host slot is not held for it
+	if vetoedByHook(ctx, logger, bmark) {
+		return
+	}
+	if !fetchWithRetries(ctx, logger, bmark) || bmark.refreshFailed() {
+		// the kept capture is post-processed already
+		return
+	}
+	// the host is free for the next download by now,
+	// the steps may take minutes and don't request it.
+	postProcess(ctx, logger, bmark)
+	if savePageNow && bmark.archiveMeta != nil && len(bmark.archiveMeta.recovered) == 0 {
+		if withCredentials(*bmark) {
+			// the public snapshot wouldn't be what we've seen anyway
+			logger.Debug("not saving to the wayback machine, fetched with credentials", "url", bmark.url)
+		} else {
+			submitToWayback(ctx, logger, bmark)
+		}
+	}
+	runAfterCaptureHook(ctx, logger, *bmark)
+}
+
+// fetchWithRetries downloads a bookmark, retrying transient failures
+// with an exponential backoff, and falls back to the public archives.
+// It's false if the bookmark is skipped or the download is interrupted.
+func fetchWithRetries(ctx context.Context, logger *slog.Logger, bmark *bookmark) bool {
+	// the slot is held during the backoff as well, retrying
+	// a struggling host is not a reason to let others hit it.
+	hosts.acquire(bmark.domain())
+	defer hosts.release(bmark.domain())
+
+	for attempt := 1; ; attempt++ {
+		bmark.attempts = attempt
+		if err := hosts.wait(ctx, bmark.domain()); err != nil {
+			bmark.failure = "interrupted"
+			return false
+		}
+		transient := fetchOnce(ctx, logger, bmark)
+		if !transient || attempt > retries {
+			if waybackFallback && bmark.archiveMeta == nil && ctx.Err() == nil && looksDead(*bmark) {
+				recoverFromWayback(ctx, logger, bmark)
+			} else if archiveTodayFallback && bmark.archiveMeta != nil && !bmark.refreshFailed() && ctx.Err() == nil && looksPaywalled(*bmark) {
+				recoverFromArchiveToday(ctx, logger, bmark)
+			}
+			return true
+		}
+
+		delay := backoff(attempt)
+		logger.Info("retrying", "url", bmark.url, "attempt", attempt, "delay", delay, "reason", bmark.failure)
+		if err := sleep(ctx, delay); err != nil {
+			return false
+		}
+	}
+}
+
+// backoff returns base * 2^(attempt-1) plus up to 50% of jitter,
+// so workers retrying the same host don't come back at the same time.
+func backoff(attempt int) time.Duration {
+	delay := retryBackoff << (attempt - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + rand.N(delay/2+1)
+}
+
+// sleep is time.Sleep which gives up when the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wgetArgs are the arguments to download the bookmark into dir, relative to the archive root.
+func wgetArgs(bmark bookmark, dir string) ([]string, error) {
+	// the classic "linux download web-page" stackoverflow answer, works well for decades
+	args := []string{
+		"--verbose",
+		"--page-requisites",
+		"--convert-links",
+		"--adjust-extension",
+		// a mirror stays under the bookmarked path, see fetchOptions.mirror
+		"--no-parent",
+		// every bookmark gets its own directory, so captures
+		// of different pages from the same host don't mix.
+		"--directory-prefix", dir,
+		"-o", bmark.logfile(),
+	}
+
+	// the page is retried by downloadOne, wget retrying it as well
+	// would make it up to (retries+1)^2 attempts.
+	args = append(args, "--tries", "1")
+
+	if len(filterConfig) > 0 {
+		config, err := wgetConfig(bmark.fetch.excludeDomains)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--config", config)
+		// they are in the config now
+		bmark.fetch.excludeDomains = ""
+	}
+	if ignoreRobots {
+		args = append(args, "-e", "robots=off")
+	}
+	if cookies := bookmarkCookies(bmark); len(cookies) > 0 {
+		args = append(args, "--load-cookies", cookies)
+	}
+	args = append(args, bmark.fetch.wgetArgs(bmark.host())...)
+
+	if len(bmark.fetch.proxy) > 0 {
+		proxy, err := wgetProxy(bmark.fetch.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("set up proxy: %w", err)
+		}
+		args = append(args, "-e", "use_proxy=on", "-e", "http_proxy="+proxy, "-e", "https_proxy="+proxy)
+	}
+
+	if limitRate > 0 {
+		// wget limits a single process, so the total is split between workers
+		perWorker := max(int64(limitRate)/int64(max(workers, 1)), 1)
+		args = append(args, "--limit-rate", fmt.Sprint(perWorker))
+	}
+
+	return append(args, bmark.url), nil
+}
+
+// fetchOnce downloads the bookmark, reports if the failure (if any) looks transient
+// and worth retrying. A failed refresh keeps the previous capture, if there is one,
+// the failure is recorded alongside it.
+func fetchOnce(ctx context.Context, logger *slog.Logger, bmark *bookmark) bool {
+	return fetchCapture(ctx, logger, bmark, nil)
+}
+
+// fetchCapture is fetchOnce, the download replaces the capture only if accept
+// (if set) finds nothing wrong with it, the previous capture is kept otherwise.
+func fetchCapture(ctx context.Context, logger *slog.Logger, bmark *bookmark, accept func(meta archiveMeta) error) bool {
+	bmark.archiveMeta = nil
+	bmark.failure = ""
+	bmark.exitCode = 0
+
+	// the download goes into a partial directory, which replaces the previous
+	// capture only once the new one is good, see swapCapture.
+	dir := bmark.captureDir()
+	partial := dir + ".partial"
+	defer os.RemoveAll(path.Join(archiveRoot, partial))
+
+	download := fetchWget
+	if bmark.fetch.backend == "chrome" {
+		download = fetchChrome
+	}
+	meta, transient := download(ctx, logger, bmark, partial)
+	if meta != nil && accept != nil {
+		if err := accept(*meta); err != nil {
+			bmark.failure = err.Error()
+			meta = nil
+		}
+	}
+	if meta != nil {
+		if err := swapCapture(partial, dir); err != nil {
+			bmark.failure = err.Error()
+			logger.Warn("can't save the capture", "url", bmark.url, "err", err)
+			meta = nil
+		}
+	}
+	if meta == nil {
+		if bmark.archiveMeta = loadCapture(*bmark); bmark.archiveMeta != nil {
+			logger.Info("keeping the previous capture", "url", bmark.url, "archived_at", bmark.archiveMeta.archivedAt)
+		}
+		return transient
+	}
+
+	for i, name := range meta.saved {
+		if rel, ok := strings.CutPrefix(name, partial+"/"); ok {
+			meta.saved[i] = path.Join(dir, rel)
+		}
+	}
+	meta.files = hashCapturedFiles(meta.saved)
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+	bmark.archiveMeta = meta
+	if err := writeCaptureMeta(*bmark); err != nil {
+		// the capture itself is fine, only verify won't know about it
+		logger.Warn("failed to write capture meta", "url", bmark.url, "err", err)
+	}
+	logger.Info("download finished", "url", bmark.url, "backend", meta.backend, "duration", meta.execTime,
+		"http_status", meta.httpStatus, "files", len(meta.files), "size", meta.size, "attempts", bmark.attempts)
+	return false
+}
+
+// fetchWget runs wget for the bookmark, saving into the partial directory relative
+// to the archive root. The meta is nil if it has failed, transient tells then
+// if the failure is worth retrying.
+func fetchWget(ctx context.Context, logger *slog.Logger, bmark *bookmark, partial string) (*archiveMeta, bool) {
+	started := time.Now()
+	logger.Debug("download started", "url", bmark.url, "attempt", bmark.attempts)
+	_ = os.RemoveAll(path.Join(archiveRoot, partial))
+
+	logfile := bmark.logfile()
+	args, err := wgetArgs(*bmark, partial)
+	if err != nil {
+		bmark.failure = err.Error()
+		logger.Warn("can't run wget", "url", bmark.url, "err", err)
+		return nil, false
+	}
+	logger.Debug("running wget", "args", redactArgs(args))
+	wlog, err := fetch.Wget(ctx, fetch.Request{
+		URL:     bmark.url,
+		Root:    archiveRoot,
+		Dir:     partial,
+		Log:     logfile,
+		Timeout: bmark.fetch.timeout(),
+		MaxSize: int64(maxSize),
+		Logger:  logger,
+	}, args)
+	if err != nil {
+		return nil, fetchFailed(bmark, err)
+	}
+
+	meta := wgetMeta(wlog)
+	meta.backend = "wget"
+	meta.execTime = time.Since(started).Truncate(time.Millisecond)
+	meta.archivedAt = time.Now()
+	if !ignoreRobots {
+		if bs, err := os.ReadFile(path.Join(archiveRoot, meta.saved[0])); err == nil {
+			meta.robotsSkipped = robotsSkipped(ctx, *bmark, string(bs))
+		}
+	}
+	return &meta, false
+}
+
+// swapCapture replaces the capture directory with the partial one wget has saved into,
+// both relative to the archive root. The previous capture is kept until then, so
+// a failed re-download doesn't lose it.
+func swapCapture(partial, dir string) error {
+	if err := os.RemoveAll(path.Join(archiveRoot, dir)); err != nil {
+		return fmt.Errorf("remove the previous capture: %w", err)
+	}
+	if err := os.Rename(path.Join(archiveRoot, partial), path.Join(archiveRoot, dir)); err != nil {
+		return fmt.Errorf("move the capture: %w", err)
+	}
+	return nil
+}
+
+// fetchFailed records the failure of a download, and tells if it's worth retrying.
+func fetchFailed(bmark *bookmark, err error) bool {
+	var ferr *fetch.Error
+	if !errors.As(err, &ferr) {
+		ferr = &fetch.Error{Reason: err.Error()}
+	}
+	bmark.failure = ferr.Reason
+	bmark.exitCode = ferr.ExitCode
+	if ferr.Size > 0 {
+		bmark.failure = fmt.Sprintf("capture size %s exceeds -max-size %s", humanBytes(ferr.Size), humanBytes(int64(maxSize)))
+	}
+	return ferr.Transient
+}
+
+// parseWgetLog reads what wget has done from its log: the files saved, response statuses
+// and the number of requests and bytes received.
+func parseWgetLog(logfile string) (archiveMeta, error) {
+	wlog, err := fetch.ReadWgetLog(logfile)
+	if err != nil {
+		return archiveMeta{}, err
+	}
+	return wgetMeta(wlog), nil
+}
+
+func wgetMeta(wlog fetch.WgetLog) archiveMeta {
+	return archiveMeta{
+		saved:          wlog.Saved,
+		httpStatus:     wlog.Status,
+		statuses:       wlog.Statuses,
+		requests:       wlog.Requests,
+		received:       wlog.Received,
+		redirects:      wlog.Redirects,
+		wgetFinished:   wlog.Finished,
+		wgetDownloaded: wlog.Downloaded,
+	}
+}
@@ -0,0 +1,120 @@
+package uebarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// xTweetTags are tags of tweets imported from an X export.
+var xTweetTags = []string{"x", chromeTag}
+
+// readXExport reads bookmarked tweets from an X data export: the unzipped directory,
+// the zip itself, or a data/*.js file of it, like.js works too.
+// The files are javascript: window.YTD.bookmark.part0 = [{"bookmark": {"tweetId": ...}}].
+func readXExport(name string) ([]importedBookmark, error) {
+	var files [][]byte
+	switch info, err := os.Stat(name); {
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		matches, _ := filepath.Glob(filepath.Join(name, "data", "bookmark*.js"))
+		for _, match := range matches {
+			bs, err := os.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, bs)
+		}
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if ok, _ := path.Match("data/bookmark*.js", f.Name); !ok {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			bs, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, bs)
+		}
+	default:
+		bs, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bs)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no data/bookmark.js in %s", name)
+	}
+
+	var list []importedBookmark
+	added := time.Now()
+	for _, bs := range files {
+		// skip the assignment, the rest is json
+		_, data, ok := bytes.Cut(bs, []byte("="))
+		if !ok {
+			return nil, fmt.Errorf("%s: not an X export file", name)
+		}
+		var items []map[string]struct {
+			TweetID  string `json:"tweetId"`
+			FullText string `json:"fullText"`
+		}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, item := range items {
+			for _, tweet := range item {
+				if len(tweet.TweetID) == 0 {
+					continue
+				}
+				b := importedBookmark{bookmark: newBookmark("https://x.com/i/status/"+tweet.TweetID, excerptTitle(tweet.FullText))}
+				b.tags = xTweetTags
+				// keep them in the order of the export, as readOneTab does
+				b.dateAdded = added.Add(time.Duration(len(list)) * time.Microsecond)
+				list = append(list, b)
+			}
+		}
+	}
+	return list, nil
+}
+
+// looksLikeXExport tells if it's an X data export, or a file of one.
+func looksLikeXExport(name string) bool {
+	if strings.HasSuffix(name, ".js") {
+		bs, err := os.ReadFile(name)
+		return err == nil && bytes.HasPrefix(bytes.TrimSpace(bs), []byte("window.YTD."))
+	}
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return false
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if ok, _ := path.Match("data/bookmark*.js", f.Name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	matches, _ := filepath.Glob(filepath.Join(name, "data", "bookmark*.js"))
+	return len(matches) > 0
+}